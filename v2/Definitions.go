@@ -42,6 +42,11 @@ const (
 	ERR_CREATE_STREAM       = 17
 	ERR_INVALID_PARAM       = 18
 	ERR_CRC_CHECK           = 19
+	ERR_CANCELED            = 20
+	ERR_DICTIONARY          = 21
+	ERR_CONTENT_CHECK       = 22
+	ERR_DECRYPTION          = 23
+	ERR_MEMORY_LIMIT        = 24
 	ERR_UNKNOWN             = 127
 )
 
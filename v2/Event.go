@@ -16,6 +16,7 @@ limitations under the License.
 package kanzi
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -46,6 +47,22 @@ type Event struct {
 	hashType  int
 	eventTime time.Time
 	msg       string
+	offset    int64
+	skipFlags byte
+	header    *HeaderInfo
+}
+
+// HeaderInfo describes the header of a compressed stream (EVT_AFTER_HEADER_DECODING)
+type HeaderInfo struct {
+	BitstreamVersion uint   `json:"bitstreamVersion"`
+	Checksum         int    `json:"checksum"` // size of the block checksums in bits (0, 32 or 64)
+	BlockSize        int    `json:"blockSize"`
+	Entropy          string `json:"entropy"`
+	Transform        string `json:"transform"`
+	OriginalSize     int64  `json:"originalSize"` // 0 if not known
+	DictionaryID     uint32 `json:"dictionaryId"` // 0 if no dictionary
+	ContentChecksum  bool   `json:"contentChecksum"`
+	Encrypted        bool   `json:"encrypted"`
 }
 
 // NewEventFromString creates a new Event instance that wraps a message
@@ -72,6 +89,26 @@ func NewEvent(evtType, id int, size int64, hash uint64, hashType int, evtTime ti
 		hashType: hashType, eventTime: evtTime}
 }
 
+// NewBlockInfoEvent creates a new EVT_BLOCK_INFO event with the offset of the
+// block in the compressed stream (in bits) and the skip flags of the transforms
+func NewBlockInfoEvent(id int, offset int64, skipFlags byte, evtTime time.Time) *Event {
+	if evtTime.IsZero() {
+		evtTime = time.Now()
+	}
+
+	return &Event{eventType: EVT_BLOCK_INFO, id: id, offset: offset, skipFlags: skipFlags, eventTime: evtTime}
+}
+
+// NewHeaderEvent creates a new EVT_AFTER_HEADER_DECODING event with the
+// content of the header. The message is a human readable description.
+func NewHeaderEvent(header *HeaderInfo, msg string, evtTime time.Time) *Event {
+	if evtTime.IsZero() {
+		evtTime = time.Now()
+	}
+
+	return &Event{eventType: EVT_AFTER_HEADER_DECODING, id: 0, msg: msg, header: header, eventTime: evtTime}
+}
+
 // Type returns the type info
 func (this *Event) Type() int {
 	return this.eventType
@@ -102,56 +139,144 @@ func (this *Event) HashType() int {
 	return this.hashType
 }
 
-// String returns a string representation of this event.
-// If the event wraps a message, the the message is returned.
-// Owtherwise a string is built from the fields.
-func (this *Event) String() string {
-	if len(this.msg) > 0 {
-		return this.msg
-	}
+// Offset returns the offset of the block in the compressed stream in bits
+// (EVT_BLOCK_INFO events)
+func (this *Event) Offset() int64 {
+	return this.offset
+}
 
-	hash := ""
-	t := ""
-	id := ""
+// SkipFlags returns the skip flags of the block, one bit per transform of the
+// chain, 1 means skipped (EVT_BLOCK_INFO events)
+func (this *Event) SkipFlags() byte {
+	return this.skipFlags
+}
 
-	if this.hashType != EVT_HASH_NONE {
-		hash = fmt.Sprintf(", \"hash\":\"%x\"", this.hash)
-	}
+// Header returns the content of the stream header (EVT_AFTER_HEADER_DECODING
+// events) or nil
+func (this *Event) Header() *HeaderInfo {
+	return this.header
+}
 
-	if this.id >= 0 {
-		id = fmt.Sprintf(", \"id\":%d", this.id)
-	}
+// Message returns the message wrapped by the event (if any)
+func (this *Event) Message() string {
+	return this.msg
+}
 
+// TypeName returns the name of the type of event
+func (this *Event) TypeName() string {
 	switch this.eventType {
 	case EVT_BEFORE_TRANSFORM:
-		t = "BEFORE_TRANSFORM"
+		return "BEFORE_TRANSFORM"
 
 	case EVT_AFTER_TRANSFORM:
-		t = "AFTER_TRANSFORM"
+		return "AFTER_TRANSFORM"
 
 	case EVT_BEFORE_ENTROPY:
-		t = "BEFORE_ENTROPY"
+		return "BEFORE_ENTROPY"
 
 	case EVT_AFTER_ENTROPY:
-		t = "AFTER_ENTROPY"
+		return "AFTER_ENTROPY"
 
 	case EVT_COMPRESSION_START:
-		t = "COMPRESSION_START"
+		return "COMPRESSION_START"
 
 	case EVT_DECOMPRESSION_START:
-		t = "DECOMPRESSION_START"
+		return "DECOMPRESSION_START"
 
 	case EVT_COMPRESSION_END:
-		t = "COMPRESSION_END"
+		return "COMPRESSION_END"
 
 	case EVT_DECOMPRESSION_END:
-		t = "DECOMPRESSION_END"
+		return "DECOMPRESSION_END"
+
+	case EVT_AFTER_HEADER_DECODING:
+		return "AFTER_HEADER_DECODING"
+
+	case EVT_BLOCK_INFO:
+		return "BLOCK_INFO"
+	}
+
+	return ""
+}
+
+// MarshalJSON returns a JSON object with the typed fields of the event.
+// The time is provided in milliseconds since the epoch and the hash as an
+// hexadecimal string.
+func (this *Event) MarshalJSON() ([]byte, error) {
+	obj := struct {
+		Type      string      `json:"type"`
+		ID        *int        `json:"id,omitempty"`
+		Time      int64       `json:"time"`
+		Size      *int64      `json:"size,omitempty"`
+		Hash      string      `json:"hash,omitempty"`
+		HashType  int         `json:"hashType,omitempty"`
+		Offset    *int64      `json:"offset,omitempty"`
+		SkipFlags *byte       `json:"skipFlags,omitempty"`
+		Header    *HeaderInfo `json:"header,omitempty"`
+		Message   string      `json:"message,omitempty"`
+	}{Type: this.TypeName(), Time: this.eventTime.UnixNano() / 1000000}
+
+	if this.id >= 0 {
+		obj.ID = &this.id
+	}
+
+	if this.hashType != EVT_HASH_NONE {
+		obj.Hash = fmt.Sprintf("%x", this.hash)
+		obj.HashType = this.hashType
+	}
 
+	switch this.eventType {
 	case EVT_BLOCK_INFO:
-		t = "BLOCK_INFO"
+		if len(this.msg) == 0 {
+			obj.Offset = &this.offset
+			obj.SkipFlags = &this.skipFlags
+		} else {
+			obj.Message = this.msg
+		}
+
+	case EVT_AFTER_HEADER_DECODING:
+		obj.Header = this.header
+
+		if this.header == nil {
+			obj.Message = this.msg
+		}
+
+	default:
+		if len(this.msg) == 0 {
+			obj.Size = &this.size
+		} else {
+			obj.Message = this.msg
+		}
+	}
+
+	return json.Marshal(obj)
+}
+
+// String returns a string representation of this event.
+// If the event wraps a message, the the message is returned.
+// Owtherwise a string is built from the fields.
+func (this *Event) String() string {
+	if len(this.msg) > 0 {
+		return this.msg
+	}
+
+	hash := ""
+	id := ""
+
+	if this.hashType != EVT_HASH_NONE {
+		hash = fmt.Sprintf(", \"hash\":\"%x\"", this.hash)
+	}
+
+	if this.id >= 0 {
+		id = fmt.Sprintf(", \"id\":%d", this.id)
+	}
+
+	if this.eventType == EVT_BLOCK_INFO {
+		return fmt.Sprintf("{ \"type\":\"%s\"%s, \"offset\":%d, \"skipFlags\":%.8b }", this.TypeName(), id,
+			this.offset, this.skipFlags)
 	}
 
-	return fmt.Sprintf("{ \"type\":\"%s\"%s, \"size\":%d, \"time\":%d%s }", t, id, this.size,
+	return fmt.Sprintf("{ \"type\":\"%s\"%s, \"size\":%d, \"time\":%d%s }", this.TypeName(), id, this.size,
 		this.eventTime.UnixNano()/1000000, hash)
 }
 
@@ -0,0 +1,640 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// createArchiveOutput opens the output of an archive (file, 'none' or 'stdout')
+func createArchiveOutput(outputName string, overwrite bool) (io.WriteCloser, int, error) {
+	if strings.EqualFold(outputName, _COMP_NONE) == true {
+		output, _ := kio.NewNullOutputStream()
+		return output, 0, nil
+	}
+
+	if strings.EqualFold(outputName, _COMP_STDOUT) == true {
+		return os.Stdout, 0, nil
+	}
+
+	if fi, err := os.Stat(outputName); err == nil {
+		if fi.IsDir() == true {
+			return nil, kanzi.ERR_OUTPUT_IS_DIR, fmt.Errorf("Output must be a file (or 'NONE'): '%s'", outputName)
+		}
+
+		if overwrite == false {
+			return nil, kanzi.ERR_OVERWRITE_FILE, fmt.Errorf("File '%s' exists and the 'force' command line option has not been provided", outputName)
+		}
+	}
+
+	output, err := os.Create(outputName)
+
+	if err != nil {
+		return nil, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot open output file '%s' for writing: %v", outputName, err)
+	}
+
+	return output, 0, nil
+}
+
+// createArchiveEntries builds the file table of an archive. The names are
+// relative to the parent folder of the target.
+func createArchiveEntries(target string, files []internal.FileData) ([]kio.ArchiveEntry, error) {
+	root, err := filepath.Abs(target)
+
+	if err != nil {
+		return nil, err
+	}
+
+	root = filepath.Dir(root)
+	entries := make([]kio.ArchiveEntry, 0, len(files))
+
+	for _, f := range files {
+		fullPath, err := filepath.Abs(f.FullPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		name, err := filepath.Rel(root, fullPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := os.Lstat(f.FullPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e := kio.ArchiveEntry{Name: filepath.ToSlash(name), ModTime: fi.ModTime(), Mode: fi.Mode().Perm()}
+
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			if e.Link, err = os.Readlink(f.FullPath); err != nil {
+				return nil, err
+			}
+
+			e.Mode |= fs.ModeSymlink
+		} else {
+			e.Size = fi.Size()
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// archivePacker writes the files described by the entries to w
+type archivePacker func(w io.Writer, entries []kio.ArchiveEntry, files []internal.FileData) (int, error)
+
+// compressArchive packs all the input files in one compressed stream
+func (this *BlockCompressor) compressArchive(files []internal.FileData, ctx map[string]any) (int, uint64) {
+	return this.packFiles(files, ctx, ".knz", this.writeArchive)
+}
+
+// writeArchive writes the file table and the content of the files
+func (this *BlockCompressor) writeArchive(w io.Writer, entries []kio.ArchiveEntry, files []internal.FileData) (int, error) {
+	aw, err := kio.NewArchiveWriter(w, entries)
+
+	if err != nil {
+		return kanzi.ERR_WRITE_FILE, fmt.Errorf("Cannot write archive file table: %v", err)
+	}
+
+	buffer := make([]byte, _COMP_DEFAULT_BUFFER_SIZE)
+
+	for i := range files {
+		e, err := aw.Next()
+
+		if err != nil {
+			return kanzi.ERR_WRITE_FILE, err
+		}
+
+		log.Println("Adding "+e.Name, this.verbosity > 1)
+
+		if e.IsSymlink() == true {
+			continue
+		}
+
+		if code, err := copyToArchive(aw, files[i].FullPath, e.Size, buffer); err != nil {
+			return code, err
+		}
+	}
+
+	if err = aw.Close(); err != nil {
+		return kanzi.ERR_PROCESS_BLOCK, err
+	}
+
+	return 0, nil
+}
+
+// packFiles writes all the input files in one compressed stream (the output
+// defaults to the name of the input followed by the suffix)
+func (this *BlockCompressor) packFiles(files []internal.FileData, ctx map[string]any, suffix string, pack archivePacker) (int, uint64) {
+	before := time.Now()
+	target := this.inputName
+
+	// Remove the '/.' suffix (no recursion)
+	if len(target) > 2 && target[len(target)-1] == '.' && target[len(target)-2] == os.PathSeparator {
+		target = target[0 : len(target)-2]
+	}
+
+	// Files of the same folder are stored together, by decreasing size
+	if this.fileReorder == true {
+		sort.Sort(internal.NewFileCompare(files, true))
+	}
+
+	entries, err := createArchiveEntries(target, files)
+
+	if err != nil {
+		log.Println(fmt.Sprintf("Cannot create archive file table: %v", err), true)
+		return kanzi.ERR_OPEN_FILE, 0
+	}
+
+	total := int64(0)
+
+	for i := range entries {
+		total += entries[i].Size
+	}
+
+	outputName := this.outputName
+
+	if len(outputName) == 0 {
+		outputName = strings.TrimRight(filepath.Clean(target), string([]byte{os.PathSeparator})) + suffix
+	}
+
+	if this.autoBlockSize == true && this.jobs > 0 {
+		bl := total / int64(this.jobs)
+		bl = (bl + 63) & ^63
+		bl = min(bl, _COMP_MAX_BLOCK_SIZE)
+		bl = max(bl, _COMP_MIN_BLOCK_SIZE)
+		this.blockSize = uint(bl)
+	}
+
+	log.Println("Output file name: '"+outputName+"'", this.verbosity > 2)
+	output, code, err := createArchiveOutput(outputName, this.overwrite)
+
+	if err != nil {
+		log.Println(err.Error(), true)
+		return code, 0
+	}
+
+	defer output.Close()
+	ctx["inputName"] = this.inputName
+	ctx["outputName"] = outputName
+	ctx["blockSize"] = this.blockSize
+	ctx["jobs"] = this.jobs
+	cos, err := kio.NewWriterWithCtx(output, ctx)
+
+	if err != nil {
+		if ioerr, isIOErr := err.(*kio.IOError); isIOErr == true {
+			log.Println(ioerr.Message(), true)
+			return ioerr.ErrorCode(), 0
+		}
+
+		log.Println(fmt.Sprintf("Cannot create compressed stream: %s", err.Error()), true)
+		return kanzi.ERR_CREATE_COMPRESSOR, 0
+	}
+
+	defer cos.Close()
+
+	for _, bl := range this.listeners {
+		cos.AddListener(bl)
+	}
+
+	if len(this.listeners) > 0 {
+		evt := kanzi.NewEvent(kanzi.EVT_COMPRESSION_START, -1, total, 0, kanzi.EVT_HASH_NONE, time.Now())
+		notifyBCListeners(this.listeners, evt)
+	}
+
+	if code, err := pack(cos, entries, files); err != nil {
+		log.Println(err.Error(), true)
+		return code, cos.GetWritten()
+	}
+
+	if err = cos.Close(); err != nil {
+		log.Println(err.Error(), true)
+		return kanzi.ERR_PROCESS_BLOCK, cos.GetWritten()
+	}
+
+	written := cos.GetWritten()
+	delta := time.Since(before).Milliseconds()
+
+	if len(this.listeners) > 0 {
+		evt := kanzi.NewEvent(kanzi.EVT_COMPRESSION_END, -1, int64(written), 0, kanzi.EVT_HASH_NONE, time.Now())
+		notifyBCListeners(this.listeners, evt)
+	}
+
+	if this.verbosity >= 1 {
+		msg := fmt.Sprintf("%d ms", delta)
+
+		if delta >= 100000 {
+			msg = fmt.Sprintf("%.1f s", float64(delta)/1000)
+		}
+
+		if total == 0 {
+			msg = fmt.Sprintf("Archived %d file(s) to %s: %d => %d in %s", len(entries), outputName, total, written, msg)
+		} else {
+			f := float64(written) / float64(total)
+			msg = fmt.Sprintf("Archived %d file(s) to %s: %d => %d (%.2f%%) in %s", len(entries), outputName, total, written, 100*f, msg)
+		}
+
+		log.Println(msg, true)
+	}
+
+	if this.removeSource == true {
+		for _, f := range files {
+			if err := os.Remove(f.FullPath); err != nil {
+				log.Println(fmt.Sprintf("Warning: input file could not be deleted (%v)", err), this.verbosity > 0)
+			}
+		}
+	}
+
+	return 0, written
+}
+
+// copyToArchive writes the content of a file (which must not have changed
+// since the file table has been created) to the archive.
+func copyToArchive(w io.Writer, name string, size int64, buffer []byte) (int, error) {
+	input, err := os.Open(name)
+
+	if err != nil {
+		return kanzi.ERR_OPEN_FILE, fmt.Errorf("Cannot open input file '%s': %v", name, err)
+	}
+
+	defer input.Close()
+	n, err := io.CopyBuffer(w, io.LimitReader(input, size), buffer)
+
+	if err != nil {
+		if ioerr, isIOErr := err.(*kio.IOError); isIOErr == true {
+			return ioerr.ErrorCode(), err
+		}
+
+		return kanzi.ERR_READ_FILE, fmt.Errorf("Failed to read file '%s': %v", name, err)
+	}
+
+	if n != size {
+		return kanzi.ERR_READ_FILE, fmt.Errorf("File '%s' has been modified during archiving", name)
+	}
+
+	return 0, nil
+}
+
+// archiveIterator returns the next entry of an archive and the reader of its
+// content (io.EOF after the last entry)
+type archiveIterator func() (*kio.ArchiveEntry, io.Reader, error)
+
+// openArchive opens the input stream and reads the archive file table
+func (this *BlockDecompressor) openArchive(ctx map[string]any) (*kio.Reader, *kio.ArchiveReader, io.Closer, int) {
+	cis, input, code := this.openArchiveStream(ctx)
+
+	if code != 0 {
+		return nil, nil, nil, code
+	}
+
+	ar, err := kio.NewArchiveReader(cis)
+
+	if err != nil {
+		cis.Close()
+		input.Close()
+		log.Println(err.(*kio.IOError).Message(), true)
+		return nil, nil, nil, err.(*kio.IOError).ErrorCode()
+	}
+
+	return cis, ar, input, 0
+}
+
+// openArchiveStream opens the compressed input stream of an archive
+func (this *BlockDecompressor) openArchiveStream(ctx map[string]any) (*kio.Reader, io.Closer, int) {
+	var input *os.File
+
+	if strings.EqualFold(this.inputName, _DECOMP_STDIN) {
+		input = os.Stdin
+	} else {
+		var err error
+
+		if input, err = os.Open(this.inputName); err != nil {
+			log.Println(fmt.Sprintf("Cannot open input file '%s': %v", this.inputName, err), true)
+			return nil, nil, kanzi.ERR_OPEN_FILE
+		}
+	}
+
+	ctx["inputName"] = this.inputName
+	ctx["jobs"] = this.jobs
+	cis, err := kio.NewReaderWithCtx(input, ctx)
+
+	if err != nil {
+		input.Close()
+		log.Println(err.(*kio.IOError).Message(), true)
+		return nil, nil, err.(*kio.IOError).ErrorCode()
+	}
+
+	for _, bl := range this.listeners {
+		cis.AddListener(bl)
+	}
+
+	return cis, input, 0
+}
+
+// listArchive prints the file table of an archive
+func (this *BlockDecompressor) listArchive(ctx map[string]any) (int, uint64) {
+	cis, ar, input, code := this.openArchive(ctx)
+
+	if code != 0 {
+		return code, 0
+	}
+
+	defer input.Close()
+	defer cis.Close()
+	total := int64(0)
+
+	for _, e := range ar.Entries() {
+		name := e.Name
+
+		if e.IsSymlink() == true {
+			name += " -> " + e.Link
+		}
+
+		msg := fmt.Sprintf("%s %12d %s %s", e.Mode.String(), e.Size, e.ModTime.Format("2006-01-02 15:04:05"), name)
+		log.Println(msg, true)
+		total += e.Size
+	}
+
+	log.Println(fmt.Sprintf("\n%d file(s), %d byte(s)", len(ar.Entries()), total), this.verbosity > 0)
+	return 0, cis.GetRead()
+}
+
+// extractArchive restores the files of an archive under the output folder
+func (this *BlockDecompressor) extractArchive(ctx map[string]any) (int, uint64) {
+	return this.extractFiles(ctx, func(cis *kio.Reader) (archiveIterator, error) {
+		ar, err := kio.NewArchiveReader(cis)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return func() (*kio.ArchiveEntry, io.Reader, error) {
+			e, err := ar.Next()
+			return e, ar, err
+		}, nil
+	})
+}
+
+// extractFiles restores the entries of the archive read from the compressed
+// input stream under the output folder
+func (this *BlockDecompressor) extractFiles(ctx map[string]any, open func(*kio.Reader) (archiveIterator, error)) (int, uint64) {
+	before := time.Now()
+	root := this.outputName
+	discard := strings.EqualFold(root, _DECOMP_NONE)
+
+	if len(root) == 0 {
+		root = "."
+	}
+
+	if strings.EqualFold(root, _DECOMP_STDOUT) {
+		log.Println("Extract mode: the output must be a directory (or 'NONE')", true)
+		return kanzi.ERR_INVALID_PARAM, 0
+	}
+
+	if discard == false {
+		if fi, err := os.Stat(root); err == nil && fi.IsDir() == false {
+			log.Println(fmt.Sprintf("Output must be a directory (or 'NONE'): '%s'", root), true)
+			return kanzi.ERR_CREATE_FILE, 0
+		}
+	}
+
+	if len(this.listeners) > 0 {
+		evt := kanzi.NewEvent(kanzi.EVT_DECOMPRESSION_START, -1, 0, 0, kanzi.EVT_HASH_NONE, time.Now())
+		notifyBDListeners(this.listeners, evt)
+	}
+
+	cis, input, code := this.openArchiveStream(ctx)
+
+	if code != 0 {
+		return code, 0
+	}
+
+	defer input.Close()
+	defer cis.Close()
+	next, err := open(cis)
+
+	if err != nil {
+		return this.archiveError(err, 0)
+	}
+
+	buffer := make([]byte, _DECOMP_DEFAULT_BUFFER_SIZE)
+	extracted := int64(0)
+	nbFiles := 0
+
+	for {
+		e, r, err := next()
+
+		if err != nil {
+			if errors.Is(err, io.EOF) == true {
+				break
+			}
+
+			return this.archiveError(err, cis.GetRead())
+		}
+
+		if discard == true {
+			if e.Mode.IsDir() == true {
+				continue
+			}
+
+			n, err := io.CopyBuffer(io.Discard, r, buffer)
+			extracted += n
+
+			if err != nil {
+				return this.archiveError(err, cis.GetRead())
+			}
+
+			nbFiles++
+			continue
+		}
+
+		if e.IsSymlink() == true && this.noLinks == true {
+			log.Println("Skipping link "+e.Name, this.verbosity > 1)
+			continue
+		}
+
+		log.Println("Extracting "+e.Name, this.verbosity > 1)
+		n, code, err := this.extractEntry(root, e, r, buffer)
+		extracted += n
+
+		if err != nil {
+			log.Println(err.Error(), true)
+			return code, cis.GetRead()
+		}
+
+		if e.Mode.IsDir() == false {
+			nbFiles++
+		}
+	}
+
+	// Close the stream to check the end of stream (EG. content checksum)
+	if err := cis.Close(); err != nil {
+		return this.archiveError(err, cis.GetRead())
+	}
+
+	if len(this.listeners) > 0 {
+		evt := kanzi.NewEvent(kanzi.EVT_DECOMPRESSION_END, -1, int64(cis.GetRead()), 0, kanzi.EVT_HASH_NONE, time.Now())
+		notifyBDListeners(this.listeners, evt)
+	}
+
+	if this.verbosity >= 1 {
+		delta := time.Since(before).Milliseconds()
+		msg := fmt.Sprintf("%d ms", delta)
+
+		if delta >= 100000 {
+			msg = fmt.Sprintf("%.1f s", float64(delta)/1000)
+		}
+
+		msg = fmt.Sprintf("Extracted %d file(s) from %s: %d => %d in %s", nbFiles, this.inputName, cis.GetRead(), extracted, msg)
+		log.Println(msg, true)
+	}
+
+	if this.removeSource == true && strings.EqualFold(this.inputName, _DECOMP_STDIN) == false {
+		input.Close()
+
+		if err := os.Remove(this.inputName); err != nil {
+			log.Println(fmt.Sprintf("Warning: input file could not be deleted (%v)", err), this.verbosity > 0)
+		}
+	}
+
+	return 0, uint64(extracted)
+}
+
+func (this *BlockDecompressor) archiveError(err error, read uint64) (int, uint64) {
+	var ioerr *kio.IOError
+
+	if errors.As(err, &ioerr) == true {
+		log.Println(ioerr.Message(), true)
+		return ioerr.ErrorCode(), read
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) == true {
+		log.Println(fmt.Sprintf("Truncated archive: %v", err), true)
+		return kanzi.ERR_INVALID_FILE, read
+	}
+
+	if errors.Is(err, errInvalidTar) == true {
+		log.Println(err.Error(), true)
+		return kanzi.ERR_INVALID_FILE, read
+	}
+
+	log.Println(fmt.Sprintf("An unexpected condition happened. Exiting ...\n%v", err), true)
+	return kanzi.ERR_PROCESS_BLOCK, read
+}
+
+// extractEntry creates the file, link or folder of an archive entry under
+// root. Returns the number of bytes written, an error code and an error.
+func (this *BlockDecompressor) extractEntry(root string, e *kio.ArchiveEntry, r io.Reader, buffer []byte) (int64, int, error) {
+	name := filepath.Join(root, filepath.FromSlash(e.Name))
+
+	// The names are relative and cannot escape root, but a link extracted
+	// previously could redirect a parent folder.
+	dir := root
+
+	for _, elem := range strings.Split(e.Name, "/")[:strings.Count(e.Name, "/")] {
+		dir = filepath.Join(dir, elem)
+
+		if fi, err := os.Lstat(dir); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+			return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot extract '%s': '%s' is a link", e.Name, dir)
+		}
+	}
+
+	if e.Mode.IsDir() == true {
+		if err := os.MkdirAll(name, 0755); err != nil {
+			return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot create folder '%s': %v", name, err)
+		}
+
+		return 0, 0, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot create folder for '%s': %v", name, err)
+	}
+
+	if fi, err := os.Lstat(name); err == nil {
+		if this.overwrite == false {
+			return 0, kanzi.ERR_OVERWRITE_FILE, fmt.Errorf("File '%s' exists and the 'force' command line option has not been provided", name)
+		}
+
+		if fi.IsDir() == true {
+			return 0, kanzi.ERR_OUTPUT_IS_DIR, fmt.Errorf("Cannot overwrite folder '%s'", name)
+		}
+
+		// Never write through an existing link
+		if err = os.Remove(name); err != nil {
+			return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot overwrite file '%s': %v", name, err)
+		}
+	}
+
+	if e.IsSymlink() == true {
+		if err := os.Symlink(e.Link, name); err != nil {
+			return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot create link '%s': %v", name, err)
+		}
+
+		return 0, 0, nil
+	}
+
+	output, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+
+	if err != nil {
+		return 0, kanzi.ERR_CREATE_FILE, fmt.Errorf("Cannot open output file '%s' for writing: %v", name, err)
+	}
+
+	n, err := io.CopyBuffer(output, r, buffer)
+
+	if err != nil {
+		output.Close()
+		var ioerr *kio.IOError
+
+		if errors.As(err, &ioerr) == true {
+			return n, ioerr.ErrorCode(), errors.New(ioerr.Message())
+		}
+
+		return n, kanzi.ERR_WRITE_FILE, fmt.Errorf("Failed to extract '%s': %v", name, err)
+	}
+
+	if err = output.Close(); err != nil {
+		return n, kanzi.ERR_WRITE_FILE, fmt.Errorf("Failed to close file '%s': %v", name, err)
+	}
+
+	// Best effort: restore the permissions and modification time
+	if err = os.Chmod(name, e.Mode.Perm()); err == nil {
+		err = os.Chtimes(name, e.ModTime, e.ModTime)
+	}
+
+	if err != nil {
+		log.Println(fmt.Sprintf("Warning: cannot restore the attributes of '%s': %v", name, err), this.verbosity > 0)
+	}
+
+	return n, 0, nil
+}
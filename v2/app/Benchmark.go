@@ -0,0 +1,365 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+const (
+	_BENCH_MIN_DURATION    = 500 * time.Millisecond // minimum duration of the runs of a setting
+	_BENCH_MAX_ITERATIONS  = 16
+	_BENCH_MEMORY_SAMPLING = 2 * time.Millisecond
+	_BENCH_HEAP_METRIC     = "/memory/classes/heap/objects:bytes"
+)
+
+// Transforms and entropy codecs benchmarked by default (see the levels)
+var (
+	_BENCH_TRANSFORMS = []string{"NONE", "PACK+LZ", "TEXT+UTF+PACK+MM+LZX", "TEXT+UTF+EXE+PACK+MM+ROLZ",
+		"TEXT+UTF+BWT+RANK+ZRLT", "LZP+TEXT+UTF+BWT+LZP"}
+	_BENCH_ENTROPY_CODECS = []string{"NONE", "HUFFMAN", "ANS0", "FPAQ", "CM"}
+)
+
+type benchResult struct {
+	transform      string
+	entropy        string
+	compressedSize int
+	ratio          float64
+	compSpeed      float64 // MB/s
+	decompSpeed    float64 // MB/s
+	peakMemory     uint64  // bytes allocated on the heap above the baseline
+}
+
+// runBenchmark compresses and decompresses the sample file(s) provided as
+// input in memory with all the combinations of transforms and entropy codecs
+// then prints the results and the Pareto optimal settings.
+func runBenchmark(argsMap map[string]any) int {
+	verbosity := argsMap["verbosity"].(uint)
+	inputName := argsMap["inputName"].(string)
+	transforms := _BENCH_TRANSFORMS
+	codecs := _BENCH_ENTROPY_CODECS
+	blockSize := uint(_COMP_DEFAULT_BLOCK_SIZE)
+	jobs := uint(runtime.NumCPU())
+	noDotFiles := false
+	noLinks := false
+
+	if t, prst := argsMap["transform"]; prst == true {
+		transforms = splitBenchList(t.(string))
+	}
+
+	if e, prst := argsMap["entropy"]; prst == true {
+		codecs = splitBenchList(e.(string))
+	}
+
+	if bs, prst := argsMap["blockSize"]; prst == true {
+		blockSize = bs.(uint)
+	}
+
+	if j, prst := argsMap["jobs"]; prst == true && j.(uint) > 0 {
+		jobs = min(j.(uint), _COMP_MAX_CONCURRENCY)
+	}
+
+	if noDot, prst := argsMap["noDotFiles"]; prst == true {
+		noDotFiles = noDot.(bool)
+	}
+
+	if noLink, prst := argsMap["noLinks"]; prst == true {
+		noLinks = noLink.(bool)
+	}
+
+	// Validate the matrix before running anything
+	for _, t := range transforms {
+		if _, err := transform.GetType(t); err != nil {
+			fmt.Printf("Invalid transform provided on command line: %s\n", t)
+			return kanzi.ERR_INVALID_CODEC
+		}
+	}
+
+	for _, e := range codecs {
+		if _, err := entropy.GetType(e); err != nil {
+			fmt.Printf("Invalid entropy codec provided on command line: %s\n", e)
+			return kanzi.ERR_INVALID_CODEC
+		}
+	}
+
+	if len(inputName) == 0 || strings.EqualFold(inputName, _COMP_STDIN) {
+		fmt.Println("Missing sample: provide a file or directory as input")
+		return kanzi.ERR_MISSING_PARAM
+	}
+
+	sample, code := readBenchSample(inputName, noLinks, noDotFiles)
+
+	if code != 0 {
+		return code
+	}
+
+	msg := fmt.Sprintf("Sample: %d bytes, block size: %d, jobs: %d, %d setting(s)\n",
+		len(sample), blockSize, jobs, len(transforms)*len(codecs))
+	log.Println(msg, verbosity > 0)
+	results := make([]benchResult, 0, len(transforms)*len(codecs))
+
+	for _, t := range transforms {
+		for _, e := range codecs {
+			log.Println(fmt.Sprintf("Running %s&%s ...", t, e), verbosity > 1)
+			res, err := benchSetting(sample, t, e, blockSize, jobs)
+
+			if err != nil {
+				fmt.Printf("Benchmark of %s&%s failed: %v\n", t, e, err)
+
+				if ioerr, isIOErr := err.(*kio.IOError); isIOErr == true {
+					return ioerr.ErrorCode()
+				}
+
+				return kanzi.ERR_PROCESS_BLOCK
+			}
+
+			results = append(results, res)
+		}
+	}
+
+	printBenchResults(results)
+	return 0
+}
+
+func splitBenchList(list string) []string {
+	res := make([]string, 0)
+
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.Trim(strings.TrimSpace(s), "+"); len(s) > 0 {
+			res = append(res, strings.ToUpper(s))
+		}
+	}
+
+	return res
+}
+
+// readBenchSample concatenates the content of the sample files
+func readBenchSample(inputName string, noLinks, noDotFiles bool) ([]byte, int) {
+	suffix := string([]byte{os.PathSeparator, '.'})
+	target := inputName
+	isRecursive := len(target) <= 2 || target[len(target)-len(suffix):] != suffix
+
+	if isRecursive == false {
+		target = target[0 : len(target)-1]
+	}
+
+	files, err := internal.CreateFileList(target, make([]internal.FileData, 0, 256), isRecursive, noLinks, noDotFiles)
+
+	if err != nil {
+		fmt.Printf("Cannot access sample files: %v\n", err)
+		return nil, kanzi.ERR_OPEN_FILE
+	}
+
+	sample := make([]byte, 0)
+
+	for _, f := range files {
+		buf, err := os.ReadFile(f.FullPath)
+
+		if err != nil {
+			fmt.Printf("Cannot read sample file '%s': %v\n", f.FullPath, err)
+			return nil, kanzi.ERR_READ_FILE
+		}
+
+		sample = append(sample, buf...)
+	}
+
+	if len(sample) == 0 {
+		fmt.Println("Cannot find any sample data")
+		return nil, kanzi.ERR_OPEN_FILE
+	}
+
+	return sample, 0
+}
+
+// benchSetting compresses and decompresses the sample several times (until
+// the minimum duration is reached) and keeps the best times.
+func benchSetting(sample []byte, t, e string, blockSize, jobs uint) (benchResult, error) {
+	res := benchResult{transform: t, entropy: e}
+	var compressed []byte
+	output := make([]byte, len(sample))
+	compTime := time.Duration(1<<63 - 1)
+	decompTime := compTime
+	start := time.Now()
+	peak := uint64(0)
+	stop := trackHeap(&peak)
+	defer stop()
+
+	for i := 0; i < _BENCH_MAX_ITERATIONS && (i == 0 || time.Since(start) < _BENCH_MIN_DURATION); i++ {
+		bs := internal.NewBufferStream()
+		ctx := map[string]any{"transform": t, "entropy": e, "blockSize": blockSize, "jobs": jobs, "checksum": uint(0)}
+		before := time.Now()
+		w, err := kio.NewWriterWithCtx(bs, ctx)
+
+		if err != nil {
+			return res, err
+		}
+
+		if _, err = w.Write(sample); err != nil {
+			return res, err
+		}
+
+		if err = w.Close(); err != nil {
+			return res, err
+		}
+
+		compTime = min(compTime, time.Since(before))
+		compressed = make([]byte, bs.Len())
+		bs.Read(compressed)
+		before = time.Now()
+		r, err := kio.NewReaderWithCtx(internal.NewBufferStream(compressed), map[string]any{"jobs": jobs})
+
+		if err != nil {
+			return res, err
+		}
+
+		if _, err = io.ReadFull(r, output); err != nil {
+			return res, err
+		}
+
+		if err = r.Close(); err != nil {
+			return res, err
+		}
+
+		decompTime = min(decompTime, time.Since(before))
+
+		if bytes.Equal(output, sample) == false {
+			return res, fmt.Errorf("invalid data after decompression")
+		}
+	}
+
+	stop()
+	res.peakMemory = peak
+	res.compressedSize = len(compressed)
+	res.ratio = float64(len(sample)) / float64(max(len(compressed), 1))
+	res.compSpeed = float64(len(sample)) / 1000000 / max(compTime.Seconds(), 1e-9)
+	res.decompSpeed = float64(len(sample)) / 1000000 / max(decompTime.Seconds(), 1e-9)
+	return res, nil
+}
+
+// trackHeap samples the size of the heap until the returned function is
+// called and saves the peak size above the initial size in peak.
+func trackHeap(peak *uint64) func() {
+	runtime.GC()
+	sample := []metrics.Sample{{Name: _BENCH_HEAP_METRIC}}
+	metrics.Read(sample)
+	baseline := sample[0].Value.Uint64()
+	done := make(chan bool)
+	var once sync.Once
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(_BENCH_MEMORY_SAMPLING)
+		defer ticker.Stop()
+
+		for {
+			metrics.Read(sample)
+
+			if v := sample[0].Value.Uint64(); v > baseline && v-baseline > *peak {
+				*peak = v - baseline
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// paretoFront returns the indexes of the results not dominated by any other
+// result for the compression ratio and the speed returned by speed.
+func paretoFront(results []benchResult, speed func(*benchResult) float64) []int {
+	front := make([]int, 0)
+
+	for i := range results {
+		dominated := false
+
+		for j := range results {
+			ri, rj := &results[i], &results[j]
+
+			if i != j && rj.ratio >= ri.ratio && speed(rj) >= speed(ri) && (rj.ratio > ri.ratio || speed(rj) > speed(ri)) {
+				dominated = true
+				break
+			}
+		}
+
+		if dominated == false {
+			front = append(front, i)
+		}
+	}
+
+	// Fastest first
+	sort.Slice(front, func(a, b int) bool {
+		return speed(&results[front[a]]) > speed(&results[front[b]])
+	})
+
+	return front
+}
+
+func printBenchResults(results []benchResult) {
+	log.Println(fmt.Sprintf("%-40s %12s %8s %12s %12s %10s", "Setting", "Size", "Ratio", "Comp MB/s", "Decomp MB/s", "Peak MB"), true)
+
+	for _, r := range results {
+		msg := fmt.Sprintf("%-40s %12d %8.3f %12.1f %12.1f %10.1f", r.transform+"&"+r.entropy, r.compressedSize,
+			r.ratio, r.compSpeed, r.decompSpeed, float64(r.peakMemory)/(1024*1024))
+		log.Println(msg, true)
+	}
+
+	fronts := []struct {
+		title string
+		speed func(*benchResult) float64
+	}{
+		{"compression", func(r *benchResult) float64 { return r.compSpeed }},
+		{"decompression", func(r *benchResult) float64 { return r.decompSpeed }},
+	}
+
+	for _, f := range fronts {
+		log.Println(fmt.Sprintf("\nPareto optimal settings (ratio vs %s speed):", f.title), true)
+
+		for _, i := range paretoFront(results, f.speed) {
+			r := &results[i]
+			msg := fmt.Sprintf("   -t %s -e %s (ratio %.3f, %.1f MB/s)", r.transform, r.entropy, r.ratio, f.speed(r))
+			log.Println(msg, true)
+		}
+	}
+
+	log.Println("", true)
+}
@@ -28,6 +28,7 @@ import (
 	"time"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
 	"github.com/flanglet/kanzi-go/v2/internal"
 	kio "github.com/flanglet/kanzi-go/v2/io"
 	"github.com/flanglet/kanzi-go/v2/transform"
@@ -50,11 +51,23 @@ type BlockCompressor struct {
 	overwrite     bool
 	checksum      uint
 	skipBlocks    bool
+	blockIndex    bool
+	contentCksum  bool
 	fileReorder   bool
 	removeSource  bool
 	noDotFiles    bool
 	noLinks       bool
 	autoBlockSize bool
+	autoBudget    uint
+	autoCodecs    string
+	archive       bool
+	tar           bool // pack the files in a compressed tar stream
+	preserve      bool // store the metadata of the input files
+	report        bool // write the events as JSON Lines
+	reportLevel   uint
+	dictionary    *kio.Dictionary
+	password      []byte
+	maxMemory     uint64 // memory limit of the block buffers (0 means no limit)
 	inputName     string
 	outputName    string
 	entropyCodec  string
@@ -103,8 +116,18 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 			this.entropyCodec = tokens[1]
 		} else {
 			if prstC == true {
-				this.entropyCodec = codec.(string)
 				delete(argsMap, "entropy")
+
+				// Validate the codec name (built-in or registered codec)
+				eType, err := entropy.GetType(codec.(string))
+
+				if err != nil {
+					return nil, err
+				}
+
+				if this.entropyCodec, err = entropy.GetName(eType); err != nil {
+					return nil, err
+				}
 			} else {
 				this.entropyCodec = "NONE"
 			}
@@ -145,6 +168,20 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 		this.skipBlocks = false
 	}
 
+	if idx, prst := argsMap["blockIndex"]; prst == true {
+		this.blockIndex = idx.(bool)
+		delete(argsMap, "blockIndex")
+	} else {
+		this.blockIndex = false
+	}
+
+	if cc, prst := argsMap["contentChecksum"]; prst == true {
+		this.contentCksum = cc.(bool)
+		delete(argsMap, "contentChecksum")
+	} else {
+		this.contentCksum = false
+	}
+
 	if skip, prst := argsMap["autoBlock"]; prst == true {
 		this.autoBlockSize = skip.(bool)
 		delete(argsMap, "autoBlock")
@@ -152,6 +189,50 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 		this.autoBlockSize = false
 	}
 
+	if archive, prst := argsMap["archive"]; prst == true {
+		this.archive = archive.(bool)
+		delete(argsMap, "archive")
+	} else {
+		this.archive = false
+	}
+
+	if tar, prst := argsMap["tar"]; prst == true {
+		this.tar = tar.(bool)
+		delete(argsMap, "tar")
+	} else {
+		this.tar = false
+	}
+
+	if preserve, prst := argsMap["preserve"]; prst == true {
+		this.preserve = preserve.(bool)
+		delete(argsMap, "preserve")
+	} else {
+		this.preserve = false
+	}
+
+	if report, prst := argsMap["report"]; prst == true {
+		this.report = report.(string) == "json"
+		this.reportLevel = argsMap["reportLevel"].(uint)
+		delete(argsMap, "report")
+		delete(argsMap, "reportLevel")
+	} else {
+		this.report = false
+	}
+
+	if codecs, prst := argsMap["autoCandidates"]; prst == true {
+		this.autoCodecs = codecs.(string)
+		delete(argsMap, "autoCandidates")
+	} else {
+		this.autoCodecs = ""
+	}
+
+	if budget, prst := argsMap["autoBudget"]; prst == true {
+		this.autoBudget = budget.(uint)
+		delete(argsMap, "autoBudget")
+	} else {
+		this.autoBudget = 0
+	}
+
 	this.inputName = argsMap["inputName"].(string)
 	delete(argsMap, "inputName")
 
@@ -257,6 +338,31 @@ func NewBlockCompressor(argsMap map[string]any) (*BlockCompressor, error) {
 
 	this.jobs = min(concurrency, _COMP_MAX_CONCURRENCY)
 
+	if name, prst := argsMap["passwordFile"]; prst == true {
+		var err error
+
+		if this.password, err = readPassword(name.(string)); err != nil {
+			return nil, err
+		}
+
+		delete(argsMap, "passwordFile")
+	}
+
+	if mm, prst := argsMap["maxMemory"]; prst == true {
+		this.maxMemory = mm.(uint64)
+		delete(argsMap, "maxMemory")
+	}
+
+	if name, prst := argsMap["dictionary"]; prst == true {
+		var err error
+
+		if this.dictionary, err = loadDictionary(name.(string)); err != nil {
+			return nil, err
+		}
+
+		delete(argsMap, "dictionary")
+	}
+
 	if prof, prst := argsMap["cpuProf"]; prst == true {
 		this.cpuProf = prof.(string)
 		delete(argsMap, "cpuProf")
@@ -348,40 +454,39 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 
 		if err != nil {
 			if ioerr, isIOErr := err.(kio.IOError); isIOErr == true {
-				fmt.Printf("%s\n", ioerr.Error())
+				log.Println(ioerr.Error(), true)
 				return ioerr.ErrorCode(), 0
 			}
 
-			fmt.Printf("An unexpected condition happened. Exiting ...\n%s\n", err.Error())
+			log.Println(fmt.Sprintf("An unexpected condition happened. Exiting ...\n%s", err.Error()), true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
 		if len(files) == 0 {
-			fmt.Println("Cannot find any file to compress")
+			log.Println("Cannot find any file to compress", true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
 		nbFiles = len(files)
 
-		if nbFiles > 1 {
+		if this.archive == true || this.tar == true {
+			msg = fmt.Sprintf("%d file(s) to archive\n", nbFiles)
+		} else if nbFiles > 1 {
 			msg = fmt.Sprintf("%d files to compress\n", nbFiles)
 		} else {
 			msg = fmt.Sprintf("%d file to compress\n", nbFiles)
 		}
 
 		log.Println(msg, this.verbosity > 0)
+	} else if this.archive == true || this.tar == true {
+		log.Println("Archive mode: the input must be a file or a directory", true)
+		return kanzi.ERR_INVALID_PARAM, 0
 	}
 
 	isStdOut := strings.EqualFold(this.outputName, _COMP_STDOUT)
 
-	// Limit verbosity level when output is stdout
-	// Logic is duplicated here to avoid dependency to Kanzi.go
-	if isStdOut == true {
-		this.verbosity = 0
-	}
-
 	// Limit verbosity level when files are processed concurrently
-	if this.jobs > 1 && nbFiles > 1 && this.verbosity > 1 {
+	if this.jobs > 1 && nbFiles > 1 && this.verbosity > 1 && this.archive == false && this.tar == false {
 		log.Println("Warning: limiting verbosity to 1 due to concurrent processing of input files.\n", true)
 		this.verbosity = 1
 	}
@@ -408,6 +513,10 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 
 		msg = fmt.Sprintf("Block checksum: %s", chksum)
 		log.Println(msg, true)
+		msg = fmt.Sprintf("Content checksum: %t", this.contentCksum)
+		log.Println(msg, true)
+		msg = fmt.Sprintf("Encryption: %t", this.password != nil)
+		log.Println(msg, true)
 		w1 := "no"
 
 		if this.transform != _COMP_NONE {
@@ -425,6 +534,21 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		msg = fmt.Sprintf("Using %s entropy codec (stage 2)", w2)
 		log.Println(msg, true)
 
+		if len(this.autoCodecs) > 0 {
+			msg = fmt.Sprintf("Automatic codec selection: %s", this.autoCodecs)
+			log.Println(msg, true)
+
+			if this.autoBudget > 0 {
+				msg = fmt.Sprintf("Automatic codec selection budget: %d ms per block", this.autoBudget)
+				log.Println(msg, true)
+			}
+		}
+
+		if this.dictionary != nil {
+			msg = fmt.Sprintf("Dictionary: %d bytes (ID %08x)", len(this.dictionary.Bytes()), this.dictionary.ID())
+			log.Println(msg, true)
+		}
+
 		if this.jobs > 1 {
 			msg = fmt.Sprintf("Using %d jobs", this.jobs)
 			log.Println(msg, true)
@@ -433,12 +557,61 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		}
 	}
 
-	if this.verbosity > 2 {
-		if listener, err2 := NewInfoPrinter(this.verbosity, ENCODING, os.Stdout); err2 == nil {
+	var reporter *JSONReporter
+
+	// The report and the block information go to stderr if the compressed
+	// data goes to stdout
+	out := os.Stdout
+
+	if isStdOut == true {
+		out = os.Stderr
+	}
+
+	if this.report == true {
+		reporter, _ = NewJSONReporter(this.reportLevel, ENCODING, out)
+	} else if this.verbosity > 2 {
+		if listener, err2 := NewInfoPrinter(this.verbosity, ENCODING, out); err2 == nil {
 			this.AddListener(listener)
 		}
 	}
 
+	ctx := make(map[string]any)
+	ctx["verbosity"] = this.verbosity
+	ctx["remove"] = this.removeSource
+	ctx["preserve"] = this.preserve
+	ctx["overwrite"] = this.overwrite
+	ctx["skipBlocks"] = this.skipBlocks
+	ctx["blockIndex"] = this.blockIndex
+	ctx["checksum"] = this.checksum
+	ctx["contentChecksum"] = this.contentCksum
+	ctx["entropy"] = this.entropyCodec
+	ctx["transform"] = this.transform
+
+	if this.dictionary != nil {
+		ctx["dictionary"] = this.dictionary
+	}
+
+	if this.password != nil {
+		ctx["password"] = this.password
+	}
+
+	if this.maxMemory > 0 {
+		ctx["maxMemory"] = this.maxMemory
+	}
+
+	if len(this.autoCodecs) > 0 {
+		ctx["autoCandidates"] = this.autoCodecs
+		ctx["autoBudget"] = this.autoBudget
+	}
+
+	if this.archive == true {
+		return this.compressArchive(files, ctx)
+	}
+
+	if this.tar == true {
+		return this.compressTar(files, ctx)
+	}
+
 	read := uint64(0)
 	written := uint64(0)
 	inputIsDir := false
@@ -450,7 +623,7 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		fi, err := os.Stat(formattedInName)
 
 		if err != nil {
-			fmt.Println("Cannot find any file to compress")
+			log.Println("Cannot find any file to compress", true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
@@ -469,12 +642,12 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 				fi, err = os.Stat(formattedOutName)
 
 				if err != nil {
-					fmt.Println("Output must be an existing directory (or 'NONE')")
+					log.Println("Output must be an existing directory (or 'NONE')", true)
 					return kanzi.ERR_OPEN_FILE, 0
 				}
 
 				if !fi.IsDir() {
-					fmt.Println("Output must be a directory (or 'NONE')")
+					log.Println("Output must be a directory (or 'NONE')", true)
 					return kanzi.ERR_CREATE_FILE, 0
 				}
 
@@ -487,21 +660,13 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 				fi, err = os.Stat(formattedOutName)
 
 				if err == nil && fi.IsDir() {
-					fmt.Println("Output must be a file (or 'NONE')")
+					log.Println("Output must be a file (or 'NONE')", true)
 					return kanzi.ERR_CREATE_FILE, 0
 				}
 			}
 		}
 	}
 
-	ctx := make(map[string]any)
-	ctx["verbosity"] = this.verbosity
-	ctx["remove"] = this.removeSource
-	ctx["overwrite"] = this.overwrite
-	ctx["skipBlocks"] = this.skipBlocks
-	ctx["checksum"] = this.checksum
-	ctx["entropy"] = this.entropyCodec
-	ctx["transform"] = this.transform
 	var res int
 
 	if nbFiles == 1 {
@@ -540,7 +705,7 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		ctx["outputName"] = oName
 		ctx["blockSize"] = this.blockSize
 		ctx["jobs"] = this.jobs
-		task := fileCompressTask{ctx: ctx, listeners: this.listeners}
+		task := fileCompressTask{ctx: ctx, listeners: this.listeners, reporter: reporter}
 		res, read, written, err = task.call()
 	} else {
 		// Create channels for task synchronization
@@ -549,6 +714,17 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		cancel := make(chan bool, 1)
 
 		jobsPerTask, _ := internal.ComputeJobsPerTask(make([]uint, nbFiles), this.jobs, uint(nbFiles))
+		nbWorkers := this.jobs
+
+		// The outputs must not be interleaved on stdout: process the files
+		// sequentially, each one with all the jobs
+		if isStdOut == true {
+			for i := range jobsPerTask {
+				jobsPerTask[i] = this.jobs
+			}
+
+			nbWorkers = 1
+		}
 
 		if this.fileReorder == true {
 			sort.Sort(internal.NewFileCompare(files, true))
@@ -584,7 +760,13 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 			taskCtx["outputName"] = oName
 			taskCtx["blockSize"] = this.blockSize
 			taskCtx["jobs"] = jobsPerTask[i]
-			task := fileCompressTask{ctx: taskCtx, listeners: this.listeners}
+
+			if this.maxMemory > 0 {
+				// The files processed concurrently share the memory limit
+				taskCtx["maxMemory"] = this.maxMemory * uint64(jobsPerTask[i]) / uint64(this.jobs)
+			}
+
+			task := fileCompressTask{ctx: taskCtx, listeners: this.listeners, reporter: reporter}
 
 			// Push task to channel. The workers are the consumers.
 			tasks <- task
@@ -593,7 +775,7 @@ func (this *BlockCompressor) Compress() (int, uint64) {
 		close(tasks)
 
 		// Create one worker per job. A worker calls several tasks sequentially.
-		for j := uint(0); j < this.jobs; j++ {
+		for j := uint(0); j < nbWorkers; j++ {
 			go fileCompressWorker(tasks, cancel, results)
 		}
 
@@ -663,48 +845,35 @@ func notifyBCListeners(listeners []kanzi.Listener, evt *kanzi.Event) {
 }
 
 func getTransformAndCodec(level int) string {
-	switch level {
-	case 0:
-		return "NONE&NONE"
-
-	case 1:
-		return "PACK+LZ&NONE"
-
-	case 2:
-		return "DNA+LZ&HUFFMAN"
-
-	case 3:
-		return "TEXT+UTF+PACK+MM+LZX&HUFFMAN"
-
-	case 4:
-		return "TEXT+UTF+EXE+PACK+MM+ROLZ&NONE"
-
-	case 5:
-		return "TEXT+UTF+BWT+RANK+ZRLT&ANS0"
-
-	case 6:
-		return "TEXT+UTF+BWT+SRT+ZRLT&FPAQ"
-
-	case 7:
-		return "LZP+TEXT+UTF+BWT+LZP&CM"
-
-	case 8:
-		return "EXE+RLT+TEXT+UTF+DNA&TPAQ"
+	t, e, err := kio.GetLevelCodecs(level)
 
-	case 9:
-		return "EXE+RLT+TEXT+UTF+DNA&TPAQX"
-
-	default:
+	if err != nil {
 		return "Unknown&Unknown"
 	}
+
+	return t + "&" + e
 }
 
 type fileCompressTask struct {
 	ctx       map[string]any
 	listeners []kanzi.Listener
+	reporter  *JSONReporter
 }
 
 func (this *fileCompressTask) call() (int, uint64, uint64, error) {
+	if this.reporter == nil {
+		return this.run()
+	}
+
+	// Report the events of this file with its name, then the summary
+	rep := this.reporter.forFile(this.ctx["inputName"].(string), this.ctx["outputName"].(string))
+	this.listeners = append(this.listeners[0:len(this.listeners):len(this.listeners)], rep)
+	res, read, written, err := this.run()
+	rep.reportFile(res, read, written, err, this.ctx)
+	return res, read, written, err
+}
+
+func (this *fileCompressTask) run() (int, uint64, uint64, error) {
 	var msg string
 	removeSource := this.ctx["remove"].(bool)
 	verbosity := this.ctx["verbosity"].(uint)
@@ -729,13 +898,12 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 		if output, err = os.OpenFile(outputName, os.O_RDWR, 0666); err == nil {
 			// File exists
 			if err = output.Close(); err != nil {
-				fmt.Printf("Cannot create output file '%s': error closing existing file\n", outputName)
+				log.Println(fmt.Sprintf("Cannot create output file '%s': error closing existing file", outputName), true)
 				return kanzi.ERR_OVERWRITE_FILE, 0, 0, err
 			}
 
 			if overwrite == false {
-				fmt.Printf("File '%s' exists and the 'force' command ", outputName)
-				fmt.Println("line option has not been provided")
+				log.Println(fmt.Sprintf("File '%s' exists and the 'force' command line option has not been provided", outputName), true)
 				return kanzi.ERR_OVERWRITE_FILE, 0, 0, err
 			}
 
@@ -743,7 +911,7 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 			path2, _ := filepath.Abs(outputName)
 
 			if path1 == path2 {
-				fmt.Print("The input and output files must be different")
+				log.Println("The input and output files must be different", true)
 				return kanzi.ERR_CREATE_FILE, 0, 0, err
 			}
 		}
@@ -759,7 +927,7 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 			}
 
 			if err != nil {
-				fmt.Printf("Cannot open output file '%s' for writing: %v\n", outputName, err)
+				log.Println(fmt.Sprintf("Cannot open output file '%s' for writing: %v", outputName, err), true)
 				return kanzi.ERR_CREATE_FILE, 0, 0, err
 			}
 		}
@@ -767,15 +935,30 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 		defer output.Close()
 	}
 
+	if this.ctx["preserve"].(bool) == true {
+		if strings.EqualFold(inputName, _COMP_STDIN) == true {
+			log.Println("Warning: ignoring preserve option with STDIN", verbosity > 0)
+		} else {
+			md, err := readFileMetadata(inputName)
+
+			if err != nil {
+				log.Println(fmt.Sprintf("Cannot read metadata of input file '%s': %v", inputName, err), true)
+				return kanzi.ERR_READ_FILE, 0, 0, err
+			}
+
+			this.ctx["metadata"] = md
+		}
+	}
+
 	cos, err := kio.NewWriterWithCtx(output, this.ctx)
 
 	if err != nil {
 		if ioerr, isIOErr := err.(kio.IOError); isIOErr == true {
-			fmt.Printf("%s\n", ioerr.Error())
+			log.Println(ioerr.Error(), true)
 			return ioerr.ErrorCode(), 0, 0, err
 		}
 
-		fmt.Printf("Cannot create compressed stream: %s\n", err.Error())
+		log.Println(fmt.Sprintf("Cannot create compressed stream: %s", err.Error()), true)
 		return kanzi.ERR_CREATE_COMPRESSOR, 0, 0, err
 	}
 
@@ -789,7 +972,7 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 		var err error
 
 		if input, err = os.Open(inputName); err != nil {
-			fmt.Printf("Cannot open input file '%s': %v\n", inputName, err)
+			log.Println(fmt.Sprintf("Cannot open input file '%s': %v", inputName, err), true)
 			return kanzi.ERR_OPEN_FILE, 0, 0, err
 		}
 
@@ -820,14 +1003,15 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 	before := time.Now()
 
 	for {
-		var length int
+		// Fill the buffer: a pipe may return short reads before the end of input
+		length, errRead := io.ReadFull(input, buffer)
 
-		if length, err = input.Read(buffer); err != nil {
-			if errors.Is(err, io.EOF) == false {
+		if err = errRead; err != nil {
+			if errors.Is(err, io.EOF) == false && errors.Is(err, io.ErrUnexpectedEOF) == false {
 				// Ignore EOF (see comment in io.Copy:
 				// Because Copy is defined to read from src until EOF, it does not
 				// treat EOF from Read an an error to be reported)
-				fmt.Printf("Failed to read block from file '%s': %v\n", inputName, err)
+				log.Println(fmt.Sprintf("Failed to read block from file '%s': %v", inputName, err), true)
 				return kanzi.ERR_READ_FILE, read, cos.GetWritten(), err
 			}
 		}
@@ -837,16 +1021,17 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 
 			if _, err = cos.Write(buffer[0:length]); err != nil {
 				if ioerr, isIOErr := err.(kio.IOError); isIOErr == true {
-					fmt.Printf("%s\n", ioerr.Error())
+					log.Println(ioerr.Error(), true)
 					return ioerr.ErrorCode(), read, cos.GetWritten(), err
 				}
 
-				fmt.Printf("An unexpected condition happened. Exiting ...\n%v\n", err.Error())
+				log.Println(fmt.Sprintf("An unexpected condition happened. Exiting ...\n%v", err.Error()), true)
 				return kanzi.ERR_PROCESS_BLOCK, read, cos.GetWritten(), err
 			}
 		}
 
-		if length < len(buffer) {
+		// End of input
+		if errRead != nil {
 			break
 		}
 	}
@@ -854,7 +1039,7 @@ func (this *fileCompressTask) call() (int, uint64, uint64, error) {
 	// Close streams to ensure all data are flushed
 	// Deferred close is fallback for error paths
 	if err := cos.Close(); err != nil {
-		fmt.Printf("%v\n", err)
+		log.Println(err.Error(), true)
 		return kanzi.ERR_PROCESS_BLOCK, read, cos.GetWritten(), err
 	}
 
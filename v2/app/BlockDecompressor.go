@@ -52,6 +52,17 @@ type BlockDecompressor struct {
 	jobs         uint
 	from         int // start blovk
 	to           int // end block
+	dictionary   *kio.Dictionary
+	password     []byte
+	archive      bool // extract the files of an archive
+	listOnly     bool // list the files of an archive
+	tar          bool // extract the files of a compressed tar stream
+	testOnly     bool // check the integrity of the compressed files
+	preserve     bool // restore the metadata of the original files
+	report       bool // write the events as JSON Lines
+	reportLevel  uint
+	maxMemory    uint64 // memory limit of the block buffers (0 means no limit)
+	strict       bool   // hardened decoding of untrusted input
 	listeners    []kanzi.Listener
 	cpuProf      string
 }
@@ -96,6 +107,50 @@ func NewBlockDecompressor(argsMap map[string]any) (*BlockDecompressor, error) {
 		this.noLinks = false
 	}
 
+	if archive, prst := argsMap["archive"]; prst == true {
+		this.archive = archive.(bool)
+		delete(argsMap, "archive")
+	} else {
+		this.archive = false
+	}
+
+	if tar, prst := argsMap["tar"]; prst == true {
+		this.tar = tar.(bool)
+		delete(argsMap, "tar")
+	} else {
+		this.tar = false
+	}
+
+	if list, prst := argsMap["list"]; prst == true {
+		this.listOnly = list.(bool)
+		delete(argsMap, "list")
+	} else {
+		this.listOnly = false
+	}
+
+	if preserve, prst := argsMap["preserve"]; prst == true {
+		this.preserve = preserve.(bool)
+		delete(argsMap, "preserve")
+	} else {
+		this.preserve = false
+	}
+
+	if report, prst := argsMap["report"]; prst == true {
+		this.report = report.(string) == "json"
+		this.reportLevel = argsMap["reportLevel"].(uint)
+		delete(argsMap, "report")
+		delete(argsMap, "reportLevel")
+	} else {
+		this.report = false
+	}
+
+	if test, prst := argsMap["test"]; prst == true {
+		this.testOnly = test.(bool)
+		delete(argsMap, "test")
+	} else {
+		this.testOnly = false
+	}
+
 	this.inputName = argsMap["inputName"].(string)
 	delete(argsMap, "inputName")
 
@@ -114,10 +169,16 @@ func NewBlockDecompressor(argsMap map[string]any) (*BlockDecompressor, error) {
 		return nil, fmt.Errorf("'%s' is a reserved name", this.outputName)
 	}
 
-	if len(this.outputName) == 0 && this.inputName == _DECOMP_STDIN {
+	// Archives are extracted to the current folder by default
+	if len(this.outputName) == 0 && this.inputName == _DECOMP_STDIN && this.archive == false && this.tar == false {
 		this.outputName = _DECOMP_STDOUT
 	}
 
+	// The integrity test does not produce any output
+	if this.testOnly == true {
+		this.outputName = _DECOMP_NONE
+	}
+
 	concurrency := uint(1)
 
 	if c, prst := argsMap["jobs"].(uint); prst == true {
@@ -153,6 +214,36 @@ func NewBlockDecompressor(argsMap map[string]any) (*BlockDecompressor, error) {
 		this.to = -1
 	}
 
+	if name, prst := argsMap["passwordFile"]; prst == true {
+		var err error
+
+		if this.password, err = readPassword(name.(string)); err != nil {
+			return nil, err
+		}
+
+		delete(argsMap, "passwordFile")
+	}
+
+	if mm, prst := argsMap["maxMemory"]; prst == true {
+		this.maxMemory = mm.(uint64)
+		delete(argsMap, "maxMemory")
+	}
+
+	if s, prst := argsMap["strict"]; prst == true {
+		this.strict = s.(bool)
+		delete(argsMap, "strict")
+	}
+
+	if name, prst := argsMap["dictionary"]; prst == true {
+		var err error
+
+		if this.dictionary, err = loadDictionary(name.(string)); err != nil {
+			return nil, err
+		}
+
+		delete(argsMap, "dictionary")
+	}
+
 	if prof, prst := argsMap["cpuProf"]; prst == true {
 		this.cpuProf = prof.(string)
 		delete(argsMap, "cpuProf")
@@ -244,33 +335,34 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 
 		if err != nil {
 			if ioerr, isIOErr := err.(kio.IOError); isIOErr == true {
-				fmt.Printf("%s\n", ioerr.Error())
+				log.Println(ioerr.Error(), true)
 				return ioerr.ErrorCode(), 0
 			}
 
-			fmt.Printf("An unexpected condition happened. Exiting ...\n%s\n", err.Error())
+			log.Println(fmt.Sprintf("An unexpected condition happened. Exiting ...\n%s", err.Error()), true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
 		if len(files) == 0 {
-			fmt.Println("Cannot find any file to decompress")
+			log.Println("Cannot find any file to decompress", true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
 		nbFiles = len(files)
 
+		action := "decompress"
+
+		if this.testOnly == true {
+			action = "test"
+		}
+
 		if nbFiles > 1 {
-			msg = fmt.Sprintf("%d files to decompress\n", nbFiles)
+			msg = fmt.Sprintf("%d files to %s\n", nbFiles, action)
 		} else {
-			msg = fmt.Sprintf("%d file to decompress\n", nbFiles)
+			msg = fmt.Sprintf("%d file to %s\n", nbFiles, action)
 		}
 
-		log.Println(msg, this.verbosity > 0)
-	}
-
-	// Limit verbosity level when output is stdout
-	if strings.EqualFold(this.outputName, _DECOMP_STDOUT) {
-		this.verbosity = 0
+		log.Println(msg, this.verbosity > 0 && this.archive == false && this.tar == false && this.listOnly == false)
 	}
 
 	// Limit verbosity level when files are processed concurrently
@@ -295,24 +387,73 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 
 	isStdOut := strings.EqualFold(this.outputName, _DECOMP_STDOUT)
 
-	// Limit verbosity level when output is stdout
-	// Logic is duplicated here to avoid dependency to Kanzi.go
-	if isStdOut == true {
-		this.verbosity = 0
-	}
-
 	// Limit verbosity level when files are processed concurrently
 	if this.jobs > 1 && nbFiles > 1 && this.verbosity > 1 {
 		log.Println("Warning: limiting verbosity to 1 due to concurrent processing of input files.\n", true)
 		this.verbosity = 1
 	}
 
-	if this.verbosity > 2 {
-		if listener, err2 := NewInfoPrinter(this.verbosity, DECODING, os.Stdout); err2 == nil {
+	var reporter *JSONReporter
+
+	// The report and the block information go to stderr if the decompressed
+	// data goes to stdout
+	out := os.Stdout
+
+	if isStdOut == true {
+		out = os.Stderr
+	}
+
+	if this.report == true {
+		reporter, _ = NewJSONReporter(this.reportLevel, DECODING, out)
+	} else if this.verbosity > 2 && this.testOnly == false {
+		if listener, err2 := NewInfoPrinter(this.verbosity, DECODING, out); err2 == nil {
 			this.AddListener(listener)
 		}
 	}
 
+	ctx := make(map[string]any)
+	ctx["verbosity"] = this.verbosity
+	ctx["overwrite"] = this.overwrite
+	ctx["remove"] = this.removeSource
+	ctx["preserve"] = this.preserve
+
+	if this.dictionary != nil {
+		ctx["dictionary"] = this.dictionary
+	}
+
+	if this.password != nil {
+		ctx["password"] = this.password
+	}
+
+	if this.maxMemory > 0 {
+		ctx["maxMemory"] = this.maxMemory
+	}
+
+	if this.strict == true {
+		ctx["strict"] = true
+	}
+
+	if this.archive == true || this.tar == true || this.listOnly == true {
+		if nbFiles > 1 {
+			log.Println("Archive mode: the input must be a single file", true)
+			return kanzi.ERR_INVALID_PARAM, 0
+		}
+
+		if this.listOnly == true {
+			return this.listArchive(ctx)
+		}
+
+		if this.tar == true {
+			return this.extractTar(ctx)
+		}
+
+		return this.extractArchive(ctx)
+	}
+
+	if this.testOnly == true {
+		return this.testFiles(files, ctx)
+	}
+
 	read := uint64(0)
 	var inputIsDir bool
 	formattedOutName := this.outputName
@@ -323,7 +464,7 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 		fi, err := os.Stat(formattedInName)
 
 		if err != nil {
-			fmt.Printf("Cannot access %s\n", formattedInName)
+			log.Println(fmt.Sprintf("Cannot access %s", formattedInName), true)
 			return kanzi.ERR_OPEN_FILE, 0
 		}
 
@@ -342,12 +483,12 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 				fi, err = os.Stat(formattedOutName)
 
 				if err != nil {
-					fmt.Println("Output must be an existing directory (or 'NONE')")
+					log.Println("Output must be an existing directory (or 'NONE')", true)
 					return kanzi.ERR_OPEN_FILE, 0
 				}
 
 				if !fi.IsDir() {
-					fmt.Println("Output must be a directory (or 'NONE')")
+					log.Println("Output must be a directory (or 'NONE')", true)
 					return kanzi.ERR_CREATE_FILE, 0
 				}
 
@@ -362,17 +503,13 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 				fi, err = os.Stat(formattedOutName)
 
 				if err == nil && fi.IsDir() {
-					fmt.Println("Output must be a file (or 'NONE')")
+					log.Println("Output must be a file (or 'NONE')", true)
 					return kanzi.ERR_CREATE_FILE, 0
 				}
 			}
 		}
 	}
 
-	ctx := make(map[string]any)
-	ctx["verbosity"] = this.verbosity
-	ctx["overwrite"] = this.overwrite
-	ctx["remove"] = this.removeSource
 	var res int
 
 	if this.from >= 0 {
@@ -412,7 +549,7 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 		ctx["inputName"] = iName
 		ctx["outputName"] = oName
 		ctx["jobs"] = this.jobs
-		task := fileDecompressTask{ctx: ctx, listeners: this.listeners}
+		task := fileDecompressTask{ctx: ctx, listeners: this.listeners, reporter: reporter}
 
 		res, read, _ = task.call()
 	} else {
@@ -422,6 +559,18 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 		cancel := make(chan bool, 1)
 
 		jobsPerTask, _ := internal.ComputeJobsPerTask(make([]uint, nbFiles), this.jobs, uint(nbFiles))
+		nbWorkers := this.jobs
+
+		// The outputs must not be interleaved on stdout: process the files
+		// sequentially, each one with all the jobs
+		if isStdOut == true {
+			for i := range jobsPerTask {
+				jobsPerTask[i] = this.jobs
+			}
+
+			nbWorkers = 1
+		}
+
 		sort.Sort(internal.NewFileCompare(files, true))
 
 		for i, f := range files {
@@ -451,7 +600,13 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 			taskCtx["inputName"] = iName
 			taskCtx["outputName"] = oName
 			taskCtx["jobs"] = jobsPerTask[i]
-			task := fileDecompressTask{ctx: taskCtx, listeners: this.listeners}
+
+			if this.maxMemory > 0 {
+				// The files processed concurrently share the memory limit
+				taskCtx["maxMemory"] = this.maxMemory * uint64(jobsPerTask[i]) / uint64(this.jobs)
+			}
+
+			task := fileDecompressTask{ctx: taskCtx, listeners: this.listeners, reporter: reporter}
 
 			// Push task to channel. The workers are the consumers.
 			tasks <- task
@@ -460,7 +615,7 @@ func (this *BlockDecompressor) Decompress() (int, uint64) {
 		close(tasks)
 
 		// Create one worker per job. A worker calls several tasks sequentially.
-		for j := uint(0); j < this.jobs; j++ {
+		for j := uint(0); j < nbWorkers; j++ {
 			go fileDecompressWorker(tasks, cancel, results)
 		}
 
@@ -526,9 +681,23 @@ func notifyBDListeners(listeners []kanzi.Listener, evt *kanzi.Event) {
 type fileDecompressTask struct {
 	ctx       map[string]any
 	listeners []kanzi.Listener
+	reporter  *JSONReporter
 }
 
 func (this *fileDecompressTask) call() (int, uint64, error) {
+	if this.reporter == nil {
+		return this.run()
+	}
+
+	// Report the events of this file with its name, then the summary
+	rep := this.reporter.forFile(this.ctx["inputName"].(string), this.ctx["outputName"].(string))
+	this.listeners = append(this.listeners[0:len(this.listeners):len(this.listeners)], rep)
+	res, decoded, err := this.run()
+	rep.reportFile(res, decoded, 0, err, this.ctx)
+	return res, decoded, err
+}
+
+func (this *fileDecompressTask) run() (int, uint64, error) {
 	var msg string
 	removeSource := this.ctx["remove"].(bool)
 	verbosity := this.ctx["verbosity"].(uint)
@@ -566,8 +735,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		if output, err = os.OpenFile(outputName, os.O_RDWR, 0666); err == nil {
 			// File exists
 			if overwrite == false {
-				fmt.Printf("File '%s' exists and the 'force' command ", outputName)
-				fmt.Println("line option has not been provided")
+				log.Println(fmt.Sprintf("File '%s' exists and the 'force' command line option has not been provided", outputName), true)
 				return kanzi.ERR_OVERWRITE_FILE, 0, err
 			}
 
@@ -575,7 +743,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 			path2, _ := filepath.Abs(outputName)
 
 			if path1 == path2 {
-				fmt.Print("The input and output files must be different")
+				log.Println("The input and output files must be different", true)
 				return kanzi.ERR_CREATE_FILE, 0, err
 			}
 		} else {
@@ -590,7 +758,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 				}
 
 				if err != nil {
-					fmt.Printf("Cannot open output file '%s' for writing: %v\n", outputName, err)
+					log.Println(fmt.Sprintf("Cannot open output file '%s' for writing: %v", outputName, err), true)
 					return kanzi.ERR_CREATE_FILE, 0, err
 				}
 			}
@@ -615,22 +783,44 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		var err error
 
 		if input, err = os.Open(inputName); err != nil {
-			fmt.Printf("Cannot open input file '%s': %v\n", inputName, err)
+			log.Println(fmt.Sprintf("Cannot open input file '%s': %v", inputName, err), true)
 			return kanzi.ERR_OPEN_FILE, 0, err
 		}
 
 		defer input.Close()
 	}
 
-	cis, err := kio.NewReaderWithCtx(input, this.ctx)
+	var cis *kio.Reader
+	var err error
+	from, hasFrom := this.ctx["from"]
+	f, isFile := input.(*os.File)
+
+	// Use random access for regular files with a block index: the blocks are
+	// read concurrently and the blocks before the start block (if any) are skipped.
+	if isFile == true && input != os.Stdin {
+		if fi, err2 := f.Stat(); err2 == nil && fi.Mode().IsRegular() {
+			cis, err = kio.NewReaderAt(f, fi.Size(), this.ctx)
+
+			if err == nil {
+				if indexed, err2 := cis.HasIndex(); err2 != nil || indexed == false {
+					// Read the stream sequentially (the file offset is unchanged)
+					cis = nil
+				}
+			}
+		}
+	}
+
+	if cis == nil && err == nil {
+		cis, err = kio.NewReaderWithCtx(input, this.ctx)
+	}
 
 	if err != nil {
 		if err.(*kio.IOError) != nil {
-			fmt.Printf("%s\n", err.(*kio.IOError).Message())
+			log.Println(err.(*kio.IOError).Message(), true)
 			return err.(*kio.IOError).ErrorCode(), 0, err
 		}
 
-		fmt.Printf("Cannot create compressed stream: %v\n", err)
+		log.Println(fmt.Sprintf("Cannot create compressed stream: %v", err), true)
 		return kanzi.ERR_CREATE_DECOMPRESSOR, 0, err
 	}
 
@@ -638,6 +828,15 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		cis.AddListener(bl)
 	}
 
+	if hasFrom == true && from.(int) > 1 {
+		if index, err2 := cis.Index(); err2 == nil && from.(int) <= len(index) {
+			if _, err = cis.Seek(index[from.(int)-1].Position, io.SeekStart); err != nil {
+				log.Println(fmt.Sprintf("Cannot seek to block %d: %v", from.(int), err), true)
+				return kanzi.ERR_READ_FILE, 0, err
+			}
+		}
+	}
+
 	buffer := make([]byte, _DECOMP_DEFAULT_BUFFER_SIZE)
 	decoded := int64(0)
 	before := time.Now()
@@ -648,7 +847,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 
 		if decodedBlock, err = cis.Read(buffer); err != nil {
 			if ioerr, isIOErr := err.(*kio.IOError); isIOErr == true {
-				fmt.Printf("%s\n", ioerr.Message())
+				log.Println(ioerr.Message(), true)
 				return ioerr.ErrorCode(), uint64(decoded), err
 			}
 
@@ -656,7 +855,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 				// Ignore EOF (see comment in io.Copy:
 				// Because Copy is defined to read from src until EOF, it does not
 				// treat EOF from Read an an error to be reported)
-				fmt.Printf("An unexpected condition happened. Exiting ...\n%v\n", err)
+				log.Println(fmt.Sprintf("An unexpected condition happened. Exiting ...\n%v", err), true)
 				return kanzi.ERR_PROCESS_BLOCK, uint64(decoded), err
 			}
 		}
@@ -665,14 +864,15 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 			_, err := output.Write(buffer[0:decodedBlock])
 
 			if err != nil {
-				fmt.Printf("Failed to write decompressed block to file '%s': %v\n", outputName, err)
+				log.Println(fmt.Sprintf("Failed to write decompressed block to file '%s': %v", outputName, err), true)
 				return kanzi.ERR_WRITE_FILE, uint64(decoded), err
 			}
 
 			decoded += int64(decodedBlock)
 		}
 
-		if decodedBlock != len(buffer) {
+		// Short reads happen before the end of stream (EG. flushed blocks)
+		if decodedBlock == 0 {
 			break
 		}
 	}
@@ -689,7 +889,6 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 	// If the whole input stream has been decoded and the original data size is present,
 	// check that the output size matches the original data size.
 	_, hasTo := this.ctx["to"]
-	_, hasFrom := this.ctx["from"]
 
 	if checkOutputSize == true && hasTo == false && hasFrom == false {
 		if osz, prst := this.ctx["outputSize"]; prst == true {
@@ -697,7 +896,7 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 
 			if outputSize != 0 && decoded != outputSize {
 				errMsg := fmt.Sprintf("Corrupted bitstream: invalid output size (expected %d, got %d)", decoded, outputSize)
-				fmt.Println(errMsg)
+				log.Println(errMsg, true)
 				return kanzi.ERR_INVALID_FILE, uint64(decoded), errors.New(errMsg)
 			}
 		}
@@ -739,6 +938,18 @@ func (this *fileDecompressTask) call() (int, uint64, error) {
 		notifyBDListeners(this.listeners, evt)
 	}
 
+	if md := cis.Metadata(); md != nil && this.ctx["preserve"].(bool) == true && checkOutputSize == true {
+		// Close the output first, the times must be restored after the last write
+		output.Close()
+
+		if fi, err := os.Stat(outputName); err == nil && fi.Mode().IsRegular() == true {
+			if err := applyFileMetadata(outputName, md); err != nil {
+				msg := fmt.Sprintf("Warning: cannot restore metadata of '%s': %v", outputName, err)
+				log.Println(msg, verbosity > 0)
+			}
+		}
+	}
+
 	if removeSource == true {
 		// Close input prior to deletion
 		// Close will return an error if it has already been called.
@@ -0,0 +1,158 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// loadDictionary reads a dictionary file created with the --train option
+func loadDictionary(name string) (*kio.Dictionary, error) {
+	f, err := os.Open(name)
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot open dictionary file '%s': %v", name, err)
+	}
+
+	defer f.Close()
+	dict, err := kio.ReadDictionary(f)
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load dictionary file '%s': %v", name, err)
+	}
+
+	return dict, nil
+}
+
+// trainDictionary builds a dictionary from the sample files provided as input
+// and saves it to the output file.
+func trainDictionary(argsMap map[string]any) int {
+	verbosity := argsMap["verbosity"].(uint)
+	inputName := argsMap["inputName"].(string)
+	outputName := argsMap["outputName"].(string)
+	dictSize := uint(0)
+	overwrite := false
+	noDotFiles := false
+	noLinks := false
+
+	if size, prst := argsMap["dictSize"]; prst == true {
+		dictSize = size.(uint)
+	}
+
+	if force, prst := argsMap["overwrite"]; prst == true {
+		overwrite = force.(bool)
+	}
+
+	if noDot, prst := argsMap["noDotFiles"]; prst == true {
+		noDotFiles = noDot.(bool)
+	}
+
+	if noLink, prst := argsMap["noLinks"]; prst == true {
+		noLinks = noLink.(bool)
+	}
+
+	if len(inputName) == 0 || strings.EqualFold(inputName, _COMP_STDIN) {
+		fmt.Println("Missing sample files: provide a file or directory as input")
+		return kanzi.ERR_MISSING_PARAM
+	}
+
+	if len(outputName) == 0 || strings.EqualFold(outputName, _COMP_STDOUT) || strings.EqualFold(outputName, _COMP_NONE) {
+		fmt.Println("Missing dictionary file: provide a file name as output")
+		return kanzi.ERR_MISSING_PARAM
+	}
+
+	before := time.Now()
+	suffix := string([]byte{os.PathSeparator, '.'})
+	target := inputName
+	isRecursive := len(target) <= 2 || target[len(target)-len(suffix):] != suffix
+
+	if isRecursive == false {
+		target = target[0 : len(target)-1]
+	}
+
+	files, err := internal.CreateFileList(target, make([]internal.FileData, 0, 256), isRecursive, noLinks, noDotFiles)
+
+	if err != nil {
+		fmt.Printf("Cannot access sample files: %v\n", err)
+		return kanzi.ERR_OPEN_FILE
+	}
+
+	if len(files) == 0 {
+		fmt.Println("Cannot find any sample file")
+		return kanzi.ERR_OPEN_FILE
+	}
+
+	samples := make([][]byte, 0, len(files))
+	total := 0
+
+	for _, f := range files {
+		buf, err := os.ReadFile(f.FullPath)
+
+		if err != nil {
+			fmt.Printf("Cannot read sample file '%s': %v\n", f.FullPath, err)
+			return kanzi.ERR_READ_FILE
+		}
+
+		samples = append(samples, buf)
+		total += len(buf)
+	}
+
+	log.Println(fmt.Sprintf("%d sample file(s), %d byte(s)", len(files), total), verbosity > 0)
+
+	dict, err := kio.TrainDictionary(samples, int(dictSize))
+
+	if err != nil {
+		fmt.Printf("Failed to train dictionary: %v\n", err)
+		return kanzi.ERR_DICTIONARY
+	}
+
+	if overwrite == false {
+		if _, err := os.Stat(outputName); err == nil {
+			fmt.Printf("File '%s' exists and the 'force' command line option has not been provided\n", outputName)
+			return kanzi.ERR_OVERWRITE_FILE
+		}
+	}
+
+	output, err := os.Create(outputName)
+
+	if err != nil {
+		fmt.Printf("Cannot create dictionary file '%s': %v\n", outputName, err)
+		return kanzi.ERR_CREATE_FILE
+	}
+
+	if _, err = dict.WriteTo(output); err != nil {
+		output.Close()
+		fmt.Printf("Failed to write dictionary file '%s': %v\n", outputName, err)
+		return kanzi.ERR_WRITE_FILE
+	}
+
+	if err = output.Close(); err != nil {
+		fmt.Printf("Failed to close dictionary file '%s': %v\n", outputName, err)
+		return kanzi.ERR_WRITE_FILE
+	}
+
+	msg := fmt.Sprintf("Dictionary: %d bytes (ID %08x) written to '%s' in %d ms", len(dict.Bytes()),
+		dict.ID(), outputName, time.Since(before).Milliseconds())
+	log.Println(msg, verbosity > 0)
+	return 0
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// readFileMetadata collects the metadata of a file to store in the stream
+// header (--preserve option). The access time, owner and extended attributes
+// are platform dependent (see readPlatformMetadata).
+func readFileMetadata(name string) (*kio.FileMetadata, error) {
+	fi, err := os.Stat(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	md := &kio.FileMetadata{
+		Mode:    fi.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky),
+		ModTime: fi.ModTime(),
+		UID:     -1,
+		GID:     -1,
+	}
+
+	if err = readPlatformMetadata(name, fi, md); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// applyFileMetadata restores the metadata of a decompressed file. The owner is
+// only restored when running as root. The times are restored last. A failure
+// does not prevent restoring the other attributes, all the failures are returned.
+func applyFileMetadata(name string, md *kio.FileMetadata) error {
+	// Before chmod: changing the owner may clear the setuid and setgid bits
+	errPlatform := applyPlatformMetadata(name, md)
+	errMode := os.Chmod(name, md.Mode)
+	atime := md.AccessTime
+
+	if atime.IsZero() == true {
+		atime = md.ModTime
+	}
+
+	return errors.Join(errPlatform, errMode, os.Chtimes(name, atime, md.ModTime))
+}
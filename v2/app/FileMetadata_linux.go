@@ -0,0 +1,115 @@
+//go:build linux
+
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// readPlatformMetadata adds the access time, owner and extended attributes
+func readPlatformMetadata(name string, fi os.FileInfo, md *kio.FileMetadata) error {
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok == true {
+		md.AccessTime = time.Unix(st.Atim.Unix())
+		md.UID = int(st.Uid)
+		md.GID = int(st.Gid)
+	}
+
+	xattrs, err := readXattrs(name)
+
+	if err != nil {
+		return fmt.Errorf("Cannot read extended attributes: %v", err)
+	}
+
+	md.Xattrs = xattrs
+	return nil
+}
+
+func readXattrs(name string) (map[string][]byte, error) {
+	size, err := syscall.Listxattr(name, nil)
+
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSUP) == true {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if size == 0 {
+		return nil, nil
+	}
+
+	list := make([]byte, size)
+
+	if size, err = syscall.Listxattr(name, list); err != nil {
+		return nil, err
+	}
+
+	res := make(map[string][]byte)
+
+	for _, attr := range bytes.Split(list[0:size], []byte{0}) {
+		if len(attr) == 0 {
+			continue
+		}
+
+		sz, err := syscall.Getxattr(name, string(attr), nil)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, sz)
+
+		if sz > 0 {
+			if sz, err = syscall.Getxattr(name, string(attr), value); err != nil {
+				return nil, err
+			}
+		}
+
+		res[string(attr)] = value[0:sz]
+	}
+
+	return res, nil
+}
+
+// applyPlatformMetadata restores the owner (as root) and the extended attributes.
+// All the attributes are attempted, the failures are returned together.
+func applyPlatformMetadata(name string, md *kio.FileMetadata) error {
+	var errs []error
+
+	if md.UID >= 0 && md.GID >= 0 && os.Geteuid() == 0 {
+		if err := os.Chown(name, md.UID, md.GID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for attr, value := range md.Xattrs {
+		if err := syscall.Setxattr(name, attr, value, 0); err != nil {
+			errs = append(errs, fmt.Errorf("Cannot set extended attribute '%s': %v", attr, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
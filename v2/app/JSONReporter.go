@@ -0,0 +1,185 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// An implementation of Listener writing one JSON object per line for each
+// event (report option of the BlockCompressor/BlockDecompressor). A summary
+// record is written at the end of each file.
+
+// fileSummary is the JSON record written at the end of each file
+type fileSummary struct {
+	File       string  `json:"file"`
+	Type       string  `json:"type"` // always FILE_SUMMARY
+	Output     string  `json:"output"`
+	Time       int64   `json:"time"`   // ms since the epoch
+	Status     string  `json:"status"` // OK or FAILED
+	Code       int     `json:"code"`   // error code (0 if OK)
+	Error      string  `json:"error,omitempty"`
+	InputSize  uint64  `json:"inputSize"`
+	OutputSize uint64  `json:"outputSize"`
+	Ratio      float64 `json:"ratio"` // compressed size / original size (0 if not available)
+	Duration   int64   `json:"duration"`
+	Entropy    string  `json:"entropy,omitempty"`
+	Transform  string  `json:"transform,omitempty"`
+	Checksum   int     `json:"checksum"` // size of the block checksums in bits (0, 32 or 64)
+}
+
+// JSONReporter writes the events of the files (de)compressed as JSON Lines
+type JSONReporter struct {
+	printer    *Printer
+	infoType   uint
+	level      uint
+	file       string // name of the file (per file reporter only)
+	output     string
+	start      time.Time
+	header     *kanzi.HeaderInfo
+	compressed int64
+}
+
+// NewJSONReporter creates a new instance of JSONReporter. All the events and
+// summaries are written if the level is greater than 2. Otherwise, the block
+// events are dropped.
+func NewJSONReporter(level, infoType uint, writer io.Writer) (*JSONReporter, error) {
+	if writer == nil {
+		return nil, errors.New("invalid null writer parameter")
+	}
+
+	this := &JSONReporter{}
+	this.infoType = infoType & 1
+	this.level = level
+	this.printer = &Printer{os: bufio.NewWriter(writer)}
+	return this, nil
+}
+
+// forFile returns a reporter sharing the output of this reporter that adds
+// the name of the file to the events
+func (this *JSONReporter) forFile(inputName, outputName string) *JSONReporter {
+	return &JSONReporter{
+		printer:  this.printer,
+		infoType: this.infoType,
+		level:    this.level,
+		file:     inputName,
+		output:   outputName,
+		start:    time.Now(),
+	}
+}
+
+// ProcessEvent receives an event and writes a JSON record to the internal writer
+func (this *JSONReporter) ProcessEvent(evt *kanzi.Event) {
+	switch evt.Type() {
+	case kanzi.EVT_AFTER_HEADER_DECODING:
+		this.header = evt.Header()
+
+	case kanzi.EVT_DECOMPRESSION_END:
+		this.compressed = evt.Size()
+
+	case kanzi.EVT_COMPRESSION_START, kanzi.EVT_DECOMPRESSION_START, kanzi.EVT_COMPRESSION_END:
+
+	default:
+		if this.level < 3 {
+			return
+		}
+	}
+
+	buf, err := json.Marshal(evt)
+
+	if err != nil {
+		return
+	}
+
+	if len(this.file) > 0 {
+		// Insert the file name as first field
+		name, _ := json.Marshal(this.file)
+		buf = append(append(append([]byte(`{"file":`), name...), ','), buf[1:]...)
+	}
+
+	this.printer.Println(string(buf), true)
+}
+
+// reportFile writes the summary of the file processed by this reporter.
+// The sizes are the ones returned by the file task: read and written
+// bytes for compression and decoded bytes for decompression.
+func (this *JSONReporter) reportFile(code int, read, written uint64, err error, ctx map[string]any) {
+	now := time.Now()
+	res := fileSummary{
+		File:     this.file,
+		Type:     "FILE_SUMMARY",
+		Output:   this.output,
+		Time:     now.UnixNano() / 1000000,
+		Status:   "OK",
+		Code:     code,
+		Duration: now.Sub(this.start).Milliseconds(),
+	}
+
+	if code != 0 {
+		res.Status = "FAILED"
+		res.Error = errorCodeName(code)
+
+		if err != nil {
+			var ioErr *kio.IOError
+
+			if errors.As(err, &ioErr) == true {
+				res.Error += ": " + ioErr.Message()
+			} else {
+				res.Error += ": " + err.Error()
+			}
+		}
+	}
+
+	if this.infoType == ENCODING {
+		res.InputSize = read
+		res.OutputSize = written
+
+		if read > 0 {
+			res.Ratio = float64(written) / float64(read)
+		}
+
+		res.Entropy, _ = ctx["entropy"].(string)
+		res.Transform, _ = ctx["transform"].(string)
+
+		if ck, prst := ctx["checksum"].(uint); prst == true {
+			res.Checksum = int(ck)
+		}
+	} else {
+		res.InputSize = uint64(this.compressed)
+		res.OutputSize = read
+
+		if read > 0 && this.compressed > 0 {
+			res.Ratio = float64(this.compressed) / float64(read)
+		}
+
+		if this.header != nil {
+			res.Entropy = this.header.Entropy
+			res.Transform = this.header.Transform
+			res.Checksum = this.header.Checksum
+		}
+	}
+
+	if buf, err := json.Marshal(res); err == nil {
+		this.printer.Println(string(buf), true)
+	}
+}
@@ -17,6 +17,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"os"
 	"runtime"
@@ -26,6 +27,7 @@ import (
 	"sync"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/entropy"
 )
 
 const (
@@ -45,7 +47,7 @@ const (
 	_KANZI_VERSION   = "2.3.0"
 	_APP_HEADER      = "Kanzi " + _KANZI_VERSION + " (c) Frederic Langlet"
 	_APP_SUB_HEADER  = "Fast lossless data compressor."
-	_APP_USAGE       = "Usage: Kanzi [-c|-d] [flags and files in any order]"
+	_APP_USAGE       = "Usage: Kanzi [-c|-d|-a|-x|--list|--test|--info|--bench|--zip] [flags and files in any order]"
 	_ARG_INPUT       = "--input="
 	_ARG_OUTPUT      = "--output="
 	_ARG_LEVEL       = "--level="
@@ -62,6 +64,25 @@ const (
 	_ARG_FORCE       = "--force"
 	_ARG_SKIP        = "--skip"
 	_ARG_CHECKSUM    = "--checksum="
+	_ARG_INDEX       = "--index"
+	_ARG_CONTENT_CK  = "--content-checksum"
+	_ARG_AUTO        = "--auto"
+	_ARG_AUTO_BUDGET = "--auto-budget="
+	_ARG_TRAIN       = "--train"
+	_ARG_DICTIONARY  = "--dictionary="
+	_ARG_DICT_SIZE   = "--dict-size="
+	_ARG_PASSWORD    = "--password-file="
+	_ARG_MEMLIMIT    = "--memlimit="
+	_ARG_STRICT      = "--strict"
+	_ARG_ARCHIVE     = "--archive"
+	_ARG_EXTRACT     = "--extract"
+	_ARG_LIST        = "--list"
+	_ARG_INFO        = "--info"
+	_ARG_TEST        = "--test"
+	_ARG_BENCH       = "--bench"
+	_ARG_REPORT      = "--report="
+	_ARG_ZIP         = "--zip="
+	_ARG_TAR         = "--tar"
 )
 
 var (
@@ -94,6 +115,14 @@ func main() {
 		status = compress(argsMap)
 	} else if mode == "d" {
 		status = decompress(argsMap)
+	} else if mode == "t" {
+		status = trainDictionary(argsMap)
+	} else if mode == "i" {
+		status = printStreamInfo(argsMap)
+	} else if mode == "b" {
+		status = runBenchmark(argsMap)
+	} else if mode == "z" {
+		status = convertZip(argsMap)
 	} else {
 		println("Missing arguments: try --help or -h")
 	}
@@ -119,7 +148,8 @@ func compress(argsMap map[string]any) int {
 
 	if err != nil {
 		fmt.Printf("Failed to create block compressor: %v\n", err)
-		return kanzi.ERR_CREATE_COMPRESSOR
+		code = kanzi.ERR_CREATE_COMPRESSOR
+		return code
 	}
 
 	if len(bc.CPUProf()) != 0 {
@@ -161,7 +191,8 @@ func decompress(argsMap map[string]any) int {
 
 	if err != nil {
 		fmt.Printf("Failed to create block decompressor: %v\n", err)
-		return kanzi.ERR_CREATE_DECOMPRESSOR
+		code = kanzi.ERR_CREATE_DECOMPRESSOR
+		return code
 	}
 
 	if len(bd.CPUProf()) != 0 {
@@ -191,12 +222,32 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 	overwrite := false
 	checksum := 0
 	skip := false
+	blockIndex := false
+	contentChecksum := false
+	autoLevels := ""
+	autoBudget := -1
+	dictName := ""
+	dictSize := -1
+	passwordFile := ""
+	memLimit := -1
+	strict := false
+	archive := false
+	extract := false
+	list := false
+	tar := false
+	infoFormat := ""
+	reportFormat := ""
+	reportLevel := 0
+	zipMethod := ""
+	testOnly := false
+	bench := false
 	fileReorder := true
 	noDotFiles := false
 	noLinks := false
 	from := -1
 	to := -1
 	remove := false
+	preserve := false
 	inputName := ""
 	outputName := ""
 	codec := ""
@@ -238,12 +289,98 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 
 		// Extract verbosity, output and mode first
+		if arg == "-a" || arg == _ARG_ARCHIVE {
+			if mode == "d" || mode == "t" {
+				fmt.Println("Both archive and decompression (or training) options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			mode = "c"
+			archive = true
+			continue
+		}
+
+		if arg == _ARG_EXTRACT || arg == _ARG_LIST {
+			if mode == "c" || mode == "t" {
+				fmt.Println("Both archive extraction and compression (or training) options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			mode = "d"
+			extract = extract || arg == _ARG_EXTRACT
+			list = list || arg == _ARG_LIST
+			continue
+		}
+
+		if arg == _ARG_TEST {
+			if mode == "c" || mode == "t" {
+				fmt.Println("Both test and compression (or training) options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			mode = "d"
+			testOnly = true
+			continue
+		}
+
+		if arg == _ARG_BENCH {
+			bench = true
+			continue
+		}
+
+		if arg == _ARG_TAR {
+			tar = true
+			continue
+		}
+
+		if arg == _ARG_INFO || strings.HasPrefix(arg, _ARG_INFO+"=") {
+			infoFormat = "text"
+
+			if arg != _ARG_INFO {
+				infoFormat = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(arg, _ARG_INFO+"=")))
+			}
+
+			if infoFormat != "text" && infoFormat != "json" {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "info format", infoFormat))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_REPORT) {
+			reportFormat = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(arg, _ARG_REPORT)))
+
+			if reportFormat != "json" {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "report format", reportFormat))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_ZIP) {
+			zipMethod = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(arg, _ARG_ZIP)))
+
+			if zipMethod != "kanzi" && zipMethod != "deflate" {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "zip method", zipMethod))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			continue
+		}
+
 		if arg == "-c" || arg == _ARG_COMPRESS {
 			if mode == "d" {
 				fmt.Println("Both compression and decompression options were provided.")
 				return kanzi.ERR_INVALID_PARAM
 			}
 
+			if mode == "t" {
+				fmt.Println("Both compression and training options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
 			mode = "c"
 			continue
 		}
@@ -254,10 +391,25 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 				return kanzi.ERR_INVALID_PARAM
 			}
 
+			if mode == "t" {
+				fmt.Println("Both decompression and training options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
 			mode = "d"
 			continue
 		}
 
+		if arg == _ARG_TRAIN {
+			if mode == "c" || mode == "d" {
+				fmt.Println("Both training and (de)compression options were provided.")
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			mode = "t"
+			continue
+		}
+
 		if ctx == _ARG_IDX_VERBOSE || strings.HasPrefix(arg, _ARG_VERBOSE) {
 			if verboseLevel != "" {
 				log.Println(fmt.Sprintf(warningDupOpt, "verbose", verboseLevel), verbose > 0)
@@ -305,18 +457,103 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		ctx = -1
 	}
 
+	if extract == true {
+		if mode == "c" {
+			extract = false
+		} else if mode == "t" {
+			fmt.Println("Both archive extraction and training options were provided.")
+			return kanzi.ERR_INVALID_PARAM
+		} else {
+			mode = "d"
+		}
+	}
+
+	if extract == true && list == true {
+		fmt.Println("Both archive extraction and list options were provided.")
+		return kanzi.ERR_INVALID_PARAM
+	}
+
+	if testOnly == true && (extract == true || list == true) {
+		fmt.Println("Both test and archive extraction (or list) options were provided.")
+		return kanzi.ERR_INVALID_PARAM
+	}
+
+	if tar == true {
+		if archive == true || extract == true || list == true || testOnly == true {
+			fmt.Println("Both tar and archive (extraction, list or test) options were provided.")
+			return kanzi.ERR_INVALID_PARAM
+		}
+
+		if mode != "c" && mode != "d" {
+			fmt.Println("Tar mode: provide the compression or decompression option.")
+			return kanzi.ERR_INVALID_PARAM
+		}
+	}
+
+	if len(infoFormat) > 0 {
+		if mode != " " {
+			fmt.Println("Both info and (de)compression or training options were provided.")
+			return kanzi.ERR_INVALID_PARAM
+		}
+
+		mode = "i"
+
+		// The output is the stream information only
+		if infoFormat == "json" {
+			verbose = 0
+		}
+	}
+
+	if bench == true {
+		if mode != " " {
+			fmt.Println("Both benchmark and (de)compression, training or info options were provided.")
+			return kanzi.ERR_INVALID_PARAM
+		}
+
+		mode = "b"
+	}
+
+	if len(zipMethod) > 0 {
+		if mode != " " {
+			fmt.Println("Both zip conversion and (de)compression, training, info or benchmark options were provided.")
+			return kanzi.ERR_INVALID_PARAM
+		}
+
+		mode = "z"
+	}
+
 	if showHelp == true || len(args) == 1 {
 		printHelp(mode, true)
 		return 0
 	}
 
-	// Overwrite verbosity if the output goes to stdout
-	if (len(inputName) == 0 && len(outputName) == 0) || strings.EqualFold(outputName, "STDOUT") == true {
-		verbose = 0
+	if len(reportFormat) > 0 {
+		if (mode != "c" && mode != "d") || archive == true || extract == true || list == true || testOnly == true || tar == true {
+			log.Println("Warning: ignoring option [report]. Only applicable in compress and decompress modes.", verbose > 0)
+			reportFormat = ""
+		} else {
+			// The output is the report only, the verbosity selects the events
+			reportLevel = verbose
+			verbose = 0
+		}
+	}
+
+	// The messages go to stderr if the output goes to stdout (EG. pipeline)
+	if (mode == "c" || mode == "d") && testOnly == false && list == false && extract == false {
+		isStdIn := len(inputName) == 0 || strings.EqualFold(inputName, "STDIN") == true
+
+		if strings.EqualFold(outputName, "STDOUT") == true || (isStdIn == true && len(outputName) == 0) {
+			log = Printer{os: bufio.NewWriter(os.Stderr)}
+		}
 	}
 
 	log.Println("\n"+_APP_HEADER+"\n", verbose >= 1)
 	log.Println(_APP_SUB_HEADER, verbose > 1)
+
+	if testOnly == true && len(outputName) > 0 {
+		log.Println("Warning: ignoring option [output]. Not applicable in test mode.", verbose > 0)
+	}
+
 	inputName = ""
 	outputName = ""
 	ctx = -1
@@ -328,7 +565,10 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 
 		arg = strings.TrimSpace(arg)
 
-		if arg == "-c" || arg == "-d" || arg == _ARG_COMPRESS || arg == _ARG_DECOMPRESS {
+		if arg == "-c" || arg == "-d" || arg == _ARG_COMPRESS || arg == _ARG_DECOMPRESS || arg == _ARG_TRAIN ||
+			arg == "-a" || arg == _ARG_ARCHIVE || arg == _ARG_EXTRACT || arg == _ARG_LIST ||
+			arg == _ARG_INFO || strings.HasPrefix(arg, _ARG_INFO+"=") || arg == _ARG_TEST || arg == _ARG_BENCH ||
+			strings.HasPrefix(arg, _ARG_REPORT) || strings.HasPrefix(arg, _ARG_ZIP) || arg == _ARG_TAR {
 			if ctx != -1 {
 				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
 			}
@@ -357,6 +597,229 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 			continue
 		}
 
+		if arg == _ARG_INDEX {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, "index"), verbose > 0)
+				continue
+			}
+
+			blockIndex = true
+			continue
+		}
+
+		if arg == _ARG_STRICT {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "d" {
+				log.Println(fmt.Sprintf(warningDecompressOpt, "strict"), verbose > 0)
+				continue
+			}
+
+			strict = true
+			continue
+		}
+
+		if arg == _ARG_CONTENT_CK {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, "content-checksum"), verbose > 0)
+				continue
+			}
+
+			contentChecksum = true
+			continue
+		}
+
+		if arg == _ARG_AUTO || strings.HasPrefix(arg, _ARG_AUTO+"=") {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, "auto"), verbose > 0)
+				continue
+			}
+
+			str := "2,5,8"
+
+			if arg != _ARG_AUTO {
+				str = strings.TrimSpace(strings.TrimPrefix(arg, _ARG_AUTO+"="))
+			}
+
+			if len(autoLevels) != 0 {
+				log.Println(fmt.Sprintf(warningDupOpt, "auto", str), verbose > 0)
+				continue
+			}
+
+			autoLevels = str
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_AUTO_BUDGET) {
+			ctx = -1
+
+			if mode != "c" {
+				log.Println(fmt.Sprintf(warningCompressOpt, "auto-budget"), verbose > 0)
+				continue
+			}
+
+			str := strings.TrimSpace(strings.TrimPrefix(arg, _ARG_AUTO_BUDGET))
+
+			if autoBudget != -1 {
+				log.Println(fmt.Sprintf(warningDupOpt, "auto-budget", str), verbose > 0)
+				continue
+			}
+
+			var err error
+
+			if autoBudget, err = strconv.Atoi(str); err != nil || autoBudget < 0 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "auto budget", str))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_DICTIONARY) {
+			ctx = -1
+
+			if mode != "c" && mode != "d" {
+				log.Println("Warning: ignoring option [dictionary]. Only applicable in compress and decompress modes.", verbose > 0)
+				continue
+			}
+
+			str := strings.TrimSpace(strings.TrimPrefix(arg, _ARG_DICTIONARY))
+
+			if len(dictName) != 0 {
+				log.Println(fmt.Sprintf(warningDupOpt, "dictionary", str), verbose > 0)
+				continue
+			}
+
+			if len(str) == 0 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "dictionary", "[]"))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			dictName = str
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_PASSWORD) {
+			ctx = -1
+
+			if mode != "c" && mode != "d" && mode != "i" {
+				log.Println("Warning: ignoring option [password-file]. Only applicable in compress, decompress and info modes.", verbose > 0)
+				continue
+			}
+
+			str := strings.TrimSpace(strings.TrimPrefix(arg, _ARG_PASSWORD))
+
+			if len(passwordFile) != 0 {
+				log.Println(fmt.Sprintf(warningDupOpt, "password-file", str), verbose > 0)
+				continue
+			}
+
+			if len(str) == 0 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "password file", "[]"))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			passwordFile = str
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_MEMLIMIT) {
+			ctx = -1
+
+			if mode != "c" && mode != "d" {
+				log.Println("Warning: ignoring option [memlimit]. Only applicable in compress and decompress modes.", verbose > 0)
+				continue
+			}
+
+			str := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(arg, _ARG_MEMLIMIT)))
+
+			if memLimit != -1 {
+				log.Println(fmt.Sprintf(warningDupOpt, "memlimit", str), verbose > 0)
+				continue
+			}
+
+			scale := 1
+
+			if strings.HasSuffix(str, "K") {
+				str = str[0 : len(str)-1]
+				scale = 1024
+			} else if strings.HasSuffix(str, "M") {
+				str = str[0 : len(str)-1]
+				scale = 1024 * 1024
+			} else if strings.HasSuffix(str, "G") {
+				str = str[0 : len(str)-1]
+				scale = 1024 * 1024 * 1024
+			}
+
+			var err error
+
+			if memLimit, err = strconv.Atoi(str); err != nil || memLimit <= 0 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "memory limit", str))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			memLimit *= scale
+			continue
+		}
+
+		if strings.HasPrefix(arg, _ARG_DICT_SIZE) {
+			ctx = -1
+
+			if mode != "t" {
+				log.Println("Warning: ignoring option [dict-size]. Only applicable in train mode.", verbose > 0)
+				continue
+			}
+
+			str := strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(arg, _ARG_DICT_SIZE)))
+
+			if dictSize != -1 {
+				log.Println(fmt.Sprintf(warningDupOpt, "dict-size", str), verbose > 0)
+				continue
+			}
+
+			scale := 1
+
+			if strings.HasSuffix(str, "K") {
+				str = str[0 : len(str)-1]
+				scale = 1024
+			} else if strings.HasSuffix(str, "M") {
+				str = str[0 : len(str)-1]
+				scale = 1024 * 1024
+			}
+
+			var err error
+
+			if dictSize, err = strconv.Atoi(str); err != nil || dictSize <= 0 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "dictionary size", str))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			dictSize *= scale
+			continue
+		}
+
 		if arg == "-x" || arg == "-x32" || arg == "-x64" {
 			if mode != "c" {
 				log.Println(fmt.Sprintf(warningCompressOpt, "checksum"), verbose > 0)
@@ -384,6 +847,22 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 			continue
 		}
 
+		if arg == "--preserve" {
+			if ctx != -1 {
+				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
+			}
+
+			ctx = -1
+
+			if mode != "c" && mode != "d" {
+				log.Println("Warning: ignoring option [preserve]. Only applicable in compress and decompress modes.", verbose > 0)
+				continue
+			}
+
+			preserve = true
+			continue
+		}
+
 		if arg == "--no-file-reorder" {
 			if ctx != -1 {
 				log.Println(fmt.Sprintf(warningNoValOpt, _CMD_LINE_ARGS[ctx]), verbose > 0)
@@ -475,7 +954,7 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 
 		if ctx == _ARG_IDX_ENTROPY || strings.HasPrefix(arg, _ARG_ENTROPY) {
-			if mode != "c" {
+			if mode != "c" && mode != "b" {
 				log.Println(fmt.Sprintf(warningCompressOpt, "entropy"), verbose > 0)
 				ctx = -1
 				continue
@@ -507,7 +986,7 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 
 		if ctx == _ARG_IDX_TRANSFORM || strings.HasPrefix(arg, _ARG_TRANSFORM) {
-			if mode != "c" {
+			if mode != "c" && mode != "b" {
 				log.Println(fmt.Sprintf(warningCompressOpt, "transform"), verbose > 0)
 				ctx = -1
 				continue
@@ -547,7 +1026,7 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 
 		if ctx == _ARG_IDX_LEVEL || strings.HasPrefix(arg, _ARG_LEVEL) {
-			if mode != "c" {
+			if mode != "c" && mode != "z" {
 				log.Println(fmt.Sprintf(warningCompressOpt, "level"), verbose > 0)
 				ctx = -1
 				continue
@@ -629,7 +1108,7 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 
 		if ctx == _ARG_IDX_BLOCK || strings.HasPrefix(arg, _ARG_BLOCK) {
-			if mode != "c" {
+			if mode != "c" && mode != "b" && mode != "z" {
 				log.Println(fmt.Sprintf(warningCompressOpt, "block size"), verbose > 0)
 				ctx = -1
 				continue
@@ -795,10 +1274,86 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		}
 	}
 
+	if len(autoLevels) > 0 {
+		if len(codec) != 0 || len(transform) != 0 || level >= 0 {
+			log.Println("Warning: the 'auto' option overrides the entropy codec and transform", verbose > 0)
+		}
+
+		candidates := make([]string, 0)
+
+		for _, str := range strings.Split(autoLevels, ",") {
+			lvl, err := strconv.Atoi(strings.TrimSpace(str))
+
+			if err != nil || lvl < 0 || lvl > 9 {
+				fmt.Println(fmt.Sprintf(warningInvalidOpt, "auto levels", autoLevels))
+				return kanzi.ERR_INVALID_PARAM
+			}
+
+			candidates = append(candidates, getTransformAndCodec(lvl))
+		}
+
+		argsMap["autoCandidates"] = strings.Join(candidates, ",")
+
+		if autoBudget >= 0 {
+			argsMap["autoBudget"] = uint(autoBudget)
+		}
+	} else if autoBudget >= 0 {
+		log.Println("Warning: ignoring option [auto-budget] without the 'auto' option", verbose > 0)
+	}
+
 	if blockSize != -1 {
 		argsMap["blockSize"] = uint(blockSize)
 	}
 
+	if len(dictName) > 0 {
+		argsMap["dictionary"] = dictName
+	}
+
+	if dictSize > 0 {
+		argsMap["dictSize"] = uint(dictSize)
+	}
+
+	if len(passwordFile) > 0 {
+		argsMap["passwordFile"] = passwordFile
+	}
+
+	if memLimit > 0 {
+		argsMap["maxMemory"] = uint64(memLimit)
+	}
+
+	if strict == true {
+		argsMap["strict"] = true
+	}
+
+	if archive == true || extract == true {
+		argsMap["archive"] = true
+	}
+
+	if list == true {
+		argsMap["list"] = true
+	}
+
+	if tar == true {
+		argsMap["tar"] = true
+	}
+
+	if testOnly == true {
+		argsMap["test"] = true
+	}
+
+	if len(infoFormat) > 0 {
+		argsMap["infoFormat"] = infoFormat
+	}
+
+	if len(zipMethod) > 0 {
+		argsMap["zipMethod"] = zipMethod
+	}
+
+	if len(reportFormat) > 0 {
+		argsMap["report"] = reportFormat
+		argsMap["reportLevel"] = uint(reportLevel)
+	}
+
 	if autoBlockSize == true {
 		argsMap["autoBlock"] = true
 	}
@@ -812,7 +1367,7 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		argsMap["overwrite"] = true
 	}
 
-	if mode == "c" && level != -1 {
+	if (mode == "c" || mode == "z") && level != -1 {
 		argsMap["level"] = level
 	}
 
@@ -832,10 +1387,22 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 		argsMap["skipBlocks"] = true
 	}
 
+	if blockIndex == true {
+		argsMap["blockIndex"] = true
+	}
+
+	if contentChecksum == true {
+		argsMap["contentChecksum"] = true
+	}
+
 	if remove == true {
 		argsMap["remove"] = true
 	}
 
+	if preserve == true {
+		argsMap["preserve"] = true
+	}
+
 	if fileReorder == false {
 		argsMap["fileReorder"] = false
 	}
@@ -867,6 +1434,25 @@ func processCommandLine(args []string, argsMap map[string]any) int {
 	return 0
 }
 
+// readPassword returns the first line of the provided file
+func readPassword(name string) ([]byte, error) {
+	buf, err := os.ReadFile(name)
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot read password file '%s': %v", name, err)
+	}
+
+	if idx := bytes.IndexAny(buf, "\r\n"); idx >= 0 {
+		buf = buf[0:idx]
+	}
+
+	if len(buf) == 0 {
+		return nil, fmt.Errorf("Invalid empty password in file '%s'", name)
+	}
+
+	return buf, nil
+}
+
 func printHelp(mode string, showHeader bool) {
 	if showHeader == true {
 		log.Println("\n"+_APP_HEADER+"\n", true)
@@ -881,13 +1467,140 @@ func printHelp(mode string, showHeader bool) {
 	log.Println("   -h, --help", true)
 	log.Println("        Display this message\n", true)
 
-	if mode != "c" && mode != "d" {
+	if mode != "c" && mode != "d" && mode != "t" {
 		log.Println("   -c, --compress", true)
 		log.Println("        Compress mode", true)
 		log.Println("", true)
 		log.Println("   -d, --decompress", true)
 		log.Println("        Decompress mode", true)
 		log.Println("", true)
+		log.Println("   --train", true)
+		log.Println("        Train a dictionary from the sample files provided as input", true)
+		log.Println("        and save it to the output file.", true)
+		log.Println("", true)
+		log.Println("   -a, --archive", true)
+		log.Println("        Archive mode: pack all the input files in one compressed file.", true)
+		log.Println("", true)
+		log.Println("   --extract", true)
+		log.Println("        Extract the files of an archive.", true)
+		log.Println("", true)
+		log.Println("   --list", true)
+		log.Println("        List the files of an archive.", true)
+		log.Println("", true)
+		log.Println("   --tar", true)
+		log.Println("        With -c or -d: pack the input files in a compressed tar stream", true)
+		log.Println("        or extract the files of a compressed tar stream.", true)
+		log.Println("", true)
+		log.Println("   --info[=text|json]", true)
+		log.Println("        Display the header and the block headers of compressed files", true)
+		log.Println("        without decompressing them.", true)
+		log.Println("", true)
+		log.Println("   --test", true)
+		log.Println("        Check the integrity of compressed files without writing any output.", true)
+		log.Println("", true)
+		log.Println("   --bench", true)
+		log.Println("        Benchmark combinations of transforms and entropy codecs in memory", true)
+		log.Println("        on the sample file(s) provided as input.", true)
+		log.Println("", true)
+		log.Println("   --zip=kanzi|deflate", true)
+		log.Println("        Convert a zip file to a zip file using the kanzi compression method", true)
+		log.Println("        (private method ID) or back to the deflate method.", true)
+		log.Println("", true)
+	}
+
+	if mode == "z" {
+		log.Println("   --zip=kanzi|deflate", true)
+		log.Println("        Recompress the entries of the input zip file with the kanzi method", true)
+		log.Println("        or the deflate method and write the output zip file (required).", true)
+		log.Println("        The names, times, modes and comments of the entries are kept and", true)
+		log.Println("        the directories are stored.\n", true)
+		log.Println("   -l, --level=<compression>", true)
+		log.Println("        Compression level [0..9] of the kanzi entries (default 3).\n", true)
+		log.Println("   -b, --block=<size>", true)
+		log.Println("        Size of blocks of the kanzi entries (default 4 MB).\n", true)
+		log.Println("   -j, --jobs=<jobs>", true)
+		log.Println("        Maximum number of jobs the program may start concurrently", true)
+		log.Println("        (default is all the cores).\n", true)
+		log.Println("   -f, --force", true)
+		log.Println("        Overwrite the output file if it already exists.\n", true)
+		log.Println("EG. Kanzi --zip=kanzi -i files.zip -o files.kz.zip -l 5\n", true)
+		log.Println("EG. Kanzi --zip=deflate -i files.kz.zip -o files.zip\n", true)
+	}
+
+	if mode == "b" {
+		log.Println("   -t, --transform=<codec>[,<codec>]", true)
+		log.Println("        Comma separated list of transforms to benchmark (EG. LZ,TEXT+BWT).", true)
+		log.Println("        Defaults to the transforms of the compression levels.\n", true)
+		log.Println("   -e, --entropy=<codec>[,<codec>]", true)
+		log.Println("        Comma separated list of entropy codecs to benchmark (EG. HUFFMAN,ANS0).", true)
+		log.Println("        Defaults to NONE,HUFFMAN,ANS0,FPAQ,CM.\n", true)
+		log.Println("   -b, --block=<size>", true)
+		log.Println("        Size of blocks (default 4 MB, max 1 GB, min 1 KB).\n", true)
+		log.Println("   -j, --jobs=<jobs>", true)
+		log.Println("        Maximum number of jobs the program may start concurrently", true)
+		log.Println("        (default is all the cores).\n", true)
+		log.Println("        All the combinations of transforms and entropy codecs are run. The", true)
+		log.Println("        compression ratio, compression and decompression speeds and peak", true)
+		log.Println("        heap memory are reported, followed by the Pareto optimal settings", true)
+		log.Println("        (ratio vs compression speed and ratio vs decompression speed).", true)
+		log.Println("", true)
+		log.Println("EG. Kanzi --bench -i sample.bin\n", true)
+		log.Println("EG. Kanzi --bench -i sampleDir -t LZ,TEXT+UTF+PACK+MM+LZX -e NONE,HUFFMAN,ANS0\n", true)
+	}
+
+	if mode == "i" {
+		log.Println("   --info[=text|json]", true)
+		log.Println("        Display the bitstream version, codecs, block size, checksum type,", true)
+		log.Println("        original size and, for each block, the compressed size, the skip", true)
+		log.Println("        flags of the transforms and the copy mode. The block headers of", true)
+		log.Println("        an encrypted stream require the password.\n", true)
+		log.Println("   --password-file=<fileName>", true)
+		log.Println("        File containing the password of an encrypted stream (first line).\n", true)
+	}
+
+	if mode == "d" {
+		log.Println("   --extract", true)
+		log.Println("        Extract the files of an archive created with the --archive option", true)
+		log.Println("        under the output folder (defaults to the current folder).\n", true)
+		log.Println("   --tar", true)
+		log.Println("        Extract the files of a compressed tar stream (EG. created with", true)
+		log.Println("        the --tar option) under the output folder (defaults to the", true)
+		log.Println("        current folder). Regular files, folders and links are restored.\n", true)
+		log.Println("   --list", true)
+		log.Println("        List the files of an archive created with the --archive option", true)
+		log.Println("        (path, size, permissions, modification time and link target).\n", true)
+		log.Println("   --test", true)
+		log.Println("        Decode the input files (or all the files of the input folder)", true)
+		log.Println("        without writing any output and print OK or FAILED for each file,", true)
+		log.Println("        with the first failing block and the error. All the files are", true)
+		log.Println("        tested. The exit code is 0 if all the files are valid, otherwise", true)
+		log.Println("        the error code of the first failing file.\n", true)
+	}
+
+	if mode == "t" {
+		log.Println("   --dict-size=<size>", true)
+		log.Println("        Maximum size of the dictionary (default 64 KiB, max 1 MiB).\n", true)
+	}
+
+	if mode == "c" || mode == "d" {
+		log.Println("   --password-file=<fileName>", true)
+
+		if mode == "c" {
+			log.Println("        Encrypt and authenticate the blocks (AES-256-GCM) with a key derived", true)
+			log.Println("        from the password stored in the file (first line).\n", true)
+		} else {
+			log.Println("        Decrypt the blocks with a key derived from the password stored", true)
+			log.Println("        in the file (first line).\n", true)
+		}
+
+		log.Println("   --dictionary=<dictName>", true)
+		log.Println("        Dictionary created with the --train option. It improves the", true)
+		log.Println("        compression of small inputs. The same dictionary must be", true)
+		log.Println("        provided to decompress.\n", true)
+		log.Println("   --memlimit=<size>", true)
+		log.Println("        Limit the memory used by the block buffers (EG. 512m, 2g).", true)
+		log.Println("        The number of jobs is reduced to fit in the limit. The processing", true)
+		log.Println("        fails if one block does not fit (EG. the block size of a stream).\n", true)
 	}
 
 	log.Println("   -i, --input=<inputName>", true)
@@ -902,18 +1615,27 @@ func printHelp(mode string, showHeader bool) {
 
 	if mode == "c" {
 		log.Println("        Optional name of the output file or directory (defaults to", true)
-		log.Println("        <inputName.knz>) or 'none' or 'stdout'. 'stdout' is not valid", true)
-		log.Println("        when the number of jobs is greater than 1.\n", true)
+		log.Println("        <inputName.knz>) or 'none' or 'stdout'. With 'stdout', the files", true)
+		log.Println("        are compressed one after the other and the messages go to stderr.\n", true)
 	} else if mode == "d" {
 		log.Println("        Optional name of the output file or directory (defaults to", true)
-		log.Println("        <inputName.bak>) or 'none' or 'stdout'. 'stdout' is not valid", true)
-		log.Println("        when the number of jobs is greater than 1.\n", true)
+		log.Println("        <inputName.bak>) or 'none' or 'stdout'. With 'stdout', the files", true)
+		log.Println("        are decompressed one after the other and the messages go to stderr.\n", true)
 
 	} else {
 		log.Println("        optional name of the output file or 'none' or 'stdout'.\n", true)
 	}
 
 	if mode == "c" {
+		log.Println("   -a, --archive", true)
+		log.Println("        Pack all the input files in one output file (defaults to", true)
+		log.Println("        <inputName.knz>). The paths, sizes, permissions, modification", true)
+		log.Println("        times and link targets are stored in a file table and the", true)
+		log.Println("        files share the compressed blocks.\n", true)
+		log.Println("   --tar", true)
+		log.Println("        Pack all the input files in a tar stream compressed in one output", true)
+		log.Println("        file (defaults to <inputName.tar.knz>) using all the jobs. The", true)
+		log.Println("        decompressed output is a standard tar file.\n", true)
 		log.Println("   -b, --block=<size>", true)
 		log.Println("        Size of blocks (default 4|8|16|32 MiB based on level, max 1 GiB, min 1 KiB).", true)
 		log.Println("        'auto' means that the compressor derives the best value'", true)
@@ -933,7 +1655,13 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("        8=EXE+RLT+TEXT+UTF+DNA&TPAQ", true)
 		log.Println("        9=EXE+RLT+TEXT+UTF+DNA&TPAQX\n", true)
 		log.Println("   -e, --entropy=<codec>", true)
-		log.Println("        Entropy codec [None|Huffman|ANS0|ANS1|Range|FPAQ|TPAQ|TPAQX|CM]\n", true)
+		log.Println("        Entropy codec [None|Huffman|ANS0|ANS1|Range|FPAQ|TPAQ|TPAQX|CM]", true)
+
+		if names := entropy.RegisteredNames(); len(names) > 0 {
+			log.Println("                      ["+strings.Join(names, "|")+"]", true)
+		}
+
+		log.Println("", true)
 		log.Println("   -t, --transform=<codec>", true)
 		log.Println("        Transform [None|BWT|BWTS|LZ|LZX|LZP|ROLZ|ROLZX|RLT|ZRLT]", true)
 		log.Println("                  [MTFT|RANK|SRT|TEXT|MM|EXE|UTF|PACK]", true)
@@ -941,8 +1669,21 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("   -x, -x32, -x64, --checksum=<size>", true)
 		log.Println("        Enable block checksum (32 or 64 bits).", true)
 		log.Println("        -x is equivalent to -x32.\n", true)
+		log.Println("   --content-checksum", true)
+		log.Println("        Append the number of blocks, the size and a 64 bit checksum of the", true)
+		log.Println("        whole input to the output. Verified during decompression.\n", true)
 		log.Println("   -s, --skip", true)
 		log.Println("        Copy blocks with high entropy instead of compressing them.\n", true)
+		log.Println("   --index", true)
+		log.Println("        Append a block index to the output to speed up random access", true)
+		log.Println("        (EG. decompression with the --from option).\n", true)
+		log.Println("   --auto[=<levels>]", true)
+		log.Println("        Try the pipelines of several compression levels on each block and", true)
+		log.Println("        keep the smallest output. The choice is recorded in each block.", true)
+		log.Println("        EG: --auto=1,5,9 (default is 2,5,8)\n", true)
+		log.Println("   --auto-budget=<ms>", true)
+		log.Println("        Maximum time in milliseconds spent trying candidates per block", true)
+		log.Println("        (0 means no limit). The first candidate is always tried.\n", true)
 	}
 
 	log.Println("   -j, --jobs=<jobs>", true)
@@ -954,12 +1695,24 @@ func printHelp(mode string, showHeader bool) {
 	log.Println("        0=silent, 1=default, 2=display details, 3=display configuration,", true)
 	log.Println("        4=display block size and timings, 5=display extra information", true)
 	log.Println("        Verbosity is reduced to 1 when files are processed concurrently", true)
-	log.Println("        Verbosity is reduced to 0 when the output is 'stdout'\n", true)
+	log.Println("        The messages go to stderr when the output is 'stdout'\n", true)
 	log.Println("   -f, --force", true)
 	log.Println("        Overwrite the output file if it already exists\n", true)
 	log.Println("   --rm", true)
 	log.Println("        Remove the input file after successful (de)compression.", true)
 	log.Println("        If the input is a folder, all processed files under the folder are removed.\n", true)
+
+	if mode == "c" || mode == "d" {
+		log.Println("   --preserve", true)
+		log.Println("        Store the metadata of the input files in the compressed files (compression)", true)
+		log.Println("        and restore it (decompression): permissions, modification and access times", true)
+		log.Println("        and, on Linux, owner (restored as root only) and extended attributes.\n", true)
+		log.Println("   --report=json", true)
+		log.Println("        Replace the messages with one JSON object per line: start, end and header", true)
+		log.Println("        events and a summary per file (sizes, ratio, duration, codecs, checksum).", true)
+		log.Println("        The block events are added with a verbosity greater than 2. The report", true)
+		log.Println("        goes to stderr when the output is 'stdout'.\n", true)
+	}
 	log.Println("   --no-link", true)
 	log.Println("        Skip links\n", true)
 	log.Println("   --no-dot-file", true)
@@ -971,9 +1724,27 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("        The first block ID is 1.\n", true)
 		log.Println("   --to=blockID", true)
 		log.Println("        Decompress ending at the provided block (excluded).\n", true)
+		log.Println("   --strict", true)
+		log.Println("        Hardened decoding of untrusted input. The blocks larger than the", true)
+		log.Println("        block size in the header are rejected and the errors name the", true)
+		log.Println("        failing codec.\n", true)
 		log.Println("", true)
 		log.Println("EG. Kanzi -d -i foo.knz -f -v 2 -j 2\n", true)
 		log.Println("EG. Kanzi --decompress --input=foo.knz --force --verbose=2 --jobs=2\n", true)
+		log.Println("EG. Kanzi --extract -i myDir.knz -o restored\n", true)
+		log.Println("EG. Kanzi --test -i backups -v 0\n", true)
+	}
+
+	if mode == "i" {
+		log.Println("", true)
+		log.Println("EG. Kanzi --info -i foo.knz\n", true)
+		log.Println("EG. Kanzi --info=json -i myDir\n", true)
+	}
+
+	if mode == "t" {
+		log.Println("", true)
+		log.Println("EG. Kanzi --train -i samples -o dict.bin --dict-size=32k\n", true)
+		log.Println("EG. Kanzi -c -i foo.json --dictionary=dict.bin\n", true)
 	}
 
 	if mode == "c" {
@@ -982,6 +1753,7 @@ func printHelp(mode string, showHeader bool) {
 		log.Println("EG. Kanzi -c -i foo.txt -f -t BWT+MTFT+ZRLT -b 4m -e FPAQ -j 4\n", true)
 		log.Println("EG. Kanzi --compress --input=foo.txt --output=foo.knz --block=4m --force", true)
 		log.Println("          --transform=BWT+MTFT+ZRLT --entropy=FPAQ --jobs=4\n", true)
+		log.Println("EG. Kanzi -a -i myDir -o myDir.knz -l 5 -j 4\n", true)
 	}
 }
 
@@ -0,0 +1,257 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// streamInfoRecord is the JSON output of the info command (one line per file)
+type streamInfoRecord struct {
+	File string `json:"file"`
+	Size int64  `json:"fileSize"`
+	*kio.StreamInfo
+}
+
+// printStreamInfo prints the header and the block headers of the compressed
+// files provided as input without decompressing them.
+func printStreamInfo(argsMap map[string]any) int {
+	inputName := argsMap["inputName"].(string)
+	format := argsMap["infoFormat"].(string)
+	noDotFiles := false
+	noLinks := false
+	var password []byte
+
+	if noDot, prst := argsMap["noDotFiles"]; prst == true {
+		noDotFiles = noDot.(bool)
+	}
+
+	if noLink, prst := argsMap["noLinks"]; prst == true {
+		noLinks = noLink.(bool)
+	}
+
+	if name, prst := argsMap["passwordFile"]; prst == true {
+		var err error
+
+		if password, err = readPassword(name.(string)); err != nil {
+			fmt.Println(err.Error())
+			return kanzi.ERR_INVALID_PARAM
+		}
+	}
+
+	files := make([]internal.FileData, 0, 16)
+
+	if len(inputName) == 0 || strings.EqualFold(inputName, _DECOMP_STDIN) {
+		files = append(files, internal.FileData{FullPath: _DECOMP_STDIN})
+	} else {
+		suffix := string([]byte{os.PathSeparator, '.'})
+		target := inputName
+		isRecursive := len(target) <= 2 || target[len(target)-len(suffix):] != suffix
+
+		if isRecursive == false {
+			target = target[0 : len(target)-1]
+		}
+
+		var err error
+
+		if files, err = internal.CreateFileList(target, files, isRecursive, noLinks, noDotFiles); err != nil {
+			fmt.Printf("Cannot access input file(s): %v\n", err)
+			return kanzi.ERR_OPEN_FILE
+		}
+
+		if len(files) == 0 {
+			fmt.Println("Cannot find any file to inspect")
+			return kanzi.ERR_OPEN_FILE
+		}
+	}
+
+	res := 0
+
+	for i, f := range files {
+		info, code := readStreamInfo(f.FullPath, password)
+
+		if code != 0 {
+			if res == 0 {
+				res = code
+			}
+
+			continue
+		}
+
+		if format == "json" {
+			buf, err := json.Marshal(streamInfoRecord{File: f.FullPath, Size: f.Size, StreamInfo: info})
+
+			if err != nil {
+				fmt.Printf("Cannot format stream info: %v\n", err)
+				return kanzi.ERR_UNKNOWN
+			}
+
+			log.Println(string(buf), true)
+			continue
+		}
+
+		if i > 0 {
+			log.Println("", true)
+		}
+
+		printStreamInfoText(f.FullPath, f.Size, info)
+	}
+
+	return res
+}
+
+// readStreamInfo reads the header and block headers of one compressed file
+func readStreamInfo(name string, password []byte) (*kio.StreamInfo, int) {
+	input := os.Stdin
+
+	if name != _DECOMP_STDIN {
+		var err error
+
+		if input, err = os.Open(name); err != nil {
+			fmt.Printf("Cannot open input file '%s': %v\n", name, err)
+			return nil, kanzi.ERR_OPEN_FILE
+		}
+
+		defer input.Close()
+	}
+
+	ctx := map[string]any{"jobs": uint(1)}
+
+	if password != nil {
+		ctx["password"] = password
+	}
+
+	cis, err := kio.NewReaderWithCtx(input, ctx)
+
+	if err != nil {
+		fmt.Printf("%s: %s\n", name, err.(*kio.IOError).Message())
+		return nil, err.(*kio.IOError).ErrorCode()
+	}
+
+	defer cis.Close()
+	info, err := cis.Info()
+
+	if err != nil {
+		if ioerr, isIOErr := err.(*kio.IOError); isIOErr == true {
+			fmt.Printf("%s: %s\n", name, ioerr.Message())
+			return nil, ioerr.ErrorCode()
+		}
+
+		fmt.Printf("%s: %v\n", name, err)
+		return nil, kanzi.ERR_READ_FILE
+	}
+
+	return info, 0
+}
+
+func printStreamInfoText(name string, size int64, info *kio.StreamInfo) {
+	log.Println(fmt.Sprintf("File:               %s", name), true)
+
+	if size > 0 {
+		log.Println(fmt.Sprintf("File size:          %d bytes", size), true)
+	}
+
+	log.Println(fmt.Sprintf("Bitstream version:  %d", info.Version), true)
+	ckSize := "NONE"
+
+	if info.Checksum != 0 {
+		ckSize = fmt.Sprintf("%d bits", info.Checksum)
+	}
+
+	log.Println(fmt.Sprintf("Block checksum:     %s", ckSize), true)
+	log.Println(fmt.Sprintf("Block size:         %d bytes", info.BlockSize), true)
+	log.Println(fmt.Sprintf("Entropy codec:      %s", info.Entropy), true)
+	log.Println(fmt.Sprintf("Transform:          %s", info.Transform), true)
+
+	if info.OriginalSize > 0 {
+		log.Println(fmt.Sprintf("Original size:      %d bytes", info.OriginalSize), true)
+	} else {
+		log.Println("Original size:      unknown", true)
+	}
+
+	log.Println(fmt.Sprintf("Compressed size:    %d bytes", (info.CompressedSize+7)>>3), true)
+	options := make([]string, 0)
+
+	if info.AutoCodecs == true {
+		options = append(options, "automatic codecs")
+	}
+
+	if info.BlockIndex == true {
+		options = append(options, "block index")
+	}
+
+	if info.ContentChecksum == true {
+		options = append(options, fmt.Sprintf("content checksum (%016x)", info.ContentHash))
+	}
+
+	if info.DictionaryID != 0 {
+		options = append(options, fmt.Sprintf("dictionary (ID %08x)", info.DictionaryID))
+	}
+
+	if info.Encrypted == true {
+		options = append(options, "encrypted (AES-256-GCM)")
+	}
+
+	if len(options) > 0 {
+		log.Println("Options:            "+strings.Join(options, ", "), true)
+	}
+
+	if md := info.Metadata; md != nil {
+		msg := fmt.Sprintf("File metadata:      %s, modified %s", md.Mode.String(), md.ModTime.Format("2006-01-02 15:04:05"))
+
+		if md.UID >= 0 {
+			msg += fmt.Sprintf(", owner %d:%d", md.UID, md.GID)
+		}
+
+		if len(md.Xattrs) > 0 {
+			msg += fmt.Sprintf(", %d extended attribute(s)", len(md.Xattrs))
+		}
+
+		log.Println(msg, true)
+	}
+
+	log.Println(fmt.Sprintf("Blocks:             %d\n", len(info.Blocks)), true)
+
+	if len(info.Blocks) == 0 {
+		return
+	}
+
+	log.Println("   Block       Offset         Size    Data size  Skip flags  Codecs", true)
+
+	for _, b := range info.Blocks {
+		msg := fmt.Sprintf("%8d %12d %12d", b.ID, b.Offset>>3, (b.Size+7)>>3)
+
+		if b.Opaque == true {
+			log.Println(msg+"            -           -  (encrypted)", true)
+			continue
+		}
+
+		codecs := b.Transform + "&" + b.Entropy
+
+		if b.Copy == true {
+			codecs = "(copy)"
+		}
+
+		log.Println(msg+fmt.Sprintf(" %12d    %.8b  %s", b.DataSize, b.SkipFlags, codecs), true)
+	}
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+type fileTestResult struct {
+	code    int    // 0 if the file is valid
+	block   int    // ID of the first failing block (0 if unknown)
+	msg     string // error message
+	read    uint64 // compressed bytes read
+	decoded int64
+}
+
+// testFiles decodes the compressed files and discards the output. Unlike
+// decompression, all the files are processed even if some fail. Returns the
+// error code of the first failing file (in file order) or 0, number of bytes
+// read.
+func (this *BlockDecompressor) testFiles(files []internal.FileData, ctx map[string]any) (int, uint64) {
+	if strings.EqualFold(this.inputName, _DECOMP_STDIN) {
+		files = append(files[:0], internal.FileData{FullPath: _DECOMP_STDIN})
+	}
+
+	before := time.Now()
+	nbFiles := len(files)
+	results := make([]fileTestResult, nbFiles)
+	jobsPerTask, _ := internal.ComputeJobsPerTask(make([]uint, nbFiles), this.jobs, uint(nbFiles))
+	tasks := make(chan int, nbFiles)
+	var wg sync.WaitGroup
+
+	for i := range files {
+		tasks <- i
+	}
+
+	close(tasks)
+
+	// A worker tests several files sequentially
+	for j := 0; j < min(int(this.jobs), nbFiles); j++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range tasks {
+				taskCtx := make(map[string]any)
+
+				for k, v := range ctx {
+					taskCtx[k] = v
+				}
+
+				taskCtx["jobs"] = jobsPerTask[i]
+				results[i] = testFile(files[i].FullPath, taskCtx)
+			}
+		}()
+	}
+
+	wg.Wait()
+	res := 0
+	read := uint64(0)
+	failed := 0
+
+	for i, r := range results {
+		read += r.read
+
+		if r.code == 0 {
+			log.Println(fmt.Sprintf("OK      %s", files[i].FullPath), this.verbosity > 0)
+			continue
+		}
+
+		msg := fmt.Sprintf("FAILED  %s: ", files[i].FullPath)
+
+		if r.block > 0 {
+			msg += fmt.Sprintf("block %d: ", r.block)
+		}
+
+		log.Println(msg+fmt.Sprintf("%s (%s)", r.msg, errorCodeName(r.code)), true)
+		failed++
+
+		if res == 0 {
+			res = r.code
+		}
+	}
+
+	if nbFiles > 1 {
+		delta := time.Since(before).Milliseconds()
+		msg := fmt.Sprintf("\n%d files tested in %d ms: %d OK, %d FAILED", nbFiles, delta, nbFiles-failed, failed)
+		log.Println(msg, this.verbosity > 0)
+	}
+
+	return res, read
+}
+
+// testFile decodes one compressed file and checks the size of the output
+func testFile(inputName string, ctx map[string]any) fileTestResult {
+	var input *os.File
+
+	if strings.EqualFold(inputName, _DECOMP_STDIN) {
+		input = os.Stdin
+	} else {
+		var err error
+
+		if input, err = os.Open(inputName); err != nil {
+			return fileTestResult{code: kanzi.ERR_OPEN_FILE, msg: fmt.Sprintf("Cannot open input file: %v", err)}
+		}
+
+		defer input.Close()
+	}
+
+	var cis *kio.Reader
+	var err error
+
+	if input != os.Stdin {
+		if fi, err2 := input.Stat(); err2 == nil && fi.Mode().IsRegular() {
+			cis, err = kio.NewReaderAt(input, fi.Size(), ctx)
+
+			if err == nil {
+				// Only use random access if the stream has a block index
+				if indexed, err2 := cis.HasIndex(); err2 != nil || indexed == false {
+					cis = nil
+				}
+			}
+		}
+	}
+
+	if cis == nil && err == nil {
+		cis, err = kio.NewReaderWithCtx(input, ctx)
+	}
+
+	if err != nil {
+		return testError(err, 0, 0)
+	}
+
+	defer cis.Close()
+	decoded, err := io.CopyBuffer(io.Discard, cis, make([]byte, _DECOMP_DEFAULT_BUFFER_SIZE))
+
+	if err != nil {
+		return testError(err, cis.GetRead(), decoded)
+	}
+
+	if err = cis.Close(); err != nil {
+		return testError(err, cis.GetRead(), decoded)
+	}
+
+	if osz, prst := ctx["outputSize"]; prst == true {
+		if outputSize := osz.(int64); outputSize != 0 && decoded != outputSize {
+			errMsg := fmt.Sprintf("Corrupted bitstream: invalid output size (expected %d, got %d)", outputSize, decoded)
+			return fileTestResult{code: kanzi.ERR_INVALID_FILE, msg: errMsg, read: cis.GetRead(), decoded: decoded}
+		}
+	}
+
+	return fileTestResult{read: cis.GetRead(), decoded: decoded}
+}
+
+func testError(err error, read uint64, decoded int64) fileTestResult {
+	var ioErr *kio.IOError
+
+	if errors.As(err, &ioErr) == true {
+		return fileTestResult{code: ioErr.ErrorCode(), block: ioErr.BlockID(), msg: ioErr.Message(), read: read, decoded: decoded}
+	}
+
+	return fileTestResult{code: kanzi.ERR_PROCESS_BLOCK, msg: err.Error(), read: read, decoded: decoded}
+}
+
+// errorCodeName returns the name of the constant matching an error code
+func errorCodeName(code int) string {
+	switch code {
+	case kanzi.ERR_MISSING_PARAM:
+		return "ERR_MISSING_PARAM"
+	case kanzi.ERR_BLOCK_SIZE:
+		return "ERR_BLOCK_SIZE"
+	case kanzi.ERR_INVALID_CODEC:
+		return "ERR_INVALID_CODEC"
+	case kanzi.ERR_CREATE_COMPRESSOR:
+		return "ERR_CREATE_COMPRESSOR"
+	case kanzi.ERR_CREATE_DECOMPRESSOR:
+		return "ERR_CREATE_DECOMPRESSOR"
+	case kanzi.ERR_OUTPUT_IS_DIR:
+		return "ERR_OUTPUT_IS_DIR"
+	case kanzi.ERR_OVERWRITE_FILE:
+		return "ERR_OVERWRITE_FILE"
+	case kanzi.ERR_CREATE_FILE:
+		return "ERR_CREATE_FILE"
+	case kanzi.ERR_CREATE_BITSTREAM:
+		return "ERR_CREATE_BITSTREAM"
+	case kanzi.ERR_OPEN_FILE:
+		return "ERR_OPEN_FILE"
+	case kanzi.ERR_READ_FILE:
+		return "ERR_READ_FILE"
+	case kanzi.ERR_WRITE_FILE:
+		return "ERR_WRITE_FILE"
+	case kanzi.ERR_PROCESS_BLOCK:
+		return "ERR_PROCESS_BLOCK"
+	case kanzi.ERR_CREATE_CODEC:
+		return "ERR_CREATE_CODEC"
+	case kanzi.ERR_INVALID_FILE:
+		return "ERR_INVALID_FILE"
+	case kanzi.ERR_STREAM_VERSION:
+		return "ERR_STREAM_VERSION"
+	case kanzi.ERR_CREATE_STREAM:
+		return "ERR_CREATE_STREAM"
+	case kanzi.ERR_INVALID_PARAM:
+		return "ERR_INVALID_PARAM"
+	case kanzi.ERR_CRC_CHECK:
+		return "ERR_CRC_CHECK"
+	case kanzi.ERR_CANCELED:
+		return "ERR_CANCELED"
+	case kanzi.ERR_DICTIONARY:
+		return "ERR_DICTIONARY"
+	case kanzi.ERR_CONTENT_CHECK:
+		return "ERR_CONTENT_CHECK"
+	case kanzi.ERR_DECRYPTION:
+		return "ERR_DECRYPTION"
+	case kanzi.ERR_MEMORY_LIMIT:
+		return "ERR_MEMORY_LIMIT"
+	default:
+		return fmt.Sprintf("ERR_UNKNOWN %d", code)
+	}
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// The tar mode packs the input files in a tar stream compressed in one kanzi
+// stream (.tar.knz), so that the whole tree is compressed with all the jobs.
+// The output can be decompressed with or without the --tar option (tar file).
+
+var errInvalidTar = errors.New("Invalid tar archive")
+
+// compressTar writes all the input files to a compressed tar stream
+func (this *BlockCompressor) compressTar(files []internal.FileData, ctx map[string]any) (int, uint64) {
+	return this.packFiles(files, ctx, ".tar.knz", this.writeTar)
+}
+
+// writeTar writes a tar header and the content of each file
+func (this *BlockCompressor) writeTar(w io.Writer, entries []kio.ArchiveEntry, files []internal.FileData) (int, error) {
+	tw := tar.NewWriter(w)
+	buffer := make([]byte, _COMP_DEFAULT_BUFFER_SIZE)
+
+	for i := range entries {
+		e := &entries[i]
+		log.Println("Adding "+e.Name, this.verbosity > 1)
+		fi, err := os.Lstat(files[i].FullPath)
+
+		if err != nil {
+			return kanzi.ERR_OPEN_FILE, fmt.Errorf("Cannot access input file '%s': %v", files[i].FullPath, err)
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, e.Link)
+
+		if err != nil {
+			return kanzi.ERR_OPEN_FILE, fmt.Errorf("Cannot archive file '%s': %v", files[i].FullPath, err)
+		}
+
+		hdr.Name = e.Name
+		hdr.Size = e.Size
+
+		if e.IsSymlink() == true {
+			hdr.Size = 0
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return kanzi.ERR_WRITE_FILE, fmt.Errorf("Cannot write tar header of '%s': %v", e.Name, err)
+		}
+
+		if e.IsSymlink() == true {
+			continue
+		}
+
+		if code, err := copyToArchive(tw, files[i].FullPath, e.Size, buffer); err != nil {
+			return code, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return kanzi.ERR_WRITE_FILE, err
+	}
+
+	return 0, nil
+}
+
+// extractTar restores the files of a compressed tar stream under the output
+// folder
+func (this *BlockDecompressor) extractTar(ctx map[string]any) (int, uint64) {
+	return this.extractFiles(ctx, func(cis *kio.Reader) (archiveIterator, error) {
+		tr := tar.NewReader(cis)
+
+		return func() (*kio.ArchiveEntry, io.Reader, error) {
+			return this.nextTarEntry(tr)
+		}, nil
+	})
+}
+
+// nextTarEntry returns the next regular file, link or folder of the tar
+// stream. The other entries (EG. hard links, devices) are skipped.
+func (this *BlockDecompressor) nextTarEntry(tr *tar.Reader) (*kio.ArchiveEntry, io.Reader, error) {
+	for {
+		hdr, err := tr.Next()
+
+		if err != nil {
+			if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) == true {
+				return nil, nil, err
+			}
+
+			var ioerr *kio.IOError
+
+			if errors.As(err, &ioerr) == true {
+				return nil, nil, err
+			}
+
+			return nil, nil, fmt.Errorf("%w: %v", errInvalidTar, err)
+		}
+
+		// Reject absolute paths and '..' components
+		name := path.Clean(hdr.Name)
+
+		if name == "." && hdr.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		if fs.ValidPath(name) == false || name == "." {
+			return nil, nil, fmt.Errorf("%w: invalid entry name '%s'", errInvalidTar, hdr.Name)
+		}
+
+		e := &kio.ArchiveEntry{Name: name, Mode: fs.FileMode(hdr.Mode).Perm(), ModTime: hdr.ModTime}
+
+		switch hdr.Typeflag {
+		case tar.TypeReg:
+			e.Size = hdr.Size
+
+		case tar.TypeSymlink:
+			e.Mode |= fs.ModeSymlink
+			e.Link = hdr.Linkname
+
+		case tar.TypeDir:
+			e.Mode |= fs.ModeDir
+
+		default:
+			log.Println(fmt.Sprintf("Skipping unsupported tar entry '%s'", hdr.Name), this.verbosity > 0)
+			continue
+		}
+
+		return e, tr, nil
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/zipcodec"
+)
+
+// convertZip rewrites the entries of a zip file with the kanzi method (or
+// back to the deflate method)
+func convertZip(argsMap map[string]any) int {
+	verbosity := argsMap["verbosity"].(uint)
+	inputName := argsMap["inputName"].(string)
+	outputName := argsMap["outputName"].(string)
+	toKanzi := argsMap["zipMethod"].(string) == "kanzi"
+	level := zipcodec.DEFAULT_LEVEL
+	blockSize := uint(0)
+	jobs := uint(runtime.NumCPU())
+	overwrite := false
+
+	if l, prst := argsMap["level"]; prst == true {
+		level = l.(int)
+	}
+
+	if bs, prst := argsMap["blockSize"]; prst == true {
+		blockSize = bs.(uint)
+	}
+
+	if j, prst := argsMap["jobs"]; prst == true && j.(uint) > 0 {
+		jobs = min(j.(uint), _COMP_MAX_CONCURRENCY)
+	}
+
+	if force, prst := argsMap["overwrite"]; prst == true {
+		overwrite = force.(bool)
+	}
+
+	if len(inputName) == 0 || strings.EqualFold(inputName, _COMP_STDIN) {
+		fmt.Println("Missing zip file: provide a file as input")
+		return kanzi.ERR_MISSING_PARAM
+	}
+
+	if len(outputName) == 0 || strings.EqualFold(outputName, _COMP_STDOUT) || strings.EqualFold(outputName, _COMP_NONE) {
+		fmt.Println("Missing zip file: provide a file as output")
+		return kanzi.ERR_MISSING_PARAM
+	}
+
+	if inPath, err := filepath.Abs(inputName); err == nil {
+		if outPath, err := filepath.Abs(outputName); err == nil && inPath == outPath {
+			fmt.Println("The input and output files must be different")
+			return kanzi.ERR_CREATE_FILE
+		}
+	}
+
+	input, err := os.Open(inputName)
+
+	if err != nil {
+		fmt.Printf("Cannot open input file '%s': %v\n", inputName, err)
+		return kanzi.ERR_OPEN_FILE
+	}
+
+	defer input.Close()
+	fi, err := input.Stat()
+
+	if err != nil || fi.IsDir() == true {
+		fmt.Printf("Invalid input file '%s'\n", inputName)
+		return kanzi.ERR_OPEN_FILE
+	}
+
+	src, err := zipcodec.NewReader(input, fi.Size(), jobs)
+
+	if err != nil {
+		fmt.Printf("Cannot read zip file '%s': %v\n", inputName, err)
+		return kanzi.ERR_INVALID_FILE
+	}
+
+	if ofi, err := os.Stat(outputName); err == nil {
+		if ofi.IsDir() == true {
+			fmt.Println("The output file is a directory")
+			return kanzi.ERR_OUTPUT_IS_DIR
+		}
+
+		if overwrite == false {
+			fmt.Printf("File '%s' exists and the 'force' command ", outputName)
+			fmt.Println("line option has not been provided")
+			return kanzi.ERR_OVERWRITE_FILE
+		}
+	}
+
+	output, err := os.Create(outputName)
+
+	if err != nil {
+		fmt.Printf("Cannot create output file '%s': %v\n", outputName, err)
+		return kanzi.ERR_CREATE_FILE
+	}
+
+	bw := bufio.NewWriterSize(output, 1<<20)
+	var dst *zip.Writer
+	method := zip.Deflate
+
+	if toKanzi == true {
+		method = zipcodec.METHOD
+
+		if dst, err = zipcodec.NewWriter(bw, level, blockSize, jobs); err != nil {
+			output.Close()
+			os.Remove(outputName)
+			fmt.Printf("Failed to create zip writer: %v\n", err)
+			return kanzi.ERR_CREATE_COMPRESSOR
+		}
+	} else {
+		dst = zip.NewWriter(bw)
+	}
+
+	before := time.Now()
+	err = zipcodec.Convert(dst, src, method)
+
+	if err == nil {
+		err = dst.Close()
+	}
+
+	if err == nil {
+		err = bw.Flush()
+	}
+
+	if err2 := output.Close(); err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		os.Remove(outputName)
+		fmt.Printf("Failed to convert zip file '%s': %v\n", inputName, err)
+		return kanzi.ERR_PROCESS_BLOCK
+	}
+
+	if verbosity > 0 {
+		ofi, _ := os.Stat(outputName)
+		log.Println(fmt.Sprintf("%s: %d entries, %d => %d bytes in %d ms", inputName, len(src.File), fi.Size(),
+			ofi.Size(), time.Since(before).Milliseconds()), true)
+	}
+
+	return 0
+}
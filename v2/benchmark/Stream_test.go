@@ -0,0 +1,214 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package benchmark
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Compression and decompression of many small payloads: allocate a new
+// Writer/Reader per payload vs reuse them with Reset (directly or via a sync.Pool)
+
+const _SMALL_PAYLOAD_SIZE = 4096
+
+type discardWriteCloser struct {
+	io.Writer
+}
+
+func (this discardWriteCloser) Close() error {
+	return nil
+}
+
+func newStreamCtx() map[string]any {
+	ctx := make(map[string]any)
+	ctx["transform"] = "LZ"
+	ctx["entropy"] = "HUFFMAN"
+	ctx["blockSize"] = uint(1024 * 1024)
+	ctx["jobs"] = uint(1)
+	ctx["checksum"] = uint(0)
+	return ctx
+}
+
+func getSmallPayload() []byte {
+	// Initialize with a fixed seed to get consistent results
+	r := rand.New(rand.NewSource(1234567))
+	buf := make([]byte, _SMALL_PAYLOAD_SIZE)
+
+	for i := range buf {
+		buf[i] = byte(r.Intn(16) + 65)
+	}
+
+	return buf
+}
+
+func BenchmarkWriterNew(b *testing.B) {
+	payload := getSmallPayload()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		w, err := kio.NewWriterWithCtx(discardWriteCloser{io.Discard}, newStreamCtx())
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err = w.Write(payload); err != nil {
+			b.Fatal(err)
+		}
+
+		if err = w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriterReset(b *testing.B) {
+	payload := getSmallPayload()
+	w, err := kio.NewWriterWithCtx(discardWriteCloser{io.Discard}, newStreamCtx())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err = w.Reset(discardWriteCloser{io.Discard}); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err = w.Write(payload); err != nil {
+			b.Fatal(err)
+		}
+
+		if err = w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriterPool(b *testing.B) {
+	payload := getSmallPayload()
+	pool := sync.Pool{
+		New: func() any {
+			w, _ := kio.NewWriterWithCtx(discardWriteCloser{io.Discard}, newStreamCtx())
+			return w
+		},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			w := pool.Get().(*kio.Writer)
+
+			if err := w.Reset(discardWriteCloser{io.Discard}); err != nil {
+				b.Error(err)
+				return
+			}
+
+			if _, err := w.Write(payload); err != nil {
+				b.Error(err)
+				return
+			}
+
+			if err := w.Close(); err != nil {
+				b.Error(err)
+				return
+			}
+
+			pool.Put(w)
+		}
+	})
+}
+
+func getCompressedPayload(b *testing.B) []byte {
+	var buf bytes.Buffer
+	w, err := kio.NewWriterWithCtx(discardWriteCloser{&buf}, newStreamCtx())
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err = w.Write(getSmallPayload()); err != nil {
+		b.Fatal(err)
+	}
+
+	if err = w.Close(); err != nil {
+		b.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func BenchmarkReaderNew(b *testing.B) {
+	data := getCompressedPayload(b)
+	res := make([]byte, _SMALL_PAYLOAD_SIZE)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		r, err := kio.NewReader(io.NopCloser(bytes.NewReader(data)), 1)
+
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err = io.ReadFull(r, res); err != nil {
+			b.Fatal(err)
+		}
+
+		if err = r.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReaderReset(b *testing.B) {
+	data := getCompressedPayload(b)
+	res := make([]byte, _SMALL_PAYLOAD_SIZE)
+	r, err := kio.NewReader(io.NopCloser(bytes.NewReader(data)), 1)
+
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err = r.Reset(io.NopCloser(bytes.NewReader(data))); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err = io.ReadFull(r, res); err != nil {
+			b.Fatal(err)
+		}
+
+		if err = r.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -219,7 +219,7 @@ func (this *DefaultInputBitStream) readFromInputStream(count int) (int, error) {
 	}
 
 	this.read += (int64(this.position << 3))
-	size, err := this.is.Read(this.buffer[0:count])
+	size, _ := this.is.Read(this.buffer[0:count])
 	this.position = 0
 
 	if size <= 0 {
@@ -227,8 +227,10 @@ func (this *DefaultInputBitStream) readFromInputStream(count int) (int, error) {
 		return 0, errors.New("No more data to read in the bitstream")
 	}
 
+	// Data and an error (EG. io.EOF) may be returned by the same call:
+	// the error is expected to be returned again by the next read
 	this.maxPosition = size - 1
-	return size, err
+	return size, nil
 }
 
 // HasMoreToRead returns false is the stream is closed or there is no
@@ -291,6 +293,23 @@ func (this *DefaultInputBitStream) Close() error {
 	return nil
 }
 
+// Reset discards the state of the bitstream and makes it read from the provided
+// stream. The internal buffer is reused.
+func (this *DefaultInputBitStream) Reset(stream io.ReadCloser) error {
+	if stream == nil {
+		return errors.New("Invalid null input stream parameter")
+	}
+
+	this.is = stream
+	this.closed = false
+	this.read = 0
+	this.position = 0
+	this.availBits = 0
+	this.maxPosition = -1
+	this.current = 0
+	return nil
+}
+
 // Read returns the number of bits read so far
 func (this *DefaultInputBitStream) Read() uint64 {
 	return uint64(this.read + int64(this.position)<<3 - int64(this.availBits))
@@ -31,6 +31,8 @@ type DefaultOutputBitStream struct {
 	current   uint64 // cached bits
 	os        io.WriteCloser
 	buffer    []byte
+	size      int  // size of the buffer (released by Close)
+	reused    bool // set by Reset, Close keeps the buffer for the next Reset
 }
 
 // NewDefaultOutputBitStream creates a bitstream for writing, using the provided stream as
@@ -54,6 +56,7 @@ func NewDefaultOutputBitStream(stream io.WriteCloser, bufferSize uint) (*Default
 
 	this := &DefaultOutputBitStream{}
 	this.buffer = make([]byte, bufferSize)
+	this.size = int(bufferSize)
 	this.os = stream
 	this.availBits = 64
 
@@ -228,6 +231,38 @@ func (this *DefaultOutputBitStream) flush() error {
 	return nil
 }
 
+// Flush writes the buffered bits to the underlying stream, which must be
+// byte aligned. If the underlying stream implements Flush() error, it is
+// called as well. The bitstream remains open.
+func (this *DefaultOutputBitStream) Flush() error {
+	if this.Closed() {
+		return errors.New("Stream closed")
+	}
+
+	if this.availBits&7 != 0 {
+		return errors.New("Cannot flush a bitstream not aligned on a byte boundary")
+	}
+
+	// Move the cached bytes to the buffer (there is always room for 8 bytes)
+	for shift := uint(56); this.availBits < 64; shift -= 8 {
+		this.buffer[this.position] = byte(this.current >> shift)
+		this.position++
+		this.availBits += 8
+	}
+
+	this.current = 0
+
+	if err := this.flush(); err != nil {
+		return err
+	}
+
+	if f, ok := this.os.(interface{ Flush() error }); ok == true {
+		return f.Flush()
+	}
+
+	return nil
+}
+
 // Close prevents further writes
 func (this *DefaultOutputBitStream) Close() error {
 	if this.Closed() {
@@ -262,7 +297,39 @@ func (this *DefaultOutputBitStream) Close() error {
 	this.position = 0
 	this.availBits = 0
 	this.written -= 64 // adjust because this.availBits = 0
-	this.buffer = make([]byte, 8)
+
+	if this.reused == true {
+		// Keep the capacity of the buffer for the next Reset()
+		this.buffer = this.buffer[0:8]
+	} else {
+		this.buffer = make([]byte, 8)
+	}
+
+	return nil
+}
+
+// Reset discards the state of the bitstream and makes it write to the provided
+// stream. The internal buffer is reused (once a bitstream has been reset,
+// Close keeps the buffer for the next Reset).
+func (this *DefaultOutputBitStream) Reset(stream io.WriteCloser) error {
+	if stream == nil {
+		return errors.New("Invalid null output stream parameter")
+	}
+
+	this.os = stream
+	this.reused = true
+
+	if cap(this.buffer) < this.size {
+		// Released by Close
+		this.buffer = make([]byte, this.size)
+	}
+
+	this.buffer = this.buffer[0:cap(this.buffer)]
+	this.closed = false
+	this.written = 0
+	this.position = 0
+	this.availBits = 64
+	this.current = 0
 	return nil
 }
 
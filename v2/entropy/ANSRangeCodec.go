@@ -885,6 +885,10 @@ func (this *ANSRangeDecoder) decodeChunkV2(block []byte) bool {
 		this.buffer = make([]byte, minBufSize)
 	}
 
+	if int(sz) > len(this.buffer) {
+		return false
+	}
+
 	for i := range this.buffer {
 		this.buffer[i] = 0
 	}
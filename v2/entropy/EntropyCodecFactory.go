@@ -17,7 +17,9 @@ package entropy
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
 )
@@ -33,14 +35,150 @@ const (
 	TPAQ_TYPE    = uint32(7)  // Tangelo PAQ
 	ANS1_TYPE    = uint32(8)  // Asymmetric Numerical System order 1
 	TPAQX_TYPE   = uint32(9)  // Tangelo PAQ Extra
-	RESERVED1    = uint32(10) // Reserved
-	RESERVED2    = uint32(11) // Reserved
-	RESERVED3    = uint32(12) // Reserved
-	RESERVED4    = uint32(13) // Reserved
-	RESERVED5    = uint32(14) // Reserved
-	RESERVED6    = uint32(15) // Reserved
+	RESERVED1    = uint32(10) // Reserved (available for user codecs)
+	RESERVED2    = uint32(11) // Reserved (available for user codecs)
+	RESERVED3    = uint32(12) // Reserved (available for user codecs)
+	RESERVED4    = uint32(13) // Reserved (available for user codecs)
+	RESERVED5    = uint32(14) // Reserved (available for user codecs)
+	RESERVED6    = uint32(15) // Reserved (available for user codecs)
+
+	// Range of types available for user codecs (see Register)
+	MIN_USER_TYPE = uint32(10)
+	MAX_USER_TYPE = uint32(31) // 5 bits in the bitstream header
 )
 
+// userCodec an entropy codec registered with Register
+type userCodec struct {
+	name           string
+	encoderFactory func(kanzi.OutputBitStream, map[string]any) (kanzi.EntropyEncoder, error)
+	decoderFactory func(kanzi.InputBitStream, map[string]any) (kanzi.EntropyDecoder, error)
+}
+
+var (
+	userCodecs     = make(map[uint32]userCodec)
+	userCodecsLock sync.RWMutex
+)
+
+// Register makes a custom entropy codec available to NewEntropyEncoder,
+// NewEntropyDecoder, GetName and GetType (hence to the Writer and Reader)
+// under the provided type and name. The factories are called for each block
+// with the block bitstream and a copy of the context (EG. "size", "bsVersion").
+// The type must be in [MIN_USER_TYPE..MAX_USER_TYPE] and the name must not
+// be used by another codec. Names are case insensitive.
+// The same codec must be registered to decompress a stream using it.
+func Register(id uint32, name string,
+	encoderFactory func(kanzi.OutputBitStream, map[string]any) (kanzi.EntropyEncoder, error),
+	decoderFactory func(kanzi.InputBitStream, map[string]any) (kanzi.EntropyDecoder, error)) error {
+	if id < MIN_USER_TYPE || id > MAX_USER_TYPE {
+		return fmt.Errorf("Invalid entropy codec type: '%d' (must be in [%d..%d])", id, MIN_USER_TYPE, MAX_USER_TYPE)
+	}
+
+	if encoderFactory == nil || decoderFactory == nil {
+		return fmt.Errorf("Invalid null factory for entropy codec type: '%d'", id)
+	}
+
+	name = strings.ToUpper(name)
+
+	if len(name) == 0 || strings.ContainsAny(name, "+&") == true {
+		return fmt.Errorf("Invalid entropy codec name: '%s'", name)
+	}
+
+	userCodecsLock.Lock()
+	defer userCodecsLock.Unlock()
+
+	if _, exists := userCodecs[id]; exists == true {
+		return fmt.Errorf("Entropy codec type '%d' already registered", id)
+	}
+
+	if _, err := getBuiltinType(name); err == nil {
+		return fmt.Errorf("Entropy codec name '%s' already used", name)
+	}
+
+	for _, c := range userCodecs {
+		if c.name == name {
+			return fmt.Errorf("Entropy codec name '%s' already used", name)
+		}
+	}
+
+	userCodecs[id] = userCodec{name: name, encoderFactory: encoderFactory, decoderFactory: decoderFactory}
+	return nil
+}
+
+// RegisterPredictor registers a binary entropy codec driven by the
+// predictor returned by the factory (a new predictor is created for
+// each block). See Register.
+func RegisterPredictor(id uint32, name string, factory func(map[string]any) (kanzi.Predictor, error)) error {
+	if factory == nil {
+		return fmt.Errorf("Invalid null factory for entropy codec type: '%d'", id)
+	}
+
+	encoderFactory := func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error) {
+		predictor, err := factory(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBinaryEntropyEncoder(obs, primePredictor(predictor, ctx))
+	}
+
+	decoderFactory := func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error) {
+		predictor, err := factory(ctx)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return NewBinaryEntropyDecoder(ibs, primePredictor(predictor, ctx))
+	}
+
+	return Register(id, name, encoderFactory, decoderFactory)
+}
+
+// primePredictor updates the predictor with the bits of the shared dictionary
+// (if any) so that the model is already trained when the block starts.
+func primePredictor(predictor kanzi.Predictor, ctx map[string]any) kanzi.Predictor {
+	if val, hasKey := ctx["dictionaryData"]; hasKey {
+		for _, b := range val.([]byte) {
+			for shift := 7; shift >= 0; shift-- {
+				predictor.Update((b >> uint(shift)) & 1)
+			}
+		}
+	}
+
+	return predictor
+}
+
+// RegisteredNames returns the names of the registered user codecs (sorted)
+func RegisteredNames() []string {
+	userCodecsLock.RLock()
+	res := make([]string, 0, len(userCodecs))
+
+	for _, c := range userCodecs {
+		res = append(res, c.name)
+	}
+
+	userCodecsLock.RUnlock()
+	sort.Strings(res)
+	return res
+}
+
+func getUserCodec(entropyType uint32) (userCodec, error) {
+	userCodecsLock.RLock()
+	c, exists := userCodecs[entropyType]
+	userCodecsLock.RUnlock()
+
+	if exists == false {
+		if entropyType >= MIN_USER_TYPE && entropyType <= MAX_USER_TYPE {
+			return c, fmt.Errorf("Unsupported entropy codec type: '%d' (not registered, see entropy.Register)", entropyType)
+		}
+
+		return c, fmt.Errorf("Unsupported entropy codec type: '%d'", entropyType)
+	}
+
+	return c, nil
+}
+
 // NewEntropyDecoder creates a new entropy decoder using the provided type and bitstream
 func NewEntropyDecoder(ibs kanzi.InputBitStream, ctx map[string]any,
 	entropyType uint32) (kanzi.EntropyDecoder, error) {
@@ -63,17 +201,23 @@ func NewEntropyDecoder(ibs kanzi.InputBitStream, ctx map[string]any,
 
 	case CM_TYPE:
 		predictor, _ := NewCMPredictor(&ctx)
-		return NewBinaryEntropyDecoder(ibs, predictor)
+		return NewBinaryEntropyDecoder(ibs, primePredictor(predictor, ctx))
 
 	case TPAQ_TYPE, TPAQX_TYPE:
 		predictor, _ := NewTPAQPredictor(&ctx)
-		return NewBinaryEntropyDecoder(ibs, predictor)
+		return NewBinaryEntropyDecoder(ibs, primePredictor(predictor, ctx))
 
 	case NONE_TYPE:
 		return NewNullEntropyDecoder(ibs)
 
 	default:
-		return nil, fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
+		c, err := getUserCodec(entropyType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return c.decoderFactory(ibs, ctx)
 	}
 }
 
@@ -99,17 +243,23 @@ func NewEntropyEncoder(obs kanzi.OutputBitStream, ctx map[string]any,
 
 	case CM_TYPE:
 		predictor, _ := NewCMPredictor(&ctx)
-		return NewBinaryEntropyEncoder(obs, predictor)
+		return NewBinaryEntropyEncoder(obs, primePredictor(predictor, ctx))
 
 	case TPAQ_TYPE, TPAQX_TYPE:
 		predictor, _ := NewTPAQPredictor(&ctx)
-		return NewBinaryEntropyEncoder(obs, predictor)
+		return NewBinaryEntropyEncoder(obs, primePredictor(predictor, ctx))
 
 	case NONE_TYPE:
 		return NewNullEntropyEncoder(obs)
 
 	default:
-		return nil, fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
+		c, err := getUserCodec(entropyType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return c.encoderFactory(obs, ctx)
 	}
 }
 
@@ -145,12 +295,36 @@ func GetName(entropyType uint32) (string, error) {
 		return "NONE", nil
 
 	default:
-		return "", fmt.Errorf("Unsupported entropy codec type: '%c'", entropyType)
+		c, err := getUserCodec(entropyType)
+
+		if err != nil {
+			return "", err
+		}
+
+		return c.name, nil
 	}
 }
 
 // GetType returns the type of the entropy codec given its name
 func GetType(entropyName string) (uint32, error) {
+	if res, err := getBuiltinType(entropyName); err == nil {
+		return res, nil
+	}
+
+	name := strings.ToUpper(entropyName)
+	userCodecsLock.RLock()
+	defer userCodecsLock.RUnlock()
+
+	for id, c := range userCodecs {
+		if c.name == name {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unsupported entropy codec type: '%v'", entropyName)
+}
+
+func getBuiltinType(entropyName string) (uint32, error) {
 	switch strings.ToUpper(entropyName) {
 
 	case "HUFFMAN":
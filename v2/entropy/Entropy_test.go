@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"math/rand"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
@@ -48,6 +50,11 @@ func TestRange(b *testing.T) {
 		b.Errorf(err.Error())
 	}
 }
+func TestRangeCorrupted(b *testing.T) {
+	if err := testRangeCorrupted(); err != nil {
+		b.Errorf(err.Error())
+	}
+}
 func TestFPAQ(b *testing.T) {
 	if err := testEntropyCorrectness("FPAQ"); err != nil {
 		b.Errorf(err.Error())
@@ -64,6 +71,113 @@ func TestTPAQ(b *testing.T) {
 	}
 }
 
+func TestRegister(b *testing.T) {
+	if err := testRegister(); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
+// order0Predictor a simple user predictor (order 0 binary model)
+type order0Predictor struct {
+	probs [256]int
+	ctx   int
+}
+
+func newOrder0Predictor(ctx map[string]any) (kanzi.Predictor, error) {
+	this := &order0Predictor{ctx: 1}
+
+	for i := range this.probs {
+		this.probs[i] = 2048
+	}
+
+	return this, nil
+}
+
+func (this *order0Predictor) Update(bit byte) {
+	if bit == 1 {
+		this.probs[this.ctx] += (4096 - this.probs[this.ctx]) >> 4
+	} else {
+		this.probs[this.ctx] -= this.probs[this.ctx] >> 4
+	}
+
+	this.ctx = (this.ctx << 1) | int(bit)
+
+	if this.ctx >= 256 {
+		this.ctx = 1
+	}
+}
+
+func (this *order0Predictor) Get() int {
+	return this.probs[this.ctx]
+}
+
+var registerOnce sync.Once
+var registerErr error
+
+func testRegister() error {
+	fmt.Println("\nTest user entropy codec registration")
+
+	registerOnce.Do(func() {
+		if registerErr = RegisterPredictor(RESERVED1, "order0", newOrder0Predictor); registerErr != nil {
+			return
+		}
+
+		registerErr = Register(RESERVED2, "HUF2",
+			func(obs kanzi.OutputBitStream, ctx map[string]any) (kanzi.EntropyEncoder, error) {
+				return NewHuffmanEncoder(obs)
+			},
+			func(ibs kanzi.InputBitStream, ctx map[string]any) (kanzi.EntropyDecoder, error) {
+				return NewHuffmanDecoderWithCtx(ibs, &ctx)
+			})
+	})
+
+	if registerErr != nil {
+		return registerErr
+	}
+
+	// Invalid registrations
+	if RegisterPredictor(RESERVED1, "order1", newOrder0Predictor) == nil {
+		return errors.New("Registration of existing type should fail")
+	}
+
+	if RegisterPredictor(RESERVED3, "ORDER0", newOrder0Predictor) == nil {
+		return errors.New("Registration of existing name should fail")
+	}
+
+	if RegisterPredictor(RESERVED3, "huffman", newOrder0Predictor) == nil {
+		return errors.New("Registration of built-in name should fail")
+	}
+
+	if RegisterPredictor(MAX_USER_TYPE+1, "order1", newOrder0Predictor) == nil {
+		return errors.New("Registration of invalid type should fail")
+	}
+
+	if eType, err := GetType("Order0"); err != nil || eType != RESERVED1 {
+		return fmt.Errorf("Invalid type for registered codec: %v %v", eType, err)
+	}
+
+	if name, err := GetName(RESERVED2); err != nil || name != "HUF2" {
+		return fmt.Errorf("Invalid name for registered codec: %v %v", name, err)
+	}
+
+	if names := RegisteredNames(); len(names) != 2 || names[0] != "HUF2" || names[1] != "ORDER0" {
+		return fmt.Errorf("Invalid registered codec names: %v", names)
+	}
+
+	// Type not registered
+	obs, _ := bitstream.NewDefaultOutputBitStream(internal.NewBufferStream(), 16384)
+
+	if _, err := NewEntropyEncoder(obs, make(map[string]any), RESERVED3); err == nil || strings.Contains(err.Error(), "not registered") == false {
+		return fmt.Errorf("Expected error for unregistered codec, got %v", err)
+	}
+
+	if err := testEntropyCorrectness("ORDER0"); err != nil {
+		return err
+	}
+
+	return testEntropyCorrectness("HUF2")
+}
+
 func getEncoder(name string, obs kanzi.OutputBitStream) kanzi.EntropyEncoder {
 	ctx := make(map[string]any)
 	ctx["entropy"] = name
@@ -206,3 +320,47 @@ func testEntropyCorrectness(name string) error {
 
 	return error(nil)
 }
+
+// testRangeCorrupted decodes corrupted range coded data: the decoder must
+// report an error or return garbage but never panic.
+func testRangeCorrupted() (err error) {
+	values := make([]byte, 4096)
+	r := rand.New(rand.NewSource(12345))
+
+	for i := range values {
+		values[i] = byte(64 + r.Intn(32))
+	}
+
+	bs := internal.NewBufferStream()
+	obs, _ := bitstream.NewDefaultOutputBitStream(bs, 16384)
+	ec, _ := NewRangeEncoder(obs)
+
+	if _, err = ec.Write(values); err != nil {
+		return err
+	}
+
+	ec.Dispose()
+	obs.Close()
+	encoded := make([]byte, bs.Len())
+	bs.Read(encoded)
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Range decoder panic on corrupted data: %v", r)
+		}
+	}()
+
+	for i := 0; i < len(encoded); i++ {
+		// Pad the data so that decoding does not run past the end of the bitstream
+		corrupted := make([]byte, 16*len(encoded))
+		copy(corrupted, encoded)
+		corrupted[i] ^= 0xFF
+		ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(corrupted), 16384)
+		ed, _ := NewRangeDecoder(ibs)
+		ed.Read(make([]byte, len(values)))
+		ed.Dispose()
+		ibs.Close()
+	}
+
+	return nil
+}
@@ -784,6 +784,11 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 			// Read chunk size
 			szBits := ReadVarInt(this.bitstream)
 
+			// Sanity check: each symbol uses at most maxSymbolSize bits
+			if uint64(szBits) > uint64(endChunk-startChunk)*uint64(this.maxSymbolSize) {
+				return startChunk, fmt.Errorf("Invalid bitstream: incorrect Huffman chunk size %d", szBits)
+			}
+
 			// Read compressed data from the bitstream
 			if szBits != 0 {
 				sz := int(szBits+7) >> 3
@@ -803,7 +808,7 @@ func (this *HuffmanDecoder) Read(block []byte) (int, error) {
 				idx := 0
 				n := startChunk
 
-				for idx < sz-8 {
+				for idx < sz-8 && n+4 <= endChunk {
 					shift := uint8((56 - bits) & 0xF8)
 					state = (state << shift) | (binary.BigEndian.Uint64(this.buffer[idx:idx+8]) >> 1 >> (63 - shift)) // handle shift = 0
 					idx += int(shift >> 3)
@@ -328,6 +328,7 @@ type RangeDecoder struct {
 	bitstream kanzi.InputBitStream
 	chunkSize uint
 	shift     uint
+	invalid   bool // set by decodeByte when the range is corrupted
 }
 
 // NewRangeDecoder creates a new instance of RangeDecoder
@@ -525,6 +526,11 @@ func (this *RangeDecoder) Read(block []byte) (int, error) {
 
 		for i := range buf {
 			buf[i] = this.decodeByte()
+
+			if this.invalid == true {
+				this.invalid = false
+				return startChunk + i, errors.New("Invalid bitstream: incorrect range in range decoder")
+			}
 		}
 
 		startChunk = endChunk
@@ -537,6 +543,12 @@ func (this *RangeDecoder) decodeByte() byte {
 	// Compute next low and range
 	this.rng >>= this.shift
 	count := int((this.code - this.low) / this.rng)
+
+	if count < 0 || count >= 1<<this.shift {
+		this.invalid = true
+		return 0
+	}
+
 	symbol := this.f2s[count]
 	cumFreq := this.cumFreqs[symbol]
 	this.low += (cumFreq * this.rng)
@@ -69,18 +69,29 @@ func (this *XXHash64) Hash(data []byte) uint64 {
 			n += 32
 		}
 
-		h64 = ((v1 << 1) | (v1 >> 31)) + ((v2 << 7) | (v2 >> 25)) +
-			((v3 << 12) | (v3 >> 20)) + ((v4 << 18) | (v4 >> 14))
-
-		h64 = xxHash64MergeRound(h64, v1)
-		h64 = xxHash64MergeRound(h64, v2)
-		h64 = xxHash64MergeRound(h64, v3)
-		h64 = xxHash64MergeRound(h64, v4)
+		h64 = xxHash64Merge(v1, v2, v3, v4)
 	} else {
 		h64 = this.seed + _XXHASH_PRIME64_5
 	}
 
 	h64 += uint64(end)
+	return xxHash64Finalize(h64, data[n:])
+}
+
+func xxHash64Merge(v1, v2, v3, v4 uint64) uint64 {
+	h64 := ((v1 << 1) | (v1 >> 31)) + ((v2 << 7) | (v2 >> 25)) +
+		((v3 << 12) | (v3 >> 20)) + ((v4 << 18) | (v4 >> 14))
+
+	h64 = xxHash64MergeRound(h64, v1)
+	h64 = xxHash64MergeRound(h64, v2)
+	h64 = xxHash64MergeRound(h64, v3)
+	return xxHash64MergeRound(h64, v4)
+}
+
+// xxHash64Finalize hashes the last bytes (less than 32) and mixes the result
+func xxHash64Finalize(h64 uint64, data []byte) uint64 {
+	end := len(data)
+	n := 0
 
 	for n+8 <= end {
 		h64 ^= xxHash64Round(0, binary.LittleEndian.Uint64(data[n:n+8]))
@@ -107,6 +118,86 @@ func (this *XXHash64) Hash(data []byte) uint64 {
 	return h64 ^ (h64 >> 32)
 }
 
+// XXHash64Digest computes the XXHash64 of data provided in several chunks.
+// The result is the same as XXHash64.Hash called with all the data.
+type XXHash64Digest struct {
+	seed   uint64
+	v      [4]uint64
+	buf    [32]byte
+	bufLen int
+	total  uint64
+}
+
+// NewXXHash64Digest creates a new instance of XXHash64Digest
+func NewXXHash64Digest(seed uint64) *XXHash64Digest {
+	this := &XXHash64Digest{seed: seed}
+	this.Reset()
+	return this
+}
+
+// Reset discards the data hashed so far
+func (this *XXHash64Digest) Reset() {
+	this.v[0] = this.seed + _XXHASH_PRIME64_1 + _XXHASH_PRIME64_2
+	this.v[1] = this.seed + _XXHASH_PRIME64_2
+	this.v[2] = this.seed
+	this.v[3] = this.seed - _XXHASH_PRIME64_1
+	this.bufLen = 0
+	this.total = 0
+}
+
+// Write adds data to the hash. Never fails.
+func (this *XXHash64Digest) Write(data []byte) (int, error) {
+	length := len(data)
+	this.total += uint64(length)
+
+	if this.bufLen > 0 {
+		n := copy(this.buf[this.bufLen:], data)
+		this.bufLen += n
+		data = data[n:]
+
+		if this.bufLen < 32 {
+			return length, nil
+		}
+
+		this.update(this.buf[:])
+		this.bufLen = 0
+	}
+
+	for len(data) >= 32 {
+		this.update(data[0:32])
+		data = data[32:]
+	}
+
+	this.bufLen = copy(this.buf[:], data)
+	return length, nil
+}
+
+func (this *XXHash64Digest) update(buf []byte) {
+	this.v[0] = xxHash64Round(this.v[0], binary.LittleEndian.Uint64(buf[0:8]))
+	this.v[1] = xxHash64Round(this.v[1], binary.LittleEndian.Uint64(buf[8:16]))
+	this.v[2] = xxHash64Round(this.v[2], binary.LittleEndian.Uint64(buf[16:24]))
+	this.v[3] = xxHash64Round(this.v[3], binary.LittleEndian.Uint64(buf[24:32]))
+}
+
+// Size returns the number of bytes hashed so far
+func (this *XXHash64Digest) Size() uint64 {
+	return this.total
+}
+
+// Sum64 returns the hash of the data written so far
+func (this *XXHash64Digest) Sum64() uint64 {
+	var h64 uint64
+
+	if this.total >= 32 {
+		h64 = xxHash64Merge(this.v[0], this.v[1], this.v[2], this.v[3])
+	} else {
+		h64 = this.seed + _XXHASH_PRIME64_5
+	}
+
+	h64 += this.total
+	return xxHash64Finalize(h64, this.buf[0:this.bufLen])
+}
+
 func xxHash64Round(acc, val uint64) uint64 {
 	acc += (val * _XXHASH_PRIME64_2)
 	return ((acc << 31) | (acc >> 33)) * _XXHASH_PRIME64_1
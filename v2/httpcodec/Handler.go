@@ -0,0 +1,250 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package httpcodec provides the 'kanzi' HTTP content encoding: a handler
+// compressing the responses of a server and a transport decompressing the
+// responses of a client.
+package httpcodec
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+const (
+	// ENCODING is the name of the content encoding
+	ENCODING = "kanzi"
+
+	_DEFAULT_BLOCK_SIZE = 1024 * 1024
+)
+
+// Handler compresses the responses of the wrapped handler if the client
+// accepts the 'kanzi' content encoding
+type Handler struct {
+	next      http.Handler
+	transform string
+	entropy   string
+	blockSize uint
+	jobs      uint
+}
+
+// NewHandler creates a new instance of Handler. The level is in [0..9] (see
+// io.GetLevelCodecs) and the block size is 1 MB if 0 is provided.
+func NewHandler(next http.Handler, level int, blockSize, jobs uint) (*Handler, error) {
+	if next == nil {
+		return nil, fmt.Errorf("Invalid null handler parameter")
+	}
+
+	if blockSize == 0 {
+		blockSize = _DEFAULT_BLOCK_SIZE
+	}
+
+	this := &Handler{next: next, blockSize: blockSize, jobs: jobs}
+	var err error
+
+	if this.transform, this.entropy, err = kio.GetLevelCodecs(level); err != nil {
+		return nil, err
+	}
+
+	// Validate the parameters once
+	null, _ := kio.NewNullOutputStream()
+
+	if _, err = kio.NewWriterWithCtx(null, this.writerCtx()); err != nil {
+		return nil, err
+	}
+
+	return this, nil
+}
+
+func (this *Handler) writerCtx() map[string]any {
+	return map[string]any{
+		"transform": this.transform,
+		"entropy":   this.entropy,
+		"blockSize": this.blockSize,
+		"jobs":      this.jobs,
+		"checksum":  uint(0),
+	}
+}
+
+// ServeHTTP calls the wrapped handler with a response writer compressing the
+// body if the request accepts the 'kanzi' content encoding
+func (this *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+
+	if AcceptsEncoding(req.Header.Get("Accept-Encoding")) == false {
+		this.next.ServeHTTP(w, req)
+		return
+	}
+
+	cw := &compressWriter{ResponseWriter: w, handler: this, head: req.Method == http.MethodHead}
+	defer cw.close()
+	this.next.ServeHTTP(cw, req)
+}
+
+// AcceptsEncoding returns true if the value of an Accept-Encoding header
+// lists the 'kanzi' content encoding with a non zero quality
+func AcceptsEncoding(header string) bool {
+	for _, token := range strings.Split(header, ",") {
+		params := strings.Split(token, ";")
+
+		if strings.EqualFold(strings.TrimSpace(params[0]), ENCODING) == false {
+			continue
+		}
+
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+
+			if strings.HasPrefix(p, "q=") {
+				if q, err := strconv.ParseFloat(p[2:], 64); err != nil || q <= 0 {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// compressWriter is the response writer passed to the wrapped handler. The
+// decision to compress is made when the header is written: the body is not
+// compressed if the handler has set a content encoding, if the response is
+// partial (Content-Range) or if the response has no body. The header of a
+// compressed response is sent with the first encoded bytes so that the
+// content type can be sniffed from the plain body.
+type compressWriter struct {
+	http.ResponseWriter
+	handler     *Handler
+	writer      *kio.Writer
+	head        bool
+	wroteHeader bool
+	sentHeader  bool
+	status      int
+	err         error
+}
+
+func (this *compressWriter) WriteHeader(status int) {
+	if this.wroteHeader == true {
+		return
+	}
+
+	this.wroteHeader = true
+	h := this.Header()
+	hasBody := this.head == false && status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+
+	// Ranges apply to the plain representation: do not encode partial responses
+	if hasBody == true && h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		status != http.StatusPartialContent {
+		h.Set("Content-Encoding", ENCODING)
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+
+		// Strong validators do not apply to the encoded representation
+		if etag := h.Get("ETag"); len(etag) > 0 && strings.HasPrefix(etag, "W/") == false {
+			h.Set("ETag", "W/"+etag)
+		}
+
+		this.writer, this.err = kio.NewWriterWithCtx(&bodyWriter{this}, this.handler.writerCtx())
+
+		if this.err == nil {
+			// Wait for the body to sniff the content type
+			this.status = status
+			return
+		}
+	}
+
+	this.sentHeader = true
+	this.ResponseWriter.WriteHeader(status)
+}
+
+// sendHeader writes the delayed header of a compressed response
+func (this *compressWriter) sendHeader() {
+	if this.sentHeader == false {
+		this.sentHeader = true
+		this.ResponseWriter.WriteHeader(this.status)
+	}
+}
+
+func (this *compressWriter) Write(buf []byte) (int, error) {
+	if this.wroteHeader == false {
+		this.WriteHeader(http.StatusOK)
+	}
+
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	if this.writer == nil {
+		return this.ResponseWriter.Write(buf)
+	}
+
+	if this.sentHeader == false && len(buf) > 0 {
+		// Same as net/http but using the plain body instead of the encoded one
+		if _, hasType := this.Header()["Content-Type"]; hasType == false {
+			this.Header().Set("Content-Type", http.DetectContentType(buf))
+		}
+	}
+
+	return this.writer.Write(buf)
+}
+
+// Flush compresses the buffered data in a short block and sends it to the
+// client (streaming responses)
+func (this *compressWriter) Flush() {
+	if this.wroteHeader == false {
+		this.WriteHeader(http.StatusOK)
+	}
+
+	if this.writer != nil && this.err == nil {
+		this.err = this.writer.Flush()
+	}
+
+	this.sendHeader()
+
+	if f, ok := this.ResponseWriter.(http.Flusher); ok == true {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the original response writer (see http.ResponseController)
+func (this *compressWriter) Unwrap() http.ResponseWriter {
+	return this.ResponseWriter
+}
+
+func (this *compressWriter) close() {
+	if this.writer != nil {
+		this.writer.Close()
+		this.sendHeader()
+	}
+}
+
+// bodyWriter writes the encoded body to the response, after the header
+type bodyWriter struct {
+	cw *compressWriter
+}
+
+func (this *bodyWriter) Write(buf []byte) (int, error) {
+	this.cw.sendHeader()
+	return this.cw.ResponseWriter.Write(buf)
+}
+
+func (this *bodyWriter) Close() error {
+	return nil
+}
@@ -0,0 +1,220 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpcodec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+func TestAcceptsEncoding(b *testing.T) {
+	fmt.Println("Test - Accept-Encoding negotiation")
+	values := map[string]bool{
+		"":                     false,
+		"gzip, deflate":        false,
+		"kanzi":                true,
+		"gzip, KANZI":          true,
+		"gzip;q=1, kanzi;q=0":  false,
+		"kanzi;q=0.5, br":      true,
+		"kanzio":               false,
+		"gzip, kanzi ; q=0.00": false,
+	}
+
+	for header, expected := range values {
+		if AcceptsEncoding(header) != expected {
+			b.Errorf("Invalid negotiation for '%s': expected %t", header, expected)
+		}
+	}
+}
+
+func TestHandler(b *testing.T) {
+	fmt.Println("Test - compressed responses")
+	body := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20000))
+	handler, err := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", fmt.Sprint(len(body)))
+		w.Write(body)
+	}), 3, 64*1024, 2)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	if _, err := NewHandler(handler, 10, 0, 1); err == nil {
+		b.Error("Expected error with invalid level")
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Raw response
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip, kanzi")
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	raw, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != ENCODING || resp.Header.Get("Vary") != "Accept-Encoding" {
+		b.Fatalf("Invalid response headers: %v", resp.Header)
+	}
+
+	r, _ := kio.NewReaderWithCtx(io.NopCloser(bytes.NewReader(raw)), map[string]any{"jobs": uint(1)})
+
+	if decoded, err := io.ReadAll(r); err != nil || bytes.Equal(decoded, body) == false {
+		b.Fatalf("Invalid compressed body: %v", err)
+	}
+
+	fmt.Printf("%d => %d bytes\n", len(body), len(raw))
+
+	// Through the transport
+	transport, _ := NewTransport(nil, 2)
+	client := &http.Client{Transport: transport}
+
+	if resp, err = client.Get(server.URL); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	decoded, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil || bytes.Equal(decoded, body) == false || resp.Uncompressed == false ||
+		resp.Header.Get("Content-Encoding") != "" || resp.ContentLength != -1 {
+		b.Fatalf("Invalid decompressed response: %v", err)
+	}
+
+	// Client not accepting the encoding
+	req.Header.Set("Accept-Encoding", "identity")
+
+	if resp, err = http.DefaultTransport.RoundTrip(req); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	raw, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if resp.Header.Get("Content-Encoding") != "" || bytes.Equal(raw, body) == false {
+		b.Fatal("Expected identity response")
+	}
+}
+
+func TestStreamingHandler(b *testing.T) {
+	fmt.Println("Test - flushed streaming responses")
+	next := make(chan bool)
+	handler, _ := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		for i := 0; i < 3; i++ {
+			fmt.Fprintf(w, "event %d\n", i)
+			w.(http.Flusher).Flush()
+
+			// Wait for the client to receive the event
+			select {
+			case <-next:
+			case <-time.After(5 * time.Second):
+				return
+			}
+		}
+	}), 2, 0, 1)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	transport, _ := NewTransport(nil, 1)
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	defer resp.Body.Close()
+	buf := make([]byte, 64)
+
+	for i := 0; i < 3; i++ {
+		expected := fmt.Sprintf("event %d\n", i)
+		n, err := io.ReadAtLeast(resp.Body, buf, len(expected))
+
+		if err != nil || string(buf[0:n]) != expected {
+			b.Fatalf("Invalid event %d: '%s' (%v)", i, buf[0:n], err)
+		}
+
+		next <- true
+	}
+
+	if n, err := resp.Body.Read(buf); n != 0 || err != io.EOF {
+		b.Fatalf("Expected end of stream, got %d bytes (%v)", n, err)
+	}
+}
+
+func TestHandlerHeaders(b *testing.T) {
+	fmt.Println("Test - sniffed content type and partial responses")
+	page := []byte("<html><body>" + strings.Repeat("<p>Hello</p>", 1000) + "</body></html>")
+	handler, _ := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/range" {
+			http.ServeContent(w, req, "page.txt", time.Time{}, bytes.NewReader(page))
+			return
+		}
+
+		// No content type: sniffed from the body
+		w.WriteHeader(http.StatusOK)
+		w.Write(page)
+	}), 2, 0, 1)
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	transport, _ := NewTransport(nil, 1)
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get(server.URL)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	decoded, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil || bytes.Equal(decoded, page) == false || resp.Uncompressed == false {
+		b.Fatalf("Invalid decompressed response: %v", err)
+	}
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		b.Fatalf("Invalid content type: %s", ct)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/range", nil)
+	req.Header.Set("Range", "bytes=100-199")
+
+	if resp, err = client.Do(req); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	decoded, err = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if err != nil || resp.StatusCode != http.StatusPartialContent || resp.Uncompressed == true ||
+		bytes.Equal(decoded, page[100:200]) == false {
+		b.Fatalf("Invalid partial response: %d, %v", resp.StatusCode, err)
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package httpcodec
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+// Transport is an http.RoundTripper requesting the 'kanzi' content encoding
+// and decompressing the response bodies transparently
+type Transport struct {
+	base http.RoundTripper
+	jobs uint
+}
+
+// NewTransport creates a new instance of Transport sending the requests with
+// base (http.DefaultTransport if nil). The readers using several jobs decode
+// batches of blocks: use 1 job to receive flushed data without delay
+// (streaming responses).
+func NewTransport(base http.RoundTripper, jobs uint) (*Transport, error) {
+	if jobs == 0 {
+		return nil, fmt.Errorf("Invalid number of jobs: %d", jobs)
+	}
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &Transport{base: base, jobs: jobs}, nil
+}
+
+// RoundTrip sends the request with an Accept-Encoding header (unless already
+// set by the caller) and decompresses the body of a 'kanzi' encoded response.
+// The Content-Encoding and Content-Length headers of a decompressed response
+// are removed and Uncompressed is set.
+func (this *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		// Do not modify the request of the caller
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", ENCODING)
+	}
+
+	resp, err := this.base.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(resp.Header.Get("Content-Encoding")), ENCODING) == false {
+		return resp, nil
+	}
+
+	if req.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+
+	body := &decompressReader{body: resp.Body, jobs: this.jobs}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// decompressReader creates the reader on the first read so that RoundTrip
+// does not block waiting for the stream header
+type decompressReader struct {
+	body   io.ReadCloser
+	reader *kio.Reader
+	jobs   uint
+	err    error
+}
+
+func (this *decompressReader) Read(buf []byte) (int, error) {
+	if this.reader == nil && this.err == nil {
+		this.reader, this.err = kio.NewReaderWithCtx(this.body, map[string]any{"jobs": this.jobs})
+	}
+
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	return this.reader.Read(buf)
+}
+
+func (this *decompressReader) Close() error {
+	if this.reader != nil {
+		this.reader.Close()
+	}
+
+	return this.body.Close()
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// An archive packs several files in one stream. It is usually written to and
+// read from a compressed stream, so that small files share blocks. The file
+// table comes first, followed by the content of the regular files in the order
+// of the table:
+//
+// 'KNZA' (32 bits) | version (8 bits) | number of entries (varint) | entries | data
+//
+// Entry:
+// name length (varint) | name | type (8 bits) | permissions (varint) |
+// mtime (varint, ns since epoch) | size (varint, file) or link target (varint length + bytes, symlink)
+//
+// Names are relative paths with '/' separators (see fs.ValidPath).
+
+const (
+	_ARCHIVE_MAGIC       = 0x4B4E5A41 // "KNZA"
+	_ARCHIVE_VERSION     = 1
+	_ARCHIVE_FILE        = 0
+	_ARCHIVE_SYMLINK     = 1
+	_ARCHIVE_MAX_ENTRIES = 1 << 24
+	_ARCHIVE_MAX_NAME    = 4096
+)
+
+// ArchiveEntry describes a file stored in an archive
+type ArchiveEntry struct {
+	Name    string      // relative path with '/' separators
+	Mode    fs.FileMode // permissions, plus fs.ModeSymlink for links
+	ModTime time.Time
+	Size    int64  // size of the content (regular files)
+	Link    string // target of the link (symlinks)
+}
+
+// IsSymlink returns true if the entry is a symbolic link
+func (this *ArchiveEntry) IsSymlink() bool {
+	return this.Mode&fs.ModeSymlink != 0
+}
+
+// ArchiveWriter writes a file table and the content of the files in the order
+// of the table.
+type ArchiveWriter struct {
+	w         io.Writer
+	entries   []ArchiveEntry
+	current   int
+	remaining int64
+}
+
+// NewArchiveWriter writes the file table to w and returns a writer for the
+// content of the files.
+func NewArchiveWriter(w io.Writer, entries []ArchiveEntry) (*ArchiveWriter, error) {
+	if w == nil {
+		return nil, &IOError{msg: "Invalid null writer parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if len(entries) > _ARCHIVE_MAX_ENTRIES {
+		errMsg := fmt.Sprintf("Too many archive entries: %d (max %d)", len(entries), _ARCHIVE_MAX_ENTRIES)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	buf := binary.BigEndian.AppendUint32(make([]byte, 0, 256), _ARCHIVE_MAGIC)
+	buf = append(buf, _ARCHIVE_VERSION)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+
+	for i := range entries {
+		e := &entries[i]
+
+		if len(e.Name) > _ARCHIVE_MAX_NAME || fs.ValidPath(e.Name) == false || e.Name == "." {
+			return nil, &IOError{msg: fmt.Sprintf("Invalid archive entry name: '%s'", e.Name), code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(len(e.Name)))
+		buf = append(buf, e.Name...)
+
+		if e.IsSymlink() == true {
+			if len(e.Link) == 0 || len(e.Link) > _ARCHIVE_MAX_NAME {
+				return nil, &IOError{msg: fmt.Sprintf("Invalid link target for entry '%s'", e.Name), code: kanzi.ERR_INVALID_PARAM}
+			}
+
+			buf = append(buf, _ARCHIVE_SYMLINK)
+		} else {
+			if e.Size < 0 {
+				return nil, &IOError{msg: fmt.Sprintf("Invalid size for entry '%s'", e.Name), code: kanzi.ERR_INVALID_PARAM}
+			}
+
+			buf = append(buf, _ARCHIVE_FILE)
+		}
+
+		buf = binary.AppendUvarint(buf, uint64(e.Mode.Perm()))
+		buf = binary.AppendVarint(buf, e.ModTime.UnixNano())
+
+		if e.IsSymlink() == true {
+			buf = binary.AppendUvarint(buf, uint64(len(e.Link)))
+			buf = append(buf, e.Link...)
+		} else {
+			buf = binary.AppendUvarint(buf, uint64(e.Size))
+		}
+	}
+
+	if _, err := w.Write(buf); err != nil {
+		return nil, err
+	}
+
+	this := &ArchiveWriter{w: w, entries: entries, current: -1}
+	return this, nil
+}
+
+// Next moves to the next entry of the table and returns it. The content of the
+// previous entry must have been fully written. Returns io.EOF after the last entry.
+func (this *ArchiveWriter) Next() (*ArchiveEntry, error) {
+	if this.remaining != 0 {
+		e := &this.entries[this.current]
+		errMsg := fmt.Sprintf("Missing %d byte(s) of content for entry '%s'", this.remaining, e.Name)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if this.current+1 >= len(this.entries) {
+		this.current = len(this.entries)
+		return nil, io.EOF
+	}
+
+	this.current++
+	e := &this.entries[this.current]
+
+	if e.IsSymlink() == false {
+		this.remaining = e.Size
+	}
+
+	return e, nil
+}
+
+// Write writes content of the current entry. Fails if the content exceeds the
+// size of the entry.
+func (this *ArchiveWriter) Write(p []byte) (int, error) {
+	if int64(len(p)) > this.remaining {
+		errMsg := "Content exceeds the size of the archive entry"
+
+		if this.current >= 0 && this.current < len(this.entries) {
+			errMsg = fmt.Sprintf("Content exceeds the size of entry '%s'", this.entries[this.current].Name)
+		}
+
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_WRITE_FILE}
+	}
+
+	n, err := this.w.Write(p)
+	this.remaining -= int64(n)
+	return n, err
+}
+
+// Close checks that the content of all the entries has been written.
+// The underlying writer is not closed.
+func (this *ArchiveWriter) Close() error {
+	for {
+		if _, err := this.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
+
+// ArchiveReader reads the file table and the content of the files of an archive.
+type ArchiveReader struct {
+	r         *countingReader
+	entries   []ArchiveEntry
+	current   int
+	remaining int64
+}
+
+// NewArchiveReader reads the file table from r and returns a reader for the
+// content of the files.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	if r == nil {
+		return nil, &IOError{msg: "Invalid null reader parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	this := &ArchiveReader{r: &countingReader{r: bufio.NewReader(r)}, current: -1}
+	var err error
+
+	if this.entries, err = this.readTable(); err != nil {
+		if ioerr, isIOErr := err.(*IOError); isIOErr == true {
+			return nil, ioerr
+		}
+
+		errMsg := fmt.Sprintf("Invalid archive file table: %v", err)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE, err: err}
+	}
+
+	return this, nil
+}
+
+func (this *ArchiveReader) readTable() ([]ArchiveEntry, error) {
+	var header [5]byte
+
+	if _, err := io.ReadFull(this.r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if binary.BigEndian.Uint32(header[0:]) != _ARCHIVE_MAGIC {
+		return nil, &IOError{msg: "Invalid archive: missing magic", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	if header[4] != _ARCHIVE_VERSION {
+		errMsg := fmt.Sprintf("Unsupported archive version: %d", header[4])
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_STREAM_VERSION}
+	}
+
+	count, err := binary.ReadUvarint(this.r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if count > _ARCHIVE_MAX_ENTRIES {
+		return nil, fmt.Errorf("too many entries: %d", count)
+	}
+
+	// The count is not trusted: grow the table as the entries are read
+	entries := make([]ArchiveEntry, 0, min(count, 1024))
+	names := make(map[string]bool, min(count, 1024))
+
+	for i := uint64(0); i < count; i++ {
+		var e ArchiveEntry
+
+		if e.Name, err = this.readString(); err != nil {
+			return nil, err
+		}
+
+		// Reject absolute paths and '..' components
+		if fs.ValidPath(e.Name) == false || e.Name == "." || names[e.Name] == true {
+			return nil, fmt.Errorf("invalid entry name: '%s'", e.Name)
+		}
+
+		names[e.Name] = true
+		entryType, err := this.r.ReadByte()
+
+		if err != nil {
+			return nil, err
+		}
+
+		perm, err := binary.ReadUvarint(this.r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		mtime, err := binary.ReadVarint(this.r)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e.Mode = fs.FileMode(perm) & fs.ModePerm
+		e.ModTime = time.Unix(0, mtime)
+
+		switch entryType {
+		case _ARCHIVE_FILE:
+			size, err := binary.ReadUvarint(this.r)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if size > 1<<62 {
+				return nil, fmt.Errorf("invalid size for entry '%s': %d", e.Name, size)
+			}
+
+			e.Size = int64(size)
+
+		case _ARCHIVE_SYMLINK:
+			if e.Link, err = this.readString(); err != nil {
+				return nil, err
+			}
+
+			if len(e.Link) == 0 {
+				return nil, fmt.Errorf("missing link target for entry '%s'", e.Name)
+			}
+
+			e.Mode |= fs.ModeSymlink
+
+		default:
+			return nil, fmt.Errorf("invalid type for entry '%s': %d", e.Name, entryType)
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+func (this *ArchiveReader) readString() (string, error) {
+	length, err := binary.ReadUvarint(this.r)
+
+	if err != nil {
+		return "", err
+	}
+
+	if length == 0 || length > _ARCHIVE_MAX_NAME {
+		return "", fmt.Errorf("invalid name length: %d", length)
+	}
+
+	buf := make([]byte, length)
+
+	if _, err = io.ReadFull(this.r, buf); err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// Entries returns the file table
+func (this *ArchiveReader) Entries() []ArchiveEntry {
+	return this.entries
+}
+
+// Next skips the rest of the current entry and returns the next one.
+// Returns io.EOF after the last entry.
+func (this *ArchiveReader) Next() (*ArchiveEntry, error) {
+	if this.remaining > 0 {
+		if _, err := io.CopyN(io.Discard, this.r, this.remaining); err != nil {
+			return nil, this.truncated(err)
+		}
+
+		this.remaining = 0
+	}
+
+	if this.current+1 >= len(this.entries) {
+		this.current = len(this.entries)
+		return nil, io.EOF
+	}
+
+	this.current++
+	e := &this.entries[this.current]
+
+	if e.IsSymlink() == false {
+		this.remaining = e.Size
+	}
+
+	return e, nil
+}
+
+// Read reads the content of the current entry. Returns io.EOF at the end
+// of the entry.
+func (this *ArchiveReader) Read(p []byte) (int, error) {
+	if this.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > this.remaining {
+		p = p[0:this.remaining]
+	}
+
+	n, err := this.r.Read(p)
+	this.remaining -= int64(n)
+
+	if err == io.EOF && this.remaining > 0 {
+		return n, this.truncated(io.ErrUnexpectedEOF)
+	}
+
+	return n, err
+}
+
+func (this *ArchiveReader) truncated(err error) error {
+	if _, isIOErr := err.(*IOError); isIOErr == true {
+		return err
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	errMsg := fmt.Sprintf("Truncated archive: %v", err)
+	return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE, err: err}
+}
+
+// countingReader counts the bytes consumed from the archive (the content of
+// the first entry starts after the file table)
+type countingReader struct {
+	r     *bufio.Reader
+	count int64
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	n, err := this.r.Read(p)
+	this.count += int64(n)
+	return n, err
+}
+
+func (this *countingReader) ReadByte() (byte, error) {
+	b, err := this.r.ReadByte()
+
+	if err == nil {
+		this.count++
+	}
+
+	return b, err
+}
@@ -0,0 +1,207 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// Automatic codec selection: each block is encoded with every candidate
+// pipeline (transform + entropy codec) and the smallest output is kept.
+// The chosen entropy type (5 bits) and transform types (48 bits) are written
+// at the beginning of each block when the header flag _HEADER_FLAG_AUTO is set.
+//
+// The candidates are provided in the context as "autoCandidates", a comma
+// separated list of pipelines (EG. "LZ&HUFFMAN,TEXT+UTF+BWT+RANK+ZRLT&ANS0").
+// The optional "autoBudget" (uint, in milliseconds) limits the time spent
+// per block trying candidates (the first candidate is always tried).
+
+const (
+	_AUTO_TRIAL_BUFFERS = 3 // copy of the block and output buffers of the trials
+)
+
+type autoCandidate struct {
+	transformType uint64
+	entropyType   uint32
+}
+
+// parseCandidates parses a comma separated list of 'transform&entropy' pipelines
+func parseCandidates(candidates string) ([]autoCandidate, error) {
+	tokens := strings.Split(candidates, ",")
+	res := make([]autoCandidate, 0, len(tokens))
+
+	for _, token := range tokens {
+		token = strings.TrimSpace(token)
+
+		if len(token) == 0 {
+			continue
+		}
+
+		pipeline := strings.Split(token, "&")
+
+		if len(pipeline) != 2 {
+			return nil, fmt.Errorf("Invalid codec candidate: '%s' (must be 'transform&entropy')", token)
+		}
+
+		tType, err := transform.GetType(pipeline[0])
+
+		if err != nil {
+			return nil, err
+		}
+
+		eType, err := entropy.GetType(pipeline[1])
+
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, autoCandidate{transformType: tType, entropyType: eType})
+	}
+
+	if len(res) == 0 {
+		return nil, fmt.Errorf("Invalid codec candidates: '%s'", candidates)
+	}
+
+	return res, nil
+}
+
+// setCodecNames updates the names of the codecs in the context. Some
+// transforms depend on the entropy codec (EG. TEXT).
+func setCodecNames(ctx map[string]any, transformType uint64, entropyType uint32) error {
+	tName, err := transform.GetName(transformType)
+
+	if err != nil {
+		return err
+	}
+
+	eName, err := entropy.GetName(entropyType)
+
+	if err != nil {
+		return err
+	}
+
+	ctx["transform"] = tName
+	ctx["entropy"] = eName
+	return nil
+}
+
+// selectCandidate encodes the block with each candidate pipeline (within the
+// time budget) and sets the block transform and entropy types to the ones
+// yielding the smallest output. The trial buffers of the task are reused
+// across blocks.
+func (this *encodingTask) selectCandidate(data []byte) {
+	start := time.Now()
+	best := this.candidates[0]
+	bestSize := uint64(0)
+
+	if len(this.trialBuffers[0].Buf) < int(this.blockLength) {
+		this.trialBuffers[0].Buf = make([]byte, this.blockLength)
+	}
+
+	src := this.trialBuffers[0].Buf[0:this.blockLength]
+
+	for i, c := range this.candidates {
+		if i > 0 && this.autoBudget > 0 && time.Since(start) >= this.autoBudget {
+			break
+		}
+
+		copy(src, data[0:this.blockLength])
+		size, err := this.trialEncode(src, &this.trialBuffers[1].Buf, &this.trialBuffers[2].Buf, c)
+
+		if err != nil {
+			continue
+		}
+
+		if bestSize == 0 || size < bestSize {
+			best = c
+			bestSize = size
+		}
+	}
+
+	this.blockTransformType = best.transformType
+	this.blockEntropyType = best.entropyType
+}
+
+// trialEncode returns the size in bits of the block encoded with the candidate.
+// The content of src is modified.
+func (this *encodingTask) trialEncode(src []byte, buf1, buf2 *[]byte, c autoCandidate) (uint64, error) {
+	ctx := make(map[string]any, len(this.ctx))
+
+	for k, v := range this.ctx {
+		ctx[k] = v
+	}
+
+	if err := setCodecNames(ctx, c.transformType, c.entropyType); err != nil {
+		return 0, err
+	}
+
+	ctx["size"] = this.blockLength
+	t, err := transform.New(&ctx, c.transformType)
+
+	if err != nil {
+		return 0, err
+	}
+
+	requiredSize := t.MaxEncodedLen(int(this.blockLength))
+	setDataType(ctx, src)
+
+	if len(*buf1) < requiredSize {
+		*buf1 = make([]byte, requiredSize)
+	}
+
+	if len(*buf2) < requiredSize {
+		*buf2 = make([]byte, requiredSize)
+	}
+
+	_, postTransformLength, _ := t.Forward(src[0:this.blockLength], *buf1)
+	ctx["size"] = postTransformLength
+	bufStream := internal.NewBufferStream((*buf2)[0:0:cap(*buf2)])
+	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
+	var ee kanzi.EntropyEncoder
+
+	if ee, err = entropy.NewEntropyEncoder(obs, ctx, c.entropyType); err != nil {
+		return 0, err
+	}
+
+	if _, err = ee.Write((*buf1)[0:postTransformLength]); err != nil {
+		return 0, err
+	}
+
+	ee.Dispose()
+	obs.Close()
+	return obs.Written(), nil
+}
+
+// setDataType records the type of data in the context based on its magic
+func setDataType(ctx map[string]any, data []byte) {
+	magic := internal.GetMagicType(data)
+
+	if internal.IsDataCompressed(magic) == true {
+		ctx["dataType"] = internal.DT_BIN
+	} else if internal.IsDataMultimedia(magic) == true {
+		ctx["dataType"] = internal.DT_MULTIMEDIA
+	} else if internal.IsDataExecutable(magic) == true {
+		ctx["dataType"] = internal.DT_EXE
+	}
+}
@@ -0,0 +1,647 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+)
+
+// The block index is appended to the stream after the end block when the
+// 'blockIndex' option is provided to the Writer. It is byte aligned:
+//
+// 'KIDX' (32 bits) | number of blocks (32 bits)
+// then for each block:
+// offset in bits (64 bits) | compressed size in bits (64 bits) | original size (32 bits)
+// then a fixed size footer:
+// offset of the index in bytes (64 bits) | 'KIDX' (32 bits)
+//
+// Streams without an index are scanned once, reading the block sizes only.
+// The original size of the blocks ending a flush (see Writer.Flush) and of
+// the last block is read from the block header or, if a transform was
+// applied, by decoding the block.
+
+const (
+	_BLOCK_INDEX_MAGIC       = 0x4B494458 // "KIDX"
+	_BLOCK_INDEX_ENTRY_SIZE  = 20
+	_BLOCK_INDEX_FOOTER_SIZE = 12
+)
+
+// BlockIndexEntry describes the location of one block in a compressed stream
+type BlockIndexEntry struct {
+	Offset       uint64 // offset of the block in the compressed stream (in bits)
+	Size         uint64 // size of the compressed block (in bits)
+	Position     int64  // offset of the block in the decompressed stream (in bytes)
+	OriginalSize uint32 // size of the decompressed block (in bytes)
+}
+
+// NewReaderAt creates a new instance of Reader with random access capabilities.
+// The reader reads compressed data blocks from the first 'size' bytes of ra.
+// The blocks are located using the index stored at the end of the stream or,
+// if missing, using a one time scan of the block headers. Then, each decoding
+// task reads its own block concurrently. Seek and ReadAt are supported.
+func NewReaderAt(ra io.ReaderAt, size int64, ctx map[string]any) (*Reader, error) {
+	if ra == nil {
+		return nil, &IOError{msg: "Invalid null input parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	if size < 0 {
+		return nil, &IOError{msg: "Invalid negative size parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	sr := io.NewSectionReader(ra, 0, size)
+	this, err := NewReaderWithCtx(io.NopCloser(sr), ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	this.ra = sr
+	return this, nil
+}
+
+// HasIndex reads the stream header and reports whether a block index
+// is appended to the stream.
+func (this *Reader) HasIndex() (bool, error) {
+	if err := this.readHeader(); err != nil {
+		return false, err
+	}
+
+	return this.flags&_HEADER_FLAG_INDEX != 0, nil
+}
+
+// Index returns the list of blocks in the stream. Only available
+// for readers created with NewReaderAt.
+func (this *Reader) Index() ([]BlockIndexEntry, error) {
+	if err := this.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	res := make([]BlockIndexEntry, len(this.index))
+	copy(res, this.index)
+	return res, nil
+}
+
+// Seek sets the offset in the decompressed stream for the next Read.
+// Only available for readers created with NewReaderAt.
+// Returns the new offset relative to the start of the decompressed stream.
+func (this *Reader) Seek(offset int64, whence int) (int64, error) {
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
+	}
+
+	if err := this.buildIndex(); err != nil {
+		return 0, err
+	}
+
+	var pos int64
+
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = this.position + offset
+	case io.SeekEnd:
+		pos = this.totalSize() + offset
+	default:
+		return 0, &IOError{msg: fmt.Sprintf("Invalid whence value: %d", whence), code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if pos < 0 {
+		return 0, &IOError{msg: "Invalid negative position", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if pos != this.position || this.seekPending == true {
+		this.position = pos
+		this.seekPending = true
+
+		// The content checksum requires a sequential read of the whole stream
+		this.digest = nil
+	}
+
+	return pos, nil
+}
+
+// ReadAt reads len(block) bytes of the decompressed stream starting at
+// offset off. Only the blocks overlapping the requested range are decoded.
+// Only available for readers created with NewReaderAt.
+// Safe for concurrent use (but not concurrently with Read or Seek).
+func (this *Reader) ReadAt(block []byte, off int64) (int, error) {
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
+	}
+
+	if off < 0 {
+		return 0, &IOError{msg: "Invalid negative offset", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if err := this.buildIndex(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	for idx := this.findBlock(off); n < len(block) && idx < len(this.index); idx++ {
+		if err := contextError(this.cancelCtx); err != nil {
+			return n, err
+		}
+
+		data, err := this.blockData(idx)
+
+		if err != nil {
+			return n, err
+		}
+
+		skip := int(off + int64(n) - this.index[idx].Position)
+		n += copy(block[n:], data[skip:])
+	}
+
+	if n < len(block) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// blockData decodes the block at position idx in the index
+func (this *Reader) blockData(idx int) ([]byte, error) {
+	data, err := this.decodeBlock(this.index[idx], idx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) != int(this.index[idx].OriginalSize) {
+		errMsg := fmt.Sprintf("Invalid block index: block %d has size %d, expected %d", idx+1,
+			len(data), this.index[idx].OriginalSize)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	return data, nil
+}
+
+// seekTo decodes the blocks starting with the block containing pos.
+func (this *Reader) seekTo(pos int64) error {
+	this.seekPending = false
+
+	if err := this.buildIndex(); err != nil {
+		return err
+	}
+
+	this.available = 0
+	this.consumed = 0
+	idx := this.findBlock(pos)
+
+	if idx == len(this.index) {
+		// Past the end of the stream
+		atomic.StoreInt32(&this.blockID, _CANCEL_TASKS_ID)
+		return nil
+	}
+
+	// The blocks are located using the index, no need to reposition the bitstream
+	atomic.StoreInt32(&this.blockID, int32(idx))
+	decoded, err := this.processBlock()
+
+	if err != nil {
+		return err
+	}
+
+	skip := pos - this.index[idx].Position
+
+	if decoded < skip {
+		return &IOError{msg: "Invalid block index", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this.available = decoded - skip
+	this.consumed = int(skip)
+	return nil
+}
+
+// findBlock returns the index of the block containing pos
+// (or the number of blocks if pos is past the end of the stream)
+func (this *Reader) findBlock(pos int64) int {
+	return sort.Search(len(this.index), func(i int) bool {
+		return this.index[i].Position+int64(this.index[i].OriginalSize) > pos
+	})
+}
+
+func (this *Reader) totalSize() int64 {
+	if len(this.index) == 0 {
+		return 0
+	}
+
+	last := this.index[len(this.index)-1]
+	return last.Position + int64(last.OriginalSize)
+}
+
+func (this *Reader) buildIndex() error {
+	if this.ra == nil {
+		return &IOError{msg: "Random access requires a reader created with NewReaderAt", code: kanzi.ERR_READ_FILE}
+	}
+
+	this.indexLock.Lock()
+	defer this.indexLock.Unlock()
+
+	if this.index != nil {
+		return nil
+	}
+
+	if err := this.readHeader(); err != nil {
+		return err
+	}
+
+	var index []BlockIndexEntry
+	var err error
+
+	if this.flags&_HEADER_FLAG_INDEX != 0 {
+		index, err = this.readIndex()
+	}
+
+	if index == nil || err != nil {
+		// Missing or invalid index, fall back to scanning the block headers
+		if index, err = this.scanBlocks(); err != nil {
+			return err
+		}
+	}
+
+	this.index = index
+	return nil
+}
+
+func (this *Reader) readIndex() ([]BlockIndexEntry, error) {
+	size := this.ra.Size()
+
+	if size < _BLOCK_INDEX_FOOTER_SIZE {
+		return nil, &IOError{msg: "Missing block index", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	var footer [_BLOCK_INDEX_FOOTER_SIZE]byte
+
+	if _, err := this.ra.ReadAt(footer[:], size-_BLOCK_INDEX_FOOTER_SIZE); err != nil {
+		return nil, &IOError{msg: fmt.Sprintf("Cannot read block index: %v", err), code: kanzi.ERR_READ_FILE}
+	}
+
+	start := binary.BigEndian.Uint64(footer[0:8])
+
+	if binary.BigEndian.Uint32(footer[8:12]) != _BLOCK_INDEX_MAGIC || start+8 > uint64(size-_BLOCK_INDEX_FOOTER_SIZE) {
+		return nil, &IOError{msg: "Invalid block index", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	buf := make([]byte, uint64(size-_BLOCK_INDEX_FOOTER_SIZE)-start)
+
+	if _, err := this.ra.ReadAt(buf, int64(start)); err != nil {
+		return nil, &IOError{msg: fmt.Sprintf("Cannot read block index: %v", err), code: kanzi.ERR_READ_FILE}
+	}
+
+	count := int(binary.BigEndian.Uint32(buf[4:8]))
+	entries := buf[8:]
+
+	if this.cipher != nil {
+		// Encrypted entries
+		if len(entries) != count*_BLOCK_INDEX_ENTRY_SIZE+_CIPHER_TAG_SIZE || this.cipher.aead == nil {
+			return nil, &IOError{msg: "Invalid block index", code: kanzi.ERR_INVALID_FILE}
+		}
+
+		var err error
+
+		if entries, err = this.cipher.open(entries, int32(count)+2, true); err != nil {
+			return nil, &IOError{msg: "Cannot decrypt block index", code: kanzi.ERR_DECRYPTION, err: err}
+		}
+	}
+
+	if binary.BigEndian.Uint32(buf[0:4]) != _BLOCK_INDEX_MAGIC || len(entries) != count*_BLOCK_INDEX_ENTRY_SIZE {
+		return nil, &IOError{msg: "Invalid block index", code: kanzi.ERR_INVALID_FILE}
+	}
+
+	index := make([]BlockIndexEntry, count)
+	next := this.headerSize
+	position := int64(0)
+
+	for i := range index {
+		b := entries[i*_BLOCK_INDEX_ENTRY_SIZE:]
+		index[i].Offset = binary.BigEndian.Uint64(b[0:8])
+		index[i].Size = binary.BigEndian.Uint64(b[8:16])
+		index[i].OriginalSize = binary.BigEndian.Uint32(b[16:20])
+		index[i].Position = position
+		position += int64(index[i].OriginalSize)
+
+		// Blocks are contiguous
+		if index[i].Offset != next || index[i].Size == 0 || int(index[i].OriginalSize) > this.blockSize {
+			return nil, &IOError{msg: "Invalid block index", code: kanzi.ERR_INVALID_FILE}
+		}
+
+		next += index[i].Size
+	}
+
+	return index, nil
+}
+
+// scanBlocks builds the index by reading the size of each block. All blocks
+// are full blocks but the blocks ending a flush (marked by a size field one
+// bit longer than required) and the last one.
+func (this *Reader) scanBlocks() ([]BlockIndexEntry, error) {
+	index := make([]BlockIndexEntry, 0, max(this.nbInputBlocks, 16))
+	end := uint64(this.ra.Size()) << 3
+	pos := this.headerSize
+	position := int64(0)
+	lastFlushed := false
+	var lastStart, lastBits uint64 // data of the last block
+
+	for {
+		lr, err := this.readBitsAt(pos, 5)
+
+		if err != nil {
+			return nil, err
+		}
+
+		lr += 3
+		read, err := this.readBitsAt(pos+5, uint(lr))
+
+		if err != nil {
+			return nil, err
+		}
+
+		if read == 0 {
+			// End block
+			break
+		}
+
+		size := 5 + lr + read
+
+		if pos+size > end {
+			return nil, &IOError{msg: "Invalid bitstream: truncated block", code: kanzi.ERR_READ_FILE}
+		}
+
+		entry := BlockIndexEntry{Offset: pos, Size: size, Position: position, OriginalSize: uint32(this.blockSize)}
+		lastStart, lastBits = pos+5+lr, read
+		lastFlushed = lr > 3 && read>>(lr-1) == 0
+
+		if lastFlushed == true {
+			origSize, err := this.originalBlockSize(entry, lastStart, lastBits, len(index))
+
+			if err != nil {
+				return nil, err
+			}
+
+			entry.OriginalSize = uint32(origSize)
+		}
+
+		index = append(index, entry)
+		pos += size
+		position += int64(entry.OriginalSize)
+	}
+
+	if this.cipher != nil && this.cipher.aead != nil {
+		// The encrypted trailer after the end block (8 bits) detects a truncation
+		data := make([]byte, _TRAILER_SIZE+_CIPHER_TAG_SIZE)
+
+		if err := this.readBytesAt(pos+8, data); err != nil {
+			return nil, err
+		}
+
+		if _, _, err := this.cipher.openTrailer(data, int32(len(index))); err != nil {
+			errMsg := "Cannot decrypt the trailer: truncated stream or corrupted data"
+			return nil, &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+		}
+	}
+
+	if len(index) == 0 || lastFlushed == true {
+		if this.outputSize > 0 && position != this.outputSize {
+			return nil, &IOError{msg: "Invalid bitstream: original size mismatch", code: kanzi.ERR_INVALID_FILE}
+		}
+
+		return index, nil
+	}
+
+	last := &index[len(index)-1]
+
+	if this.outputSize > 0 {
+		lastSize := this.outputSize - last.Position
+
+		if lastSize <= 0 || lastSize > int64(this.blockSize) {
+			return nil, &IOError{msg: "Invalid bitstream: original size mismatch", code: kanzi.ERR_INVALID_FILE}
+		}
+
+		last.OriginalSize = uint32(lastSize)
+	} else {
+		// The size of the last block is unknown
+		origSize, err := this.originalBlockSize(*last, lastStart, lastBits, len(index)-1)
+
+		if err != nil {
+			return nil, err
+		}
+
+		last.OriginalSize = uint32(origSize)
+	}
+
+	return index, nil
+}
+
+// originalBlockSize returns the decompressed size of the block at position
+// idx. The block data starts at bit offset 'start' and is 'bits' long.
+func (this *Reader) originalBlockSize(entry BlockIndexEntry, start, bits uint64, idx int) (int, error) {
+	if this.cipher == nil {
+		// Enough bits for the codecs, mode, skip flags, size and checksum
+		var data [32]byte
+		ibs, err := this.newBitStreamAt(start, 1024)
+
+		if err != nil {
+			return 0, err
+		}
+
+		ibs.ReadArray(data[:], uint(min(bits, uint64(len(data))<<3)))
+		bi := BlockInfo{ID: idx + 1}
+
+		if err = this.readBlockHeader(&bi, data[:], bits); err != nil {
+			return 0, err
+		}
+
+		// No transform was applied: the block size is in the block header
+		if bi.Copy == true || bi.SkipFlags == 0xFF {
+			if bi.DataSize == 0 || bi.DataSize > uint(this.blockSize) {
+				errMsg := fmt.Sprintf("Invalid data in block %d", idx+1)
+				return 0, &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK}
+			}
+
+			return int(bi.DataSize), nil
+		}
+	}
+
+	data, err := this.decodeBlock(entry, idx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// readBitsAt reads 'count' bits (in [1..56]) at bit offset 'pos' in the compressed stream
+func (this *Reader) readBitsAt(pos uint64, count uint) (uint64, error) {
+	var buf [8]byte
+	n, _ := this.ra.ReadAt(buf[:], int64(pos>>3))
+
+	if uint64(n) < ((pos&7)+uint64(count)+7)>>3 {
+		return 0, &IOError{msg: "Invalid bitstream: unexpected end of stream", code: kanzi.ERR_READ_FILE}
+	}
+
+	return (binary.BigEndian.Uint64(buf[:]) << (pos & 7)) >> (64 - count), nil
+}
+
+// readBytesAt reads len(buf) bytes at bit offset 'pos' in the compressed stream
+func (this *Reader) readBytesAt(pos uint64, buf []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid bitstream: unexpected end of stream", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	ibs, err := this.newBitStreamAt(pos, 1024)
+
+	if err != nil {
+		return err
+	}
+
+	ibs.ReadArray(buf, uint(8*len(buf)))
+	return nil
+}
+
+// newBitStreamAt returns an input bitstream positioned at bit offset 'pos'
+// in the compressed stream
+func (this *Reader) newBitStreamAt(pos uint64, bufferSize uint) (ibs kanzi.InputBitStream, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid bitstream: unexpected end of stream", code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	off := int64(pos >> 3)
+	sr := io.NewSectionReader(this.ra, off, this.ra.Size()-off)
+
+	if ibs, err = bitstream.NewDefaultInputBitStream(io.NopCloser(sr), bufferSize); err != nil {
+		return nil, &IOError{msg: fmt.Sprintf("Cannot create input bit stream: %v", err), code: kanzi.ERR_CREATE_BITSTREAM}
+	}
+
+	if pos&7 != 0 {
+		ibs.ReadBits(uint(pos & 7))
+	}
+
+	return ibs, nil
+}
+
+// blockStreamBufferSize returns the buffer size of a bitstream used to read one block
+func blockStreamBufferSize(entry BlockIndexEntry) uint {
+	bufSize := ((entry.Size >> 3) + 16 + 7) & ^uint64(7)
+	return uint(max(min(bufSize, _STREAM_DEFAULT_BUFFER_SIZE), 1024))
+}
+
+// decodeBlock decodes one block independently from the main input bitstream
+func (this *Reader) decodeBlock(entry BlockIndexEntry, idx int) ([]byte, error) {
+	blkSize := this.blockSize
+
+	// Add a padding area to manage any block temporarily expanded
+	if _EXTRA_BUFFER_SIZE >= (blkSize >> 4) {
+		blkSize += _EXTRA_BUFFER_SIZE
+	} else {
+		blkSize += (blkSize >> 4)
+	}
+
+	copyCtx := make(map[string]any)
+
+	for k, v := range this.ctx {
+		copyCtx[k] = v
+	}
+
+	delete(copyCtx, "from")
+	delete(copyCtx, "to")
+	copyCtx["jobs"] = uint(1)
+	buffers := []blockBuffer{{Buf: make([]byte, blkSize)}, {Buf: make([]byte, 0)}}
+	processedBlockID := int32(idx)
+	res := decodingTaskResult{}
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	task := decodingTask{
+		iBuffer:            &buffers[0],
+		oBuffer:            &buffers[1],
+		hasher32:           this.hasher32,
+		hasher64:           this.hasher64,
+		blockLength:        uint(blkSize),
+		blockTransformType: this.transformType,
+		blockEntropyType:   this.entropyType,
+		currentBlockID:     int32(idx + 1),
+		processedBlockID:   &processedBlockID,
+		wg:                 &wg,
+		listeners:          make([]kanzi.Listener, 0),
+		ctx:                copyCtx,
+		autoMode:           this.flags&_HEADER_FLAG_AUTO != 0,
+		cipher:             this.cipher,
+		maxLength:          this.maxBufferSize,
+		maxDecoded:         this.maxDecodedLength(),
+		blockStream: func() (kanzi.InputBitStream, error) {
+			return this.newBitStreamAt(entry.Offset, blockStreamBufferSize(entry))
+		},
+		streamStart: entry.Offset &^ 7}
+
+	task.decode(&res)
+
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	if res.decoded == 0 || res.decoded > this.blockSize {
+		errMsg := fmt.Sprintf("Invalid data in block %d", idx+1)
+		return nil, &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK}
+	}
+
+	return res.data[0:res.decoded], nil
+}
+
+// writeIndex appends the block index to the stream (after the end block)
+func (this *Writer) writeIndex() {
+	// Align the index on a byte boundary
+	if pad := uint(-this.obs.Written() & 7); pad != 0 {
+		this.obs.WriteBits(0, pad)
+	}
+
+	start := this.obs.Written() >> 3
+	this.obs.WriteBits(_BLOCK_INDEX_MAGIC, 32)
+	this.obs.WriteBits(uint64(len(this.index)), 32)
+	entries := make([]byte, 0, len(this.index)*_BLOCK_INDEX_ENTRY_SIZE+_CIPHER_TAG_SIZE)
+
+	for _, e := range this.index {
+		entries = binary.BigEndian.AppendUint64(entries, e.Offset)
+		entries = binary.BigEndian.AppendUint64(entries, e.Size)
+		entries = binary.BigEndian.AppendUint32(entries, e.OriginalSize)
+	}
+
+	if this.cipher != nil {
+		// The original sizes are not disclosed (nonce ID after the trailer)
+		entries = this.cipher.seal(entries, int32(len(this.index))+2, true)
+	}
+
+	this.obs.WriteArray(entries, uint(8*len(entries)))
+
+	this.obs.WriteBits(start, 64)
+	this.obs.WriteBits(_BLOCK_INDEX_MAGIC, 32)
+}
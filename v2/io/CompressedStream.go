@@ -18,6 +18,8 @@ limitations under the License.
 package io
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"runtime"
@@ -52,12 +54,30 @@ const (
 	_SMALL_BLOCK_SIZE           = 15
 	_MAX_CONCURRENCY            = 64
 	_CANCEL_TASKS_ID            = -1
+	_HEADER_FLAG_INDEX          = 0x0001 // block index appended to the stream
+	_HEADER_FLAG_AUTO           = 0x0002 // codecs selected per block
+	_HEADER_FLAG_DICTIONARY     = 0x0004 // dictionary ID in the header
+	_HEADER_FLAG_TRAILER        = 0x0008 // content checksum after the end block
+	_HEADER_FLAG_ENCRYPTED      = 0x0010 // blocks encrypted, cipher parameters in the header
+	_HEADER_FLAG_METADATA       = 0x0020 // metadata of the original file after the header
+	_HEADER_FLAGS_MASK          = 0x003F // all supported header flags
 )
 
+// The optional trailer follows the end block (and precedes the block index)
+// when the 'contentChecksum' option is provided to the Writer:
+//
+// number of blocks (32 bits) | original size (64 bits) | XXHash64 of the original data (64 bits)
+//
+// The Reader verifies it after decompressing the whole stream sequentially.
+// The trailer of an encrypted stream is encrypted (see Encryption.go).
+
 // IOError an extended error containing a message and a code value
 type IOError struct {
-	msg  string
-	code int
+	msg       string
+	code      int
+	err       error  // optional cause
+	block     int    // ID of the block that failed to decode (0 if not block related)
+	component string // codec that failed to decode the block (if known)
 }
 
 // Error returns the underlying error
@@ -75,6 +95,50 @@ func (this IOError) ErrorCode() int {
 	return this.code
 }
 
+// BlockID returns the ID (starting at 1) of the block that failed to decode
+// or 0 if the error is not related to a block
+func (this IOError) BlockID() int {
+	return this.block
+}
+
+// Component returns the name of the codec that failed to decode the block
+// (EG. "HUFFMAN entropy decoder" or "BWT+SRT+ZRLT transform") or an empty
+// string if unknown
+func (this IOError) Component() string {
+	return this.component
+}
+
+// Unwrap returns the cause of the error (if any)
+func (this IOError) Unwrap() error {
+	return this.err
+}
+
+// contextError returns an IOError wrapping the error of the context if
+// the context has been canceled or its deadline exceeded, nil otherwise.
+func contextError(cctx context.Context) *IOError {
+	if cctx == nil {
+		return nil
+	}
+
+	if err := cctx.Err(); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_CANCELED, err: err}
+	}
+
+	return nil
+}
+
+// cancelOnDone cancels the running tasks when the context is done.
+// The returned function must be called once the tasks have completed.
+func cancelOnDone(cctx context.Context, processedBlockID *int32) func() bool {
+	if cctx == nil {
+		return func() bool { return true }
+	}
+
+	return context.AfterFunc(cctx, func() {
+		atomic.StoreInt32(processedBlockID, _CANCEL_TASKS_ID)
+	})
+}
+
 type blockBuffer struct {
 	// Enclose a slice in a struct to share it between stream and tasks
 	// and reduce memory allocation.
@@ -102,6 +166,17 @@ type Writer struct {
 	listeners     []kanzi.Listener
 	ctx           map[string]any
 	headless      bool
+	flags         uint
+	index         []BlockIndexEntry
+	cancelCtx     context.Context
+	taskCtxs      []map[string]any // reused by processBlock
+	candidates    []autoCandidate  // automatic codec selection (optional)
+	autoBudget    time.Duration
+	dictID        uint32
+	digest        *hash.XXHash64Digest // content checksum (optional)
+	cipher        *blockCipher         // block encryption (optional)
+	metadata      *FileMetadata        // metadata of the original file (optional)
+	reused        bool                 // set by Reset, Close keeps the buffers for the next Reset
 }
 
 type encodingTask struct {
@@ -118,12 +193,57 @@ type encodingTask struct {
 	listeners          []kanzi.Listener
 	obs                kanzi.OutputBitStream
 	ctx                map[string]any
+	index              *[]BlockIndexEntry
+	align              bool // pad the block to end on a byte boundary
+	candidates         []autoCandidate
+	autoBudget         time.Duration
+	trialBuffers       []blockBuffer // used by selectCandidate (auto mode only)
+	cipher             *blockCipher
 }
 
 type encodingTaskResult struct {
 	err *IOError
 }
 
+// GetLevelCodecs returns the transform and the entropy codec of a
+// compression level in [0..9] (see the level option of the Kanzi CLI)
+func GetLevelCodecs(level int) (string, string, error) {
+	switch level {
+	case 0:
+		return "NONE", "NONE", nil
+
+	case 1:
+		return "PACK+LZ", "NONE", nil
+
+	case 2:
+		return "DNA+LZ", "HUFFMAN", nil
+
+	case 3:
+		return "TEXT+UTF+PACK+MM+LZX", "HUFFMAN", nil
+
+	case 4:
+		return "TEXT+UTF+EXE+PACK+MM+ROLZ", "NONE", nil
+
+	case 5:
+		return "TEXT+UTF+BWT+RANK+ZRLT", "ANS0", nil
+
+	case 6:
+		return "TEXT+UTF+BWT+SRT+ZRLT", "FPAQ", nil
+
+	case 7:
+		return "LZP+TEXT+UTF+BWT+LZP", "CM", nil
+
+	case 8:
+		return "EXE+RLT+TEXT+UTF+DNA", "TPAQ", nil
+
+	case 9:
+		return "EXE+RLT+TEXT+UTF+DNA", "TPAQX", nil
+
+	default:
+		return "", "", fmt.Errorf("Invalid compression level (must be in[0..9]), got %d", level)
+	}
+}
+
 // NewWriter creates a new instance of Writer.
 // The writer writes compressed data blocks to the provided os.
 // Use 0 if the file size is not available
@@ -255,18 +375,113 @@ func createWriterWithCtx(obs kanzi.OutputBitStream, ctx map[string]any) (*Writer
 		this.headless = false
 	}
 
+	if c, hasKey := ctx["autoCandidates"]; hasKey == true && len(c.(string)) > 0 {
+		// The block codecs are signaled using the header flags
+		if this.headless == true {
+			return nil, &IOError{msg: "The automatic codec selection is not available in headerless mode", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if this.candidates, err = parseCandidates(c.(string)); err != nil {
+			return nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if b, hasKey := ctx["autoBudget"]; hasKey == true {
+			this.autoBudget = time.Duration(b.(uint)) * time.Millisecond
+		}
+
+		this.flags |= _HEADER_FLAG_AUTO
+	}
+
+	if dict := dictionaryFromContext(ctx); dict != nil {
+		// The codecs read the content of the dictionary from the context
+		ctx["dictionaryData"] = dict.Bytes()
+		this.dictID = dict.ID()
+
+		// The Reader checks the dictionary ID, except in headerless mode
+		if this.headless == false {
+			this.flags |= _HEADER_FLAG_DICTIONARY
+		}
+	}
+
+	if cc, hasKey := ctx["contentChecksum"]; hasKey == true && cc.(bool) == true {
+		// The trailer is signaled using the header flags
+		if this.headless == true {
+			return nil, &IOError{msg: "The content checksum is not available in headerless mode", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.flags |= _HEADER_FLAG_TRAILER
+		this.digest = hash.NewXXHash64Digest(_BITSTREAM_TYPE)
+	}
+
+	if password := passwordFromContext(ctx); password != nil {
+		// The cipher parameters are stored in the header
+		if this.headless == true {
+			return nil, &IOError{msg: "The encryption is not available in headerless mode", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if len(password) == 0 {
+			return nil, &IOError{msg: "Invalid empty password", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		if this.cipher, err = newBlockCipher(password); err != nil {
+			return nil, &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR}
+		}
+
+		this.flags |= _HEADER_FLAG_ENCRYPTED
+	}
+
+	if md, hasKey := ctx["metadata"].(*FileMetadata); hasKey == true && md != nil {
+		if this.headless == true {
+			return nil, &IOError{msg: "The file metadata is not available in headerless mode", code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		this.metadata = md
+		this.flags |= _HEADER_FLAG_METADATA
+	}
+
+	// The index is located using the header flags, hence not available in headerless mode
+	if idx, hasKey := ctx["blockIndex"]; hasKey == true && idx.(bool) == true && this.headless == false {
+		this.flags |= _HEADER_FLAG_INDEX
+		this.index = make([]BlockIndexEntry, 0, max(nbBlocks, 16))
+	}
+
 	ctx["bsVersion"] = uint(_BITSTREAM_FORMAT_VERSION)
 	this.jobs = int(tasks)
-	this.buffers = make([]blockBuffer, 2*this.jobs)
+	nbBuffers := 2 // input and output buffers per block
+
+	if len(this.candidates) > 0 {
+		nbBuffers += _AUTO_TRIAL_BUFFERS
+	}
+
+	if maxMemory := maxMemoryFromContext(ctx); maxMemory > 0 {
+		// Reduce the number of jobs to fit the block buffers in the memory limit
+		tTypes := []uint64{this.transformType}
+
+		for _, c := range this.candidates {
+			tTypes = append(tTypes, c.transformType)
+		}
+
+		bufSize, err := blockBufferSize(ctx, this.blockSize, tTypes...)
+
+		if err != nil {
+			return nil, &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_PARAM}
+		}
+
+		var ioErr *IOError
+
+		if this.jobs, ioErr = limitJobs(this.jobs, bufSize, nbBuffers, maxMemory); ioErr != nil {
+			return nil, ioErr
+		}
+	}
+
+	this.buffers = make([]blockBuffer, nbBuffers*this.jobs)
 
 	// Allocate first buffer and add padding for incompressible blocks
 	bufSize := max(this.blockSize+this.blockSize>>6, 65536)
 	this.buffers[0] = blockBuffer{Buf: make([]byte, bufSize)}
-	this.buffers[this.jobs] = blockBuffer{Buf: make([]byte, 0)}
 
-	for i := 1; i < this.jobs; i++ {
+	for i := 1; i < len(this.buffers); i++ {
 		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
-		this.buffers[i+this.jobs] = blockBuffer{Buf: make([]byte, 0)}
 	}
 
 	this.blockID = 0
@@ -302,6 +517,14 @@ func (this *Writer) RemoveListener(bl kanzi.Listener) bool {
 	return false
 }
 
+// SetContext sets a context used to abort the compression. Once the context
+// is canceled or its deadline exceeded, the running encoding tasks are stopped
+// and Write, Close return an IOError with code ERR_CANCELED wrapping ctx.Err().
+// A nil context disables cancellation.
+func (this *Writer) SetContext(ctx context.Context) {
+	this.cancelCtx = ctx
+}
+
 func (this *Writer) writeHeader() *IOError {
 	if this.headless == true || atomic.SwapInt32(&this.initialized, 1) != 0 {
 		return nil
@@ -365,10 +588,24 @@ func (this *Writer) writeHeader() *IOError {
 		}
 	}
 
-	padding := uint64(0)
+	if this.obs.WriteBits(uint64(this.flags), 15) != 15 {
+		return &IOError{msg: "Cannot write flags to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+		if this.obs.WriteBits(uint64(this.dictID), 32) != 32 {
+			return &IOError{msg: "Cannot write dictionary ID to header", code: kanzi.ERR_WRITE_FILE}
+		}
+	}
+
+	if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+		this.obs.WriteBits(_CIPHER_AES256_GCM, 8)
+		this.obs.WriteBits(uint64(this.cipher.iterations), 32)
 
-	if this.obs.WriteBits(padding, 15) != 15 {
-		return &IOError{msg: "Cannot write padding to header", code: kanzi.ERR_WRITE_FILE}
+		if this.obs.WriteArray(this.cipher.salt[:], 8*_KDF_SALT_SIZE) != 8*_KDF_SALT_SIZE ||
+			this.obs.WriteArray(this.cipher.prefix[:], 8*_NONCE_PREFIX_SIZE) != 8*_NONCE_PREFIX_SIZE {
+			return &IOError{msg: "Cannot write cipher parameters to header", code: kanzi.ERR_WRITE_FILE}
+		}
 	}
 
 	seed := uint32(0x01030507 * _BITSTREAM_FORMAT_VERSION)
@@ -384,12 +621,46 @@ func (this *Writer) writeHeader() *IOError {
 		cksum ^= (HASH * uint32(^this.inputSize))
 	}
 
+	if this.flags != 0 {
+		cksum ^= (HASH * uint32(^this.flags))
+	}
+
+	if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+		cksum ^= (HASH * ^this.dictID)
+	}
+
+	if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+		for _, w := range this.cipher.words() {
+			cksum ^= (HASH * ^w)
+		}
+	}
+
 	cksum = (cksum >> 23) ^ (cksum >> 3)
 
 	if this.obs.WriteBits(uint64(cksum), 24) != 24 {
 		return &IOError{msg: "Cannot write checksum to header", code: kanzi.ERR_WRITE_FILE}
 	}
 
+	if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+		size, dictID := uint64(0), uint32(0)
+
+		if szMask > 0 {
+			size = uint64(this.inputSize)
+		}
+
+		if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+			dictID = this.dictID
+		}
+
+		// Same fields as the reader (see readHeader)
+		this.cipher.setHeader(_BITSTREAM_FORMAT_VERSION, uint64(ckSize), uint64(this.entropyType),
+			this.transformType, uint64(this.blockSize), size, uint64(this.flags), uint64(dictID))
+	}
+
+	if this.flags&_HEADER_FLAG_METADATA != 0 {
+		return this.writeMetadata()
+	}
+
 	return nil
 }
 
@@ -401,10 +672,21 @@ func (this *Writer) Write(block []byte) (int, error) {
 		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
 	}
 
+	if err := contextError(this.cancelCtx); err != nil {
+		return 0, err
+	}
+
 	off := 0
 	remaining := len(block)
 
 	for remaining > 0 {
+		if this.available == this.jobs*this.blockSize {
+			// If all buffers are full, time to encode
+			if err := this.processBlock(false); err != nil {
+				return len(block) - remaining, err
+			}
+		}
+
 		lenChunk := remaining
 		bufOff := this.available % this.blockSize
 
@@ -416,23 +698,22 @@ func (this *Writer) Write(block []byte) (int, error) {
 			// Process a chunk of in-buffer data. No access to bitstream required
 			bufID := this.available / this.blockSize
 			copy(this.buffers[bufID].Buf[bufOff:], block[off:off+lenChunk])
+
+			if this.digest != nil {
+				this.digest.Write(block[off : off+lenChunk])
+			}
+
 			bufOff += lenChunk
 			off += lenChunk
 			remaining -= lenChunk
 			this.available += lenChunk
 
-			if bufOff >= this.blockSize {
-				if bufID+1 < this.jobs {
-					// Current write buffer is full
-					if len(this.buffers[bufID+1].Buf) == 0 {
-						bufSize := max(this.blockSize+this.blockSize>>6, 65536)
-						this.buffers[bufID+1].Buf = make([]byte, bufSize)
-					}
-				} else {
-					// If all buffers are full, time to encode
-					if err := this.processBlock(); err != nil {
-						return len(block) - remaining, err
-					}
+			// Current write buffer is full. The encoding of full buffers is delayed
+			// until more data is written so that Flush can align the last block.
+			if bufOff >= this.blockSize && bufID+1 < this.jobs {
+				if len(this.buffers[bufID+1].Buf) == 0 {
+					bufSize := max(this.blockSize+this.blockSize>>6, 65536)
+					this.buffers[bufID+1].Buf = make([]byte, bufSize)
 				}
 			}
 
@@ -446,14 +727,15 @@ func (this *Writer) Write(block []byte) (int, error) {
 }
 
 // Close writes the buffered data to the writer then writes
-// a final empty block and releases resources.
+// a final empty block and releases resources (the internal buffers of a
+// writer that has been reset are kept for the next Reset).
 // Close makes the bitstream unavailable for further writes. Idempotent.
 func (this *Writer) Close() error {
 	if atomic.SwapInt32(&this.closed, 1) == 1 {
 		return nil
 	}
 
-	if err := this.processBlock(); err != nil {
+	if err := this.processBlock(false); err != nil {
 		return err
 	}
 
@@ -461,23 +743,140 @@ func (this *Writer) Close() error {
 	this.obs.WriteBits(0, 5) // write length-3 (5 bits max)
 	this.obs.WriteBits(0, 3)
 
+	if this.cipher != nil {
+		// Encrypted trailer, also marks the end of the stream (see Encryption.go)
+		size, checksum := uint64(0), uint64(0)
+
+		if this.flags&_HEADER_FLAG_TRAILER != 0 {
+			size, checksum = this.digest.Size(), this.digest.Sum64()
+		}
+
+		trailer := this.cipher.sealTrailer(atomic.LoadInt32(&this.blockID), size, checksum)
+		this.obs.WriteArray(trailer, uint(8*len(trailer)))
+	} else if this.flags&_HEADER_FLAG_TRAILER != 0 {
+		this.obs.WriteBits(uint64(atomic.LoadInt32(&this.blockID)), 32)
+		this.obs.WriteBits(this.digest.Size(), 64)
+		this.obs.WriteBits(this.digest.Sum64(), 64)
+	}
+
+	if this.flags&_HEADER_FLAG_INDEX != 0 {
+		this.writeIndex()
+	}
+
 	if err := this.obs.Close(); err != nil {
 		return err
 	}
 
-	// Release resources
-	for i := range this.buffers {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+	if this.reused == false {
+		// Release resources
+		for i := range this.buffers {
+			this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		}
+	}
+
+	return nil
+}
+
+// Reset discards the state of the writer and makes it write a new stream
+// to os with the same parameters, similar to Close followed by NewWriterWithCtx
+// but the internal buffers are reused. It allows pooling of writers (EG. using
+// a sync.Pool) to compress many small payloads without reallocating buffers.
+// Once a writer has been reset, Close keeps the buffers for the next Reset.
+// The original size and file metadata provided at creation (if any) and the
+// context set by SetContext apply to the previous stream and are discarded.
+// The listeners are kept. Any data not written yet is lost.
+func (this *Writer) Reset(os io.WriteCloser) error {
+	if os == nil {
+		return &IOError{msg: "Invalid null output stream parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if dobs, ok := this.obs.(*bitstream.DefaultOutputBitStream); ok == true {
+		if err := dobs.Reset(os); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM}
+		}
+	} else {
+		obs, err := bitstream.NewDefaultOutputBitStream(os, _STREAM_DEFAULT_BUFFER_SIZE)
+
+		if err != nil {
+			errMsg := fmt.Sprintf("Cannot create output bit stream: %v", err)
+			return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+		}
+
+		this.obs = obs
+	}
+
+	delete(this.ctx, "fileSize")
+	delete(this.ctx, "metadata")
+	this.inputSize = 0
+	this.nbInputBlocks = 0
+	this.available = 0
+	this.cancelCtx = nil
+	this.metadata = nil
+	this.flags &^= _HEADER_FLAG_METADATA
+
+	if this.index != nil {
+		this.index = this.index[:0]
+	}
+
+	if this.digest != nil {
+		this.digest.Reset()
+	}
+
+	if this.cipher != nil {
+		// Same key, new nonces
+		if err := this.cipher.renewNonce(); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_COMPRESSOR}
+		}
+	}
+
+	if len(this.buffers[0].Buf) == 0 {
+		// Released by Close
+		this.buffers[0].Buf = make([]byte, max(this.blockSize+this.blockSize>>6, 65536))
+	}
+
+	this.reused = true
+	atomic.StoreInt32(&this.blockID, 0)
+	atomic.StoreInt32(&this.initialized, 0)
+	atomic.StoreInt32(&this.closed, 0)
+	return nil
+}
+
+// Flush encodes the buffered data (if any) as one or more blocks, the last one
+// possibly short, then flushes the underlying bitstream. The last block is padded
+// to end on a byte boundary so that a reader can decode all the data written so far.
+// If the underlying stream implements Flush() error, it is called as well.
+// The size field of the last block marks the end of the flush: readers return
+// the flushed data as soon as this block is decoded, whatever the number of
+// jobs (EG. logs over a pipe).
+func (this *Writer) Flush() error {
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return &IOError{msg: "Stream closed", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	if err := this.processBlock(true); err != nil {
+		return err
+	}
+
+	if f, ok := this.obs.(interface{ Flush() error }); ok == true {
+		if err := f.Flush(); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_WRITE_FILE}
+		}
 	}
 
 	return nil
 }
 
-func (this *Writer) processBlock() error {
+// processBlock encodes the buffered data. If align is true, the last block
+// is padded to end on a byte boundary.
+func (this *Writer) processBlock(align bool) error {
 	if err := this.writeHeader(); err != nil {
 		return err
 	}
 
+	if err := contextError(this.cancelCtx); err != nil {
+		return err
+	}
+
 	if this.available == 0 {
 		return nil
 	}
@@ -521,15 +920,24 @@ func (this *Writer) processBlock() error {
 			break
 		}
 
-		copyCtx := make(map[string]any)
-
-		for k, v := range this.ctx {
-			copyCtx[k] = v
-		}
-
+		copyCtx := this.taskCtx(taskID)
 		copyCtx["jobs"] = jobsPerTask[taskID]
 		wg.Add(1)
 		tasks++
+		var index *[]BlockIndexEntry
+
+		if this.flags&_HEADER_FLAG_INDEX != 0 {
+			index = &this.index
+		}
+
+		var trialBuffers []blockBuffer
+
+		if len(this.candidates) > 0 {
+			// The trial buffers follow the input and output buffers
+			first := 2*this.jobs + _AUTO_TRIAL_BUFFERS*taskID
+			trialBuffers = this.buffers[first : first+_AUTO_TRIAL_BUFFERS]
+		}
+
 		off += dataLength
 		this.available -= dataLength
 
@@ -546,14 +954,28 @@ func (this *Writer) processBlock() error {
 			wg:                 &wg,
 			obs:                this.obs,
 			listeners:          listeners,
-			ctx:                copyCtx}
+			ctx:                copyCtx,
+			index:              index,
+			align:              align && this.available == 0,
+			candidates:         this.candidates,
+			autoBudget:         this.autoBudget,
+			trialBuffers:       trialBuffers,
+			cipher:             this.cipher}
 
 		// Invoke the tasks concurrently
 		go task.encode(&results[taskID])
 	}
 
+	// Stop the tasks if the context is done
+	stop := cancelOnDone(this.cancelCtx, &this.blockID)
+
 	// Wait for completion of all tasks
 	wg.Wait()
+	stop()
+
+	if err := contextError(this.cancelCtx); err != nil {
+		return err
+	}
 
 	for _, r := range results {
 		if r.err != nil {
@@ -569,6 +991,30 @@ func (this *Writer) GetWritten() uint64 {
 	return (this.obs.Written() + 7) >> 3
 }
 
+// taskCtx returns a copy of the context for the task, reusing the maps
+// allocated by previous calls (the tasks modify their context).
+func (this *Writer) taskCtx(taskID int) map[string]any {
+	if this.taskCtxs == nil {
+		this.taskCtxs = make([]map[string]any, this.jobs)
+	}
+
+	return copyContext(&this.taskCtxs[taskID], this.ctx)
+}
+
+func copyContext(dst *map[string]any, src map[string]any) map[string]any {
+	if *dst == nil {
+		*dst = make(map[string]any, len(src)+4)
+	} else {
+		clear(*dst)
+	}
+
+	for k, v := range src {
+		(*dst)[k] = v
+	}
+
+	return *dst
+}
+
 // Encode mode + transformed entropy coded data
 // mode | 0b10000000 => copy block
 // mode | 0b0yy00000 => size(size(block))-1
@@ -608,6 +1054,10 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 		this.wg.Done()
 	}()
 
+	if atomic.LoadInt32(this.processedBlockID) == _CANCEL_TASKS_ID {
+		return
+	}
+
 	hashType := kanzi.EVT_HASH_NONE
 
 	// Compute block checksum
@@ -656,6 +1106,16 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 		}
 	}
 
+	if len(this.candidates) > 0 && mode&_COPY_BLOCK_MASK == 0 {
+		// Automatic codec selection
+		this.selectCandidate(data)
+
+		if err := setCodecNames(this.ctx, this.blockTransformType, this.blockEntropyType); err != nil {
+			res.err = &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_CODEC}
+			return
+		}
+	}
+
 	this.ctx["size"] = this.blockLength
 	t, err := transform.New(&this.ctx, this.blockTransformType)
 
@@ -665,15 +1125,7 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	}
 
 	requiredSize := t.MaxEncodedLen(int(this.blockLength))
-	magic := internal.GetMagicType(data)
-
-	if internal.IsDataCompressed(magic) == true {
-		this.ctx["dataType"] = internal.DT_BIN
-	} else if internal.IsDataMultimedia(magic) == true {
-		this.ctx["dataType"] = internal.DT_MULTIMEDIA
-	} else if internal.IsDataExecutable(magic) == true {
-		this.ctx["dataType"] = internal.DT_EXE
-	}
+	setDataType(this.ctx, data)
 
 	if len(this.iBuffer.Buf) < requiredSize {
 		extraBuf := make([]byte, requiredSize-len(this.iBuffer.Buf))
@@ -688,6 +1140,10 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 
 	// Forward transform (ignore error, encode skipFlags)
 	_, postTransformLength, _ := t.Forward(data[0:this.blockLength], buffer)
+
+	if atomic.LoadInt32(this.processedBlockID) == _CANCEL_TASKS_ID {
+		return
+	}
 	this.ctx["size"] = postTransformLength
 	dataSize := uint(1)
 
@@ -731,6 +1187,12 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	obs, _ := bitstream.NewDefaultOutputBitStream(bufStream, 16384)
 	skipFlags := t.SkipFlags()
 
+	if len(this.candidates) > 0 {
+		// Write the codecs selected for the block
+		obs.WriteBits(uint64(this.blockEntropyType), 5)
+		obs.WriteBits(this.blockTransformType, 48)
+	}
+
 	// Write block 'header' (mode + compressed length)
 	if ((mode & _COPY_BLOCK_MASK) != 0) || (t.Len() <= 4) {
 		mode |= byte(t.SkipFlags() >> 4)
@@ -777,6 +1239,12 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 	obs.Close()
 	written := obs.Written()
 
+	if this.cipher != nil {
+		// Encrypt and authenticate the block (including the padding bits)
+		data = this.cipher.seal(data[0:(written+7)>>3], this.currentBlockID, false)
+		written = uint64(len(data)) << 3
+	}
+
 	// Lock free synchronization
 	for n := 0; ; n++ {
 		taskID := atomic.LoadInt32(this.processedBlockID)
@@ -800,23 +1268,36 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 			int64((written+7)>>3), checksum, hashType, time.Now())
 		notifyListeners(this.listeners, evt)
 
-		if v, hasKey := this.ctx["verbosity"]; hasKey {
-			blockOffset := this.obs.Written()
-
-			if v.(uint) > 4 {
-				msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"offset\":%d, \"skipFlags\":%.8b }",
-					"BLOCK_INFO", int(this.currentBlockID), blockOffset, skipFlags)
-				evt1 := kanzi.NewEventFromString(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, time.Now())
-				notifyListeners(this.listeners, evt1)
-			}
-		}
+		evt1 := kanzi.NewBlockInfoEvent(int(this.currentBlockID), int64(this.obs.Written()), skipFlags, time.Now())
+		notifyListeners(this.listeners, evt1)
 	}
 
 	// Emit block size in bits (max size pre-entropy is 1 GB = 1 << 30 bytes)
-	lw := uint(3)
+	blockStart := this.obs.Written()
+	lw := blockLengthBits(written)
+
+	if this.align == true {
+		// The block ends a flush: its size field is one bit longer than
+		// required (a leading zero bit ignored by older decoders) so that
+		// the decoder does not wait for the next block. Add zero bits to the
+		// block data (ignored by the decoder) so that the block ends on a
+		// byte boundary. The length of the size field depends on the padded
+		// size.
+		end := (written + 7) >> 3
+		lw = flushLengthBits(written)
+
+		for (blockStart+5+uint64(lw)+written)&7 != 0 {
+			written++
+			lw = flushLengthBits(written)
+		}
+
+		if int((written+7)>>3) > len(data) {
+			data = append(data, 0)
+		}
 
-	if written >= 8 {
-		lw = uint(internal.Log2NoCheck(uint32(written>>3)) + 4)
+		for i := end; i < (written+7)>>3; i++ {
+			data[i] = 0
+		}
 	}
 
 	this.obs.WriteBits(uint64(lw-3), 5) // write length-3 (5 bits max)
@@ -838,6 +1319,29 @@ func (this *encodingTask) encode(res *encodingTaskResult) {
 			chkSize = uint(written)
 		}
 	}
+
+	// Blocks are emitted in order, one task at a time
+	if this.index != nil {
+		*this.index = append(*this.index, BlockIndexEntry{Offset: blockStart,
+			Size: this.obs.Written() - blockStart, OriginalSize: uint32(this.blockLength)})
+	}
+}
+
+// blockLengthBits returns the number of bits used to encode the size of
+// a block of 'written' bits
+func blockLengthBits(written uint64) uint {
+	if written < 8 {
+		return 3
+	}
+
+	return uint(internal.Log2NoCheck(uint32(written>>3)) + 4)
+}
+
+// flushLengthBits returns the number of bits used to encode the size of
+// the block of 'written' bits ending a flush (one more than required,
+// except for the largest blocks)
+func flushLengthBits(written uint64) uint {
+	return min(blockLengthBits(written)+1, 34)
 }
 
 func notifyListeners(listeners []kanzi.Listener, evt *kanzi.Event) {
@@ -860,6 +1364,8 @@ type decodingTaskResult struct {
 	decoded        int
 	blockID        int
 	skipped        bool
+	unread         bool // the block follows a short block and was not read
+	end            bool // end block
 	checksum       uint64
 	completionTime time.Time
 }
@@ -867,26 +1373,49 @@ type decodingTaskResult struct {
 // Reader a Reader that reads compressed data
 // from an InputBitStream.
 type Reader struct {
-	blockSize       int
-	hasher32        *hash.XXHash32
-	hasher64        *hash.XXHash64
-	buffers         []blockBuffer
-	entropyType     uint32
-	transformType   uint64
-	outputSize      int64
-	ibs             kanzi.InputBitStream
-	initialized     int32
-	closed          int32
-	blockID         int32
-	jobs            int
-	bufferThreshold int
-	available       int64 // decoded not consumed bytes
-	consumed        int   // decoded consumed bytes
-	nbInputBlocks   int
-	listeners       []kanzi.Listener
-	ctx             map[string]any
-	parentCtx       *map[string]any
-	headless        bool
+	blockSize     int
+	hasher32      *hash.XXHash32
+	hasher64      *hash.XXHash64
+	buffers       []blockBuffer
+	entropyType   uint32
+	transformType uint64
+	outputSize    int64
+	ibs           kanzi.InputBitStream
+	initialized   int32
+	closed        int32
+	blockID       int32
+	jobs          int
+	bufLengths    []int // decoded bytes per buffer
+	bufID         int   // index of the buffer being consumed
+	available     int64 // decoded not consumed bytes
+	consumed      int   // decoded consumed bytes in current buffer
+	nbInputBlocks int
+	listeners     []kanzi.Listener
+	ctx           map[string]any
+	parentCtx     *map[string]any
+	headless      bool
+	flags         uint
+	headerSize    uint64 // in bits
+	ra            *io.SectionReader
+	index         []BlockIndexEntry
+	raRead        uint64 // bytes read by the concurrent block reads
+	indexLock     sync.Mutex
+	position      int64 // offset in the decompressed stream
+	seekPending   bool
+	cancelCtx     context.Context
+	taskCtxs      []map[string]any     // reused by processBlock
+	digest        *hash.XXHash64Digest // content checksum (nil if not verified)
+	decodedBlocks int                  // number of blocks decoded (content checksum)
+	endBlockID    int                  // ID of the end block once read sequentially
+	trailerRead   bool                 // trailer verified (end of an encrypted stream)
+	cipher        *blockCipher         // block decryption (nil if not encrypted)
+	dictID        uint32               // ID of the dictionary in the header (if any)
+	inspecting    bool                 // header read by Info (no dictionary or password required)
+	metadata      *FileMetadata        // metadata of the original file (if any)
+	rawMetadata   []byte               // metadata not decoded yet
+	maxBufferSize int                  // size limit of the block buffers (0 if no memory limit)
+	strict        bool                 // hardened decoding of untrusted input
+	reused        bool                 // set by Reset, Close keeps the buffers for the next Reset
 }
 
 type decodingTask struct {
@@ -903,6 +1432,13 @@ type decodingTask struct {
 	listeners          []kanzi.Listener
 	ibs                kanzi.InputBitStream
 	ctx                map[string]any
+	blockStream        func() (kanzi.InputBitStream, error) // optional, reads the block concurrently
+	streamStart        uint64                               // offset in bits of the start of blockStream
+	autoMode           bool                                 // codecs selected per block
+	cipher             *blockCipher                         // block decryption (optional)
+	maxLength          int                                  // size limit of the block buffers (0 if no memory limit)
+	maxDecoded         int                                  // declared block size in strict mode (0 otherwise)
+	flushEnd           *int32                               // set after the block ending a flush, the next tasks do not read (optional)
 }
 
 // NewReader creates a new instance of Reader.
@@ -978,7 +1514,7 @@ func createReaderWithCtx(ibs kanzi.InputBitStream, ctx map[string]any) (*Reader,
 	this.available = 0
 	this.outputSize = 0
 	this.nbInputBlocks = 0
-	this.bufferThreshold = 0
+	this.bufLengths = make([]int, this.jobs)
 	this.buffers = make([]blockBuffer, 2*this.jobs)
 
 	for i := range this.buffers {
@@ -993,6 +1529,10 @@ func createReaderWithCtx(ibs kanzi.InputBitStream, ctx map[string]any) (*Reader,
 	this.transformType = transform.NONE_TYPE
 	this.headless = false
 
+	if s, hasKey := ctx["strict"].(bool); hasKey == true {
+		this.strict = s
+	}
+
 	if hdl, hasKey := ctx["headerless"]; hasKey == true {
 		this.headless = hdl.(bool)
 
@@ -1000,6 +1540,11 @@ func createReaderWithCtx(ibs kanzi.InputBitStream, ctx map[string]any) (*Reader,
 		if err := this.validateHeaderless(); err != nil {
 			return nil, err
 		}
+
+		if dict := dictionaryFromContext(ctx); this.headless == true && dict != nil {
+			// No dictionary ID to check
+			ctx["dictionaryData"] = dict.Bytes()
+		}
 	}
 
 	return this, nil
@@ -1050,7 +1595,6 @@ func (this *Reader) validateHeaderless() error {
 		}
 
 		this.blockSize = int(blk)
-		this.bufferThreshold = this.blockSize
 	} else {
 		return &IOError{msg: "Missing block size in headerless mode", code: kanzi.ERR_MISSING_PARAM}
 	}
@@ -1082,7 +1626,7 @@ func (this *Reader) validateHeaderless() error {
 		this.nbInputBlocks = min(nbBlocks, _MAX_CONCURRENCY-1)
 	}
 
-	return nil
+	return this.limitMemory()
 }
 
 // AddListener adds an event listener to this reader.
@@ -1113,6 +1657,14 @@ func (this *Reader) RemoveListener(bl kanzi.Listener) bool {
 	return false
 }
 
+// SetContext sets a context used to abort the decompression. Once the context
+// is canceled or its deadline exceeded, the running decoding tasks are stopped
+// and Read, ReadAt return an IOError with code ERR_CANCELED wrapping ctx.Err().
+// A nil context disables cancellation.
+func (this *Reader) SetContext(ctx context.Context) {
+	this.cancelCtx = ctx
+}
+
 // Use a named return value to update the error in the defer function (after return is executed)
 func (this *Reader) readHeader() (err error) {
 	if this.headless == true || atomic.SwapInt32(&this.initialized, 1) != 0 {
@@ -1148,6 +1700,7 @@ func (this *Reader) readHeader() (err error) {
 	}
 
 	this.ctx["bsVersion"] = bsVersion
+	dictID := uint32(0)
 
 	// Read block checksum
 	if bsVersion >= 6 {
@@ -1174,7 +1727,7 @@ func (this *Reader) readHeader() (err error) {
 	var eType string
 
 	if eType, err = entropy.GetName(this.entropyType); err != nil {
-		errMsg := fmt.Sprintf("Invalid bitstream, incorrect entropy type: %d", this.entropyType)
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect entropy type: %d (%v)", this.entropyType, err)
 		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
 	}
 
@@ -1185,7 +1738,7 @@ func (this *Reader) readHeader() (err error) {
 	var tType string
 
 	if tType, err = transform.GetName(this.transformType); err != nil {
-		errMsg := fmt.Sprintf("Invalid bitstream, incorrect transform type: %d", this.transformType)
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect transform type: %d (%v)", this.transformType, err)
 		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
 	}
 
@@ -1200,7 +1753,6 @@ func (this *Reader) readHeader() (err error) {
 	}
 
 	this.ctx["blockSize"] = uint(this.blockSize)
-	this.bufferThreshold = this.blockSize
 	szMask := uint(0)
 
 	if bsVersion >= 5 {
@@ -1220,8 +1772,34 @@ func (this *Reader) readHeader() (err error) {
 		}
 
 		if bsVersion >= 6 {
-			// Padding
-			this.ibs.ReadBits(15)
+			// Flags (padding before the block index was introduced)
+			this.flags = uint(this.ibs.ReadBits(15))
+
+			if this.flags&^_HEADER_FLAGS_MASK != 0 {
+				errMsg := fmt.Sprintf("Invalid bitstream, unsupported header flags: %x", this.flags)
+				return &IOError{msg: errMsg, code: kanzi.ERR_STREAM_VERSION}
+			}
+
+			if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+				dictID = uint32(this.ibs.ReadBits(32))
+			}
+
+			if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+				if err := this.readCipherParams(); err != nil {
+					return err
+				}
+			} else {
+				this.cipher = nil
+			}
+
+			_, hasFrom := this.ctx["from"]
+			_, hasTo := this.ctx["to"]
+
+			// The whole content must be decoded to verify the checksum
+			if this.flags&_HEADER_FLAG_TRAILER != 0 && hasFrom == false && hasTo == false {
+				this.digest = hash.NewXXHash64Digest(_BITSTREAM_TYPE)
+				this.decodedBlocks = 0
+			}
 		}
 
 		// Read and verify checksum
@@ -1247,11 +1825,50 @@ func (this *Reader) readHeader() (err error) {
 			cksum2 ^= (HASH * uint32(^this.outputSize))
 		}
 
-		cksum2 = (cksum2 >> 23) ^ (cksum2 >> 3)
+		if this.flags != 0 {
+			cksum2 ^= (HASH * uint32(^this.flags))
+		}
 
-		if cksum1 != (cksum2 & ((1 << crcSize) - 1)) {
-			return &IOError{msg: "Invalid bitstream: checksum mismatch", code: kanzi.ERR_CRC_CHECK}
+		if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+			cksum2 ^= (HASH * ^dictID)
 		}
+
+		if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+			for _, w := range this.cipher.words() {
+				cksum2 ^= (HASH * ^w)
+			}
+		}
+
+		cksum2 = (cksum2 >> 23) ^ (cksum2 >> 3)
+
+		if cksum1 != (cksum2 & ((1 << crcSize) - 1)) {
+			return &IOError{msg: "Invalid bitstream: checksum mismatch", code: kanzi.ERR_CRC_CHECK}
+		}
+
+		if this.flags&_HEADER_FLAG_ENCRYPTED != 0 {
+			ckSize, size := uint64(0), uint64(0)
+
+			if this.hasher32 != nil {
+				ckSize = 1
+			} else if this.hasher64 != nil {
+				ckSize = 2
+			}
+
+			if szMask > 0 {
+				size = uint64(this.outputSize)
+			}
+
+			// The header fields are authenticated with each item of the stream
+			this.cipher.setHeader(uint64(bsVersion), ckSize, uint64(this.entropyType), this.transformType,
+				uint64(this.blockSize), size, uint64(this.flags), uint64(dictID))
+		}
+
+		if this.flags&_HEADER_FLAG_METADATA != 0 {
+			if err := this.readMetadata(); err != nil {
+				return err
+			}
+		}
+
 	} else if bsVersion >= 3 {
 		// Read number of blocks in input. 0 means 'unknown' and 63 means 63 or more.
 		this.nbInputBlocks = int(this.ibs.ReadBits(6))
@@ -1277,6 +1894,33 @@ func (this *Reader) readHeader() (err error) {
 		this.ibs.ReadBits(4) // reserved
 	}
 
+	this.dictID = dictID
+
+	if this.inspecting == false {
+		if err := this.setDictionary(dictID); err != nil {
+			return err
+		}
+
+		if err := this.limitMemory(); err != nil {
+			return err
+		}
+	}
+
+	if this.cipher != nil && (this.inspecting == false || len(passwordFromContext(this.ctx)) > 0) {
+		// Derive the key once the header is known to be valid
+		if err := this.setPassword(); err != nil {
+			return err
+		}
+	}
+
+	if this.rawMetadata != nil {
+		if err := this.decodeMetadata(); err != nil {
+			return err
+		}
+	}
+
+	this.headerSize = this.ibs.Read()
+
 	if len(this.listeners) > 0 {
 		var sb strings.Builder
 		var ckSize string
@@ -1312,15 +1956,119 @@ func (this *Reader) readHeader() (err error) {
 			sb.WriteString(fmt.Sprintf("Original size: %d byte(s)\n", this.outputSize))
 		}
 
-		evt := kanzi.NewEventFromString(kanzi.EVT_AFTER_HEADER_DECODING, 0, sb.String(), time.Now())
+		if this.flags&_HEADER_FLAG_DICTIONARY != 0 {
+			sb.WriteString(fmt.Sprintf("Dictionary ID: %08x\n", dictID))
+		}
+
+		if this.flags&_HEADER_FLAG_TRAILER != 0 {
+			sb.WriteString("Content checksum: 64 bits\n")
+		}
+
+		if this.cipher != nil {
+			sb.WriteString(fmt.Sprintf("Encryption: AES-256-GCM (PBKDF2-SHA256, %d iterations)\n", this.cipher.iterations))
+		}
+
+		header := &kanzi.HeaderInfo{
+			BitstreamVersion: bsVersion,
+			BlockSize:        this.blockSize,
+			OriginalSize:     this.outputSize,
+			DictionaryID:     dictID,
+			ContentChecksum:  this.flags&_HEADER_FLAG_TRAILER != 0,
+			Encrypted:        this.cipher != nil,
+		}
+
+		header.Entropy, _ = entropy.GetName(this.entropyType)
+		header.Transform, _ = transform.GetName(this.transformType)
+
+		if this.hasher32 != nil {
+			header.Checksum = 32
+		} else if this.hasher64 != nil {
+			header.Checksum = 64
+		}
+
+		evt := kanzi.NewHeaderEvent(header, sb.String(), time.Now())
 		notifyListeners(this.listeners, evt)
 	}
 
 	return nil
 }
 
-// Close reads the buffered data from the reader and releases resources.
-// Close makes the bitstream unavailable for further reads. Idempotent
+// readCipherParams reads the parameters of the block cipher from the header
+func (this *Reader) readCipherParams() error {
+	if cipherType := this.ibs.ReadBits(8); cipherType != _CIPHER_AES256_GCM {
+		errMsg := fmt.Sprintf("Invalid bitstream, unsupported cipher: %d", cipherType)
+		return &IOError{msg: errMsg, code: kanzi.ERR_STREAM_VERSION}
+	}
+
+	var salt [_KDF_SALT_SIZE]byte
+	var prefix [_NONCE_PREFIX_SIZE]byte
+	iterations := uint32(this.ibs.ReadBits(32))
+	this.ibs.ReadArray(salt[:], 8*_KDF_SALT_SIZE)
+	this.ibs.ReadArray(prefix[:], 8*_NONCE_PREFIX_SIZE)
+
+	if iterations == 0 || iterations > _KDF_MAX_ITERATIONS {
+		errMsg := fmt.Sprintf("Invalid bitstream, invalid number of KDF iterations: %d", iterations)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	// Keep the key of the previous stream if the KDF parameters did not change
+	if this.cipher == nil || this.cipher.iterations != iterations || this.cipher.salt != salt {
+		this.cipher = &blockCipher{iterations: iterations, salt: salt}
+	}
+
+	this.cipher.prefix = prefix
+	return nil
+}
+
+// setPassword derives the key of the block cipher from the password provided
+// in the context. The key of the previous stream is reused if possible.
+func (this *Reader) setPassword() error {
+	password := passwordFromContext(this.ctx)
+
+	if len(password) == 0 {
+		return &IOError{msg: "The stream is encrypted, no password provided", code: kanzi.ERR_DECRYPTION}
+	}
+
+	if this.cipher.aead != nil && bytes.Equal(password, this.cipher.password) == true {
+		return nil
+	}
+
+	this.cipher.password = append([]byte{}, password...)
+
+	if err := this.cipher.init(); err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_DECRYPTION}
+	}
+
+	return nil
+}
+
+// setDictionary makes the dictionary provided in the context available to the
+// codecs if the stream was compressed with a dictionary of the same ID.
+func (this *Reader) setDictionary(dictID uint32) error {
+	if this.flags&_HEADER_FLAG_DICTIONARY == 0 {
+		delete(this.ctx, "dictionaryData")
+		return nil
+	}
+
+	dict := dictionaryFromContext(this.ctx)
+
+	if dict == nil {
+		errMsg := fmt.Sprintf("The stream was compressed with a dictionary (ID %08x), none provided", dictID)
+		return &IOError{msg: errMsg, code: kanzi.ERR_DICTIONARY}
+	}
+
+	if dict.ID() != dictID {
+		errMsg := fmt.Sprintf("Dictionary mismatch: the stream requires ID %08x, got %08x", dictID, dict.ID())
+		return &IOError{msg: errMsg, code: kanzi.ERR_DICTIONARY}
+	}
+
+	this.ctx["dictionaryData"] = dict.Bytes()
+	return nil
+}
+
+// Close reads the buffered data from the reader and releases resources
+// (the internal buffers of a reader that has been reset are kept for the
+// next Reset). Close makes the bitstream unavailable for further reads. Idempotent
 func (this *Reader) Close() error {
 	if atomic.SwapInt32(&this.closed, 1) == 1 {
 		return nil
@@ -1332,14 +2080,74 @@ func (this *Reader) Close() error {
 
 	this.available = 0
 
-	// Release resources
-	for i := range this.buffers {
-		this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+	if this.reused == false {
+		// Release resources
+		for i := range this.buffers {
+			this.buffers[i] = blockBuffer{Buf: make([]byte, 0)}
+		}
 	}
 
 	return nil
 }
 
+// Reset discards the state of the reader and makes it read a new stream
+// from is, similar to Close followed by NewReaderWithCtx but the internal
+// buffers are reused. It allows pooling of readers (EG. using a sync.Pool)
+// to decompress many small payloads without reallocating buffers.
+// Once a reader has been reset, Close keeps the buffers for the next Reset.
+// The stream parameters are read from the new header (except in headerless
+// mode). The context set by SetContext is discarded. The listeners are kept.
+// A reader created with NewReaderAt reads the new stream sequentially.
+func (this *Reader) Reset(is io.ReadCloser) error {
+	if is == nil {
+		return &IOError{msg: "Invalid null input stream parameter", code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if dibs, ok := this.ibs.(*bitstream.DefaultInputBitStream); ok == true {
+		if err := dibs.Reset(is); err != nil {
+			return &IOError{msg: err.Error(), code: kanzi.ERR_CREATE_BITSTREAM}
+		}
+	} else {
+		ibs, err := bitstream.NewDefaultInputBitStream(is, _STREAM_DEFAULT_BUFFER_SIZE)
+
+		if err != nil {
+			errMsg := fmt.Sprintf("Cannot create input bit stream: %v", err)
+			return &IOError{msg: errMsg, code: kanzi.ERR_CREATE_BITSTREAM}
+		}
+
+		this.ibs = ibs
+	}
+
+	if this.headless == false {
+		// Provided by the header of the new stream
+		this.hasher32 = nil
+		this.hasher64 = nil
+		this.outputSize = 0
+		this.nbInputBlocks = 0
+		this.flags = 0
+	}
+
+	this.available = 0
+	this.bufID = 0
+	this.consumed = 0
+	this.position = 0
+	this.seekPending = false
+	this.ra = nil
+	this.index = nil
+	atomic.StoreUint64(&this.raRead, 0)
+	this.cancelCtx = nil
+	this.digest = nil
+	this.endBlockID = 0
+	this.trailerRead = false
+	this.metadata = nil
+	this.rawMetadata = nil
+	this.reused = true
+	atomic.StoreInt32(&this.blockID, 0)
+	atomic.StoreInt32(&this.initialized, 0)
+	atomic.StoreInt32(&this.closed, 0)
+	return nil
+}
+
 // Read reads up to len(block) bytes and copies them into block.
 // Returns the number of bytes read (0 <= n <= len(block)) and any error encountered.
 // io.EOF is returned when the end of stream is reached.
@@ -1348,34 +2156,52 @@ func (this *Reader) Read(block []byte) (int, error) {
 		return 0, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
 	}
 
+	if err := contextError(this.cancelCtx); err != nil {
+		return 0, err
+	}
+
 	if err := this.readHeader(); err != nil {
 		return 0, err
 	}
 
+	if this.seekPending == true {
+		if err := this.seekTo(this.position); err != nil {
+			return 0, err
+		}
+	}
+
 	off := 0
 	remaining := len(block)
 
 	for remaining > 0 {
-		bufOff := this.consumed % this.blockSize
-		lenChunk := min(remaining, int(min(this.available, int64(this.bufferThreshold-bufOff))))
+		if this.available > 0 {
+			// Blocks may be short (EG. after a flush): move to next buffer
+			// once the current one has been consumed
+			for this.consumed >= this.bufLengths[this.bufID] {
+				this.bufID++
+				this.consumed = 0
+			}
 
-		if lenChunk > 0 {
 			// Process a chunk of in-buffer data. No access to bitstream required
-			bufID := this.consumed / this.blockSize
-			copy(block[off:], this.buffers[bufID].Buf[bufOff:bufOff+lenChunk])
+			lenChunk := min(remaining, this.bufLengths[this.bufID]-this.consumed)
+			copy(block[off:], this.buffers[this.bufID].Buf[this.consumed:this.consumed+lenChunk])
+
+			if this.digest != nil {
+				this.digest.Write(block[off : off+lenChunk])
+			}
+
 			off += lenChunk
 			remaining -= lenChunk
 			this.available -= int64(lenChunk)
 			this.consumed += lenChunk
+			this.position += int64(lenChunk)
+			continue
+		}
 
-			if this.available > 0 && bufOff+lenChunk >= this.bufferThreshold {
-				// Move to next buffer
-				continue
-			}
-
-			if remaining == 0 {
-				break
-			}
+		// A short block was flushed by the writer: return the data decoded so
+		// far instead of waiting for the next blocks (EG. reading from a pipe).
+		if off > 0 && this.bufLengths[this.bufID] < this.blockSize {
+			break
 		}
 
 		// Buffer empty, time to decode
@@ -1388,6 +2214,10 @@ func (this *Reader) Read(block []byte) (int, error) {
 
 			if this.available == 0 {
 				// Reached end of stream
+				if err := this.verifyTrailer(); err != nil {
+					return len(block) - remaining, err
+				}
+
 				if len(block) == remaining {
 					// EOF and we did not read any bytes in this call
 					return 0, io.EOF
@@ -1402,6 +2232,10 @@ func (this *Reader) Read(block []byte) (int, error) {
 }
 
 func (this *Reader) processBlock() (int64, error) {
+	if err := contextError(this.cancelCtx); err != nil {
+		return 0, err
+	}
+
 	if atomic.LoadInt32(&this.blockID) == _CANCEL_TASKS_ID {
 		return 0, nil
 	}
@@ -1420,6 +2254,17 @@ func (this *Reader) processBlock() (int64, error) {
 	copy(listeners, this.listeners)
 	decoded := int64(0)
 
+	if this.ra != nil {
+		// Locate all the blocks first to read them concurrently
+		if err := this.buildIndex(); err != nil {
+			return 0, err
+		}
+
+		if this.nbInputBlocks == 0 {
+			this.nbInputBlocks = min(len(this.index), _MAX_CONCURRENCY-1)
+		}
+	}
+
 	nbTasks := this.jobs
 	var jobsPerTask []uint
 
@@ -1443,22 +2288,29 @@ func (this *Reader) processBlock() (int64, error) {
 	}
 
 	for {
-		results := make([]decodingTaskResult, nbTasks)
-		wg := sync.WaitGroup{}
 		firstID := this.blockID
+		nbBlocks := nbTasks
 
-		// Invoke as many go routines as required
-		for taskID := 0; taskID < nbTasks; taskID++ {
-			if len(this.buffers[taskID].Buf) < int(bufSize) {
-				this.buffers[taskID].Buf = make([]byte, bufSize)
+		if this.ra != nil {
+			if nbBlocks = min(nbTasks, len(this.index)-int(firstID)); nbBlocks <= 0 {
+				// Reached end of stream
+				atomic.StoreUint64(&this.raRead, uint64(this.ra.Size()))
+				atomic.StoreInt32(&this.blockID, _CANCEL_TASKS_ID)
+				break
 			}
+		}
 
-			copyCtx := make(map[string]any)
+		results := make([]decodingTaskResult, nbBlocks)
+		wg := sync.WaitGroup{}
+		flushEnd := int32(0)
 
-			for k, v := range this.ctx {
-				copyCtx[k] = v
+		// Invoke as many go routines as required
+		for taskID := 0; taskID < nbBlocks; taskID++ {
+			if len(this.buffers[taskID].Buf) < int(bufSize) {
+				this.buffers[taskID].Buf = make([]byte, bufSize)
 			}
 
+			copyCtx := this.taskCtx(taskID)
 			copyCtx["jobs"] = jobsPerTask[taskID]
 			results[taskID] = decodingTaskResult{}
 			wg.Add(1)
@@ -1473,39 +2325,88 @@ func (this *Reader) processBlock() (int64, error) {
 				blockEntropyType:   this.entropyType,
 				currentBlockID:     firstID + int32(taskID) + 1,
 				processedBlockID:   &this.blockID,
+				autoMode:           this.flags&_HEADER_FLAG_AUTO != 0,
+				cipher:             this.cipher,
+				maxLength:          this.maxBufferSize,
+				maxDecoded:         this.maxDecodedLength(),
 				wg:                 &wg,
 				listeners:          listeners,
 				ibs:                this.ibs,
 				ctx:                copyCtx}
 
+			if this.ra != nil {
+				// Each task reads its own block from the input
+				entry := this.index[int(firstID)+taskID]
+				task.blockStream = func() (kanzi.InputBitStream, error) {
+					return this.newBitStreamAt(entry.Offset, blockStreamBufferSize(entry))
+				}
+
+				task.streamStart = entry.Offset &^ 7
+			} else {
+				// The next tasks stop reading after the block ending a flush
+				task.flushEnd = &flushEnd
+			}
+
 			// Invoke the tasks concurrently
 			go task.decode(&results[taskID])
 		}
 
+		// Stop the tasks if the context is done
+		stop := cancelOnDone(this.cancelCtx, &this.blockID)
+
 		// Wait for completion of all tasks
 		wg.Wait()
+		stop()
+
+		if err := contextError(this.cancelCtx); err != nil {
+			return decoded, err
+		}
+
+		if this.ra != nil && atomic.LoadInt32(&this.blockID) != _CANCEL_TASKS_ID {
+			// The tasks may have completed in any order
+			atomic.StoreInt32(&this.blockID, firstID+int32(nbBlocks))
+			last := this.index[int(firstID)+nbBlocks-1]
+			atomic.StoreUint64(&this.raRead, (last.Offset+last.Size+7)>>3)
+		}
 
 		// Process results
 		n, skipped := 0, 0
 
 		for _, r := range results {
+			if r.unread == true {
+				continue
+			}
+
+			if r.end == true {
+				this.endBlockID = r.blockID
+			}
+
 			if r.skipped == true {
 				skipped++
 				continue
 			}
 
 			if r.decoded > this.blockSize {
-				return decoded, &IOError{msg: "Invalid data", code: kanzi.ERR_PROCESS_BLOCK}
+				return decoded, &IOError{msg: "Invalid data", code: kanzi.ERR_PROCESS_BLOCK, block: r.blockID}
 			}
 
 			decoded += int64(r.decoded)
 
 			if r.err != nil {
+				if r.err.block == 0 {
+					r.err.block = r.blockID
+				}
+
 				return decoded, r.err
 			}
 
 			copy(this.buffers[n].Buf, r.data[0:r.decoded])
+			this.bufLengths[n] = r.decoded
 			n++
+
+			if r.decoded > 0 {
+				this.decodedBlocks++
+			}
 			hashType := kanzi.EVT_HASH_NONE
 
 			if this.hasher32 != nil {
@@ -1523,20 +2424,114 @@ func (this *Reader) processBlock() (int64, error) {
 		}
 
 		// Unless all blocks were skipped, exit the loop (usual case)
-		if skipped != nbTasks {
+		if skipped != nbBlocks {
 			break
 		}
 	}
 
+	this.bufID = 0
 	this.consumed = 0
 	return decoded, nil
 }
 
+// verifyTrailer checks the number of blocks, the size and the checksum of the
+// decompressed data against the values in the trailer (if any). The trailer
+// of an encrypted stream is always authenticated to detect a truncation.
+// Once only.
+func (this *Reader) verifyTrailer() (err error) {
+	if this.digest == nil && (this.cipher == nil || this.trailerRead == true) {
+		return nil
+	}
+
+	digest := this.digest
+	this.digest = nil
+	this.trailerRead = true
+	var trailer [5]uint64 // number of blocks and 32 bit halves of the size and checksum
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &IOError{msg: "Invalid bitstream: missing trailer", code: kanzi.ERR_CONTENT_CHECK}
+		}
+	}()
+
+	ibs := this.ibs
+	nbBlocks := this.endBlockID - 1
+
+	if this.ra != nil {
+		// The trailer follows the last block and the end block (8 bits)
+		pos := this.headerSize
+		nbBlocks = len(this.index)
+
+		if nbBlocks > 0 {
+			last := this.index[nbBlocks-1]
+			pos = last.Offset + last.Size
+		}
+
+		if ibs, err = this.newBitStreamAt(pos+8, 1024); err != nil {
+			return &IOError{msg: "Invalid bitstream: missing trailer", code: kanzi.ERR_CONTENT_CHECK}
+		}
+	}
+
+	if this.cipher != nil {
+		data := make([]byte, _TRAILER_SIZE+_CIPHER_TAG_SIZE)
+		ibs.ReadArray(data, uint(8*len(data)))
+		size, checksum, err := this.cipher.openTrailer(data, int32(nbBlocks))
+
+		if err != nil {
+			errMsg := "Cannot decrypt the trailer: truncated stream or corrupted data"
+			return &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+		}
+
+		trailer = [5]uint64{uint64(nbBlocks), size >> 32, size & 0xFFFFFFFF, checksum >> 32, checksum & 0xFFFFFFFF}
+	} else {
+		for i := range trailer {
+			trailer[i] = ibs.ReadBits(32)
+		}
+	}
+
+	if digest == nil {
+		return nil
+	}
+
+	if trailer[0] != uint64(this.decodedBlocks) {
+		errMsg := fmt.Sprintf("Content checksum failure: %d block(s) decoded, %d expected", this.decodedBlocks, trailer[0])
+		return &IOError{msg: errMsg, code: kanzi.ERR_CONTENT_CHECK}
+	}
+
+	if size := trailer[1]<<32 | trailer[2]; size != digest.Size() {
+		errMsg := fmt.Sprintf("Content checksum failure: %d byte(s) decoded, %d expected", digest.Size(), size)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CONTENT_CHECK}
+	}
+
+	if checksum := trailer[3]<<32 | trailer[4]; checksum != digest.Sum64() {
+		errMsg := fmt.Sprintf("Content checksum failure: got %016x, expected %016x", digest.Sum64(), checksum)
+		return &IOError{msg: errMsg, code: kanzi.ERR_CONTENT_CHECK}
+	}
+
+	return nil
+}
+
 // GetRead returns the number of bytes read so far
 func (this *Reader) GetRead() uint64 {
+	if read := atomic.LoadUint64(&this.raRead); read > 0 {
+		// The blocks were read from their own bitstreams
+		return read
+	}
+
 	return (this.ibs.Read() + 7) >> 3
 }
 
+// taskCtx returns a copy of the context for the task, reusing the maps
+// allocated by previous calls (the tasks modify their context).
+func (this *Reader) taskCtx(taskID int) map[string]any {
+	// The number of jobs may change with the header (memory limit)
+	if len(this.taskCtxs) < this.jobs {
+		this.taskCtxs = make([]map[string]any, this.jobs)
+	}
+
+	return copyContext(&this.taskCtxs[taskID], this.ctx)
+}
+
 // Decode mode + transformed entropy coded data
 // mode | 0b10000000 => copy block
 // mode | 0b0yy00000 => size(size(block))-1
@@ -1555,6 +2550,8 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	decoded := 0
 	checksum1 := uint64(0)
 	skipped := false
+	unread := false
+	component := "" // codec decoding the block, used to report errors
 
 	defer func() {
 		res.data = this.iBuffer.Buf
@@ -1563,15 +2560,24 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		res.completionTime = time.Now()
 		res.checksum = checksum1
 		res.skipped = skipped
+		res.unread = unread
 
 		if r := recover(); r != nil {
-			err, ok := r.(error)
+			// Report the failing codec instead of a bare runtime error
+			err, _ := r.(error)
+			errMsg := fmt.Sprint(r)
 
-			if ok {
-				res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
-			} else {
-				res.err = &IOError{msg: "Unknown error", code: kanzi.ERR_PROCESS_BLOCK}
+			if component != "" {
+				errMsg = component + ": " + errMsg
 			}
+
+			res.err = &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK, err: err, component: component}
+		}
+
+		if unread == true {
+			// Neither read nor decoded, the next block ID is unchanged
+			this.wg.Done()
+			return
 		}
 
 		// Unblock other tasks
@@ -1584,29 +2590,53 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		this.wg.Done()
 	}()
 
-	// Lock free synchronization
-	for n := 0; ; n++ {
-		taskID := atomic.LoadInt32(this.processedBlockID)
-
-		if taskID == _CANCEL_TASKS_ID {
+	if this.blockStream != nil {
+		if atomic.LoadInt32(this.processedBlockID) == _CANCEL_TASKS_ID {
 			return
 		}
 
-		if taskID == this.currentBlockID-1 {
-			break
+		// Read the block from a bitstream private to the task
+		ibs, err := this.blockStream()
+
+		if err != nil {
+			res.err = &IOError{msg: err.Error(), code: kanzi.ERR_READ_FILE}
+			return
 		}
 
-		if n&0x1F == 0 {
-			runtime.Gosched()
+		this.ibs = ibs
+	} else {
+		// Lock free synchronization
+		for n := 0; ; n++ {
+			taskID := atomic.LoadInt32(this.processedBlockID)
+
+			if taskID == _CANCEL_TASKS_ID {
+				return
+			}
+
+			if this.flushEnd != nil && atomic.LoadInt32(this.flushEnd) == 1 {
+				// A previous block ends a flush of the writer. Return the data
+				// decoded so far instead of waiting for the next block.
+				unread = true
+				return
+			}
+
+			if taskID == this.currentBlockID-1 {
+				break
+			}
+
+			if n&0x1F == 0 {
+				runtime.Gosched()
+			}
 		}
 	}
 
 	// Read shared bitstream sequentially
-	blockOffset := this.ibs.Read()
+	blockOffset := this.streamStart + this.ibs.Read()
 	lr := uint(this.ibs.ReadBits(5)) + 3
 	read := this.ibs.ReadBits(lr)
 
 	if read == 0 {
+		res.end = true
 		return
 	}
 
@@ -1616,6 +2646,14 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	}
 
 	r := int((read + 7) >> 3)
+	blockBits := read
+
+	if this.maxLength > 0 && r > this.maxLength {
+		errMsg := fmt.Sprintf("Block %d exceeds the memory limit: %d bytes", this.currentBlockID, r)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_MEMORY_LIMIT}
+		return
+	}
+
 	maxL := r
 
 	if int(this.blockLength) > r {
@@ -1642,7 +2680,15 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 
 	// After completion of the bitstream reading, increment the block id.
 	// It unblocks the task processing the next block (if any)
-	atomic.StoreInt32(this.processedBlockID, this.currentBlockID)
+	if this.blockStream == nil {
+		if this.flushEnd != nil && lr > 3 && blockBits>>(lr-1) == 0 {
+			// The size field is longer than required: the block ends a flush
+			// (see Writer.Flush). Must be set before the next task is unblocked.
+			atomic.StoreInt32(this.flushEnd, 1)
+		}
+
+		atomic.StoreInt32(this.processedBlockID, this.currentBlockID)
+	}
 
 	// Check if the block must be skipped
 	if v, hasKey := this.ctx["from"]; hasKey {
@@ -1660,10 +2706,35 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	}
 
 	// All the code below is concurrent
+	if this.cipher != nil {
+		// Authenticate and decrypt the block (ignore the alignment bits)
+		plain, err := this.cipher.open(data[0:blockBits>>3], this.currentBlockID, false)
+
+		if err != nil {
+			errMsg := fmt.Sprintf("Cannot decrypt block %d: invalid password or corrupted data", this.currentBlockID)
+			res.err = &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+			return
+		}
+
+		r = len(plain)
+	}
+
 	// Create a bitstream local to the task
 	bufStream := internal.NewBufferStream(data[0:r])
 	ibs, _ := bitstream.NewDefaultInputBitStream(bufStream, 16384)
 
+	if this.autoMode == true {
+		// Read the codecs selected for the block
+		this.blockEntropyType = uint32(ibs.ReadBits(5))
+		this.blockTransformType = ibs.ReadBits(48)
+
+		if err := setCodecNames(this.ctx, this.blockTransformType, this.blockEntropyType); err != nil {
+			errMsg := fmt.Sprintf("Invalid codec in block %d: %v", this.currentBlockID, err)
+			res.err = &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+			return
+		}
+	}
+
 	mode := byte(ibs.ReadBits(8))
 	skipFlags := byte(0)
 
@@ -1682,15 +2753,19 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	length := dataSize << 3
 	mask := uint64(1<<length) - 1
 	preTransformLength := uint(ibs.ReadBits(length) & mask)
-	maxTransformLength := min(max(this.blockLength+this.blockLength/2, 2048), _MAX_BITSTREAM_BLOCK_SIZE)
-
-	if preTransformLength == 0 || preTransformLength > maxTransformLength {
+	if preTransformLength == 0 || preTransformLength > maxTransformLength(this.blockLength) {
 		// Error => cancel concurrent decoding tasks
 		errMsg := fmt.Sprintf("Invalid compressed block size: %d", preTransformLength)
 		res.err = &IOError{msg: errMsg, code: kanzi.ERR_BLOCK_SIZE}
 		return
 	}
 
+	if this.maxLength > 0 && int(preTransformLength)+_EXTRA_BUFFER_SIZE > this.maxLength {
+		errMsg := fmt.Sprintf("Block %d exceeds the memory limit: %d bytes", this.currentBlockID, preTransformLength)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_MEMORY_LIMIT}
+		return
+	}
+
 	hashType := kanzi.EVT_HASH_NONE
 
 	// Extract checksum from bit stream (if any)
@@ -1703,14 +2778,8 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	}
 
 	if len(this.listeners) > 0 {
-		if v, hasKey := this.ctx["verbosity"]; hasKey {
-			if v.(uint) > 4 {
-				msg := fmt.Sprintf("{ \"type\":\"%s\", \"id\":%d, \"offset\":%d, \"skipFlags\":%.8b }",
-					"BLOCK_INFO", int(this.currentBlockID), blockOffset, skipFlags)
-				evt1 := kanzi.NewEventFromString(kanzi.EVT_BLOCK_INFO, int(this.currentBlockID), msg, time.Now())
-				notifyListeners(this.listeners, evt1)
-			}
-		}
+		evt1 := kanzi.NewBlockInfoEvent(int(this.currentBlockID), int64(blockOffset), skipFlags, time.Now())
+		notifyListeners(this.listeners, evt1)
 
 		// Notify before entropy
 		evt2 := kanzi.NewEvent(kanzi.EVT_BEFORE_ENTROPY, int(this.currentBlockID),
@@ -1726,21 +2795,44 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 	}
 
 	this.ctx["size"] = preTransformLength
+	tName, _ := transform.GetName(this.blockTransformType)
+	eName, _ := entropy.GetName(this.blockEntropyType)
+
+	// Create the transform before the entropy decoder to validate the size
+	// of the block in strict mode
+	component = tName + " transform"
+	t, err := transform.New(&this.ctx, this.blockTransformType)
+
+	if err != nil {
+		// Error => return
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC, component: component}
+		return
+	}
+
+	// The transforms cannot expand the data beyond the maximum encoded length
+	// of the declared block size
+	if this.maxDecoded > 0 && int(preTransformLength) > t.MaxEncodedLen(this.maxDecoded) {
+		errMsg := fmt.Sprintf("%s: invalid compressed block size: %d", component, preTransformLength)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_BLOCK_SIZE, component: component}
+		return
+	}
 
 	// Each block is decoded separately
 	// Rebuild the entropy decoder to reset block statistics
+	component = eName + " entropy decoder"
 	ed, err := entropy.NewEntropyDecoder(ibs, this.ctx, this.blockEntropyType)
 
 	if err != nil {
 		// Error => cancel concurrent decoding tasks
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC}
+		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC, component: component}
 		return
 	}
 
 	// Block entropy decode
 	if _, err = ed.Read(buffer[0:preTransformLength]); err != nil {
 		// Error => cancel concurrent decoding tasks
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+		errMsg := fmt.Sprintf("%s: %v", component, err)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK, err: err, component: component}
 		return
 	}
 
@@ -1759,26 +2851,32 @@ func (this *decodingTask) decode(res *decodingTaskResult) {
 		notifyListeners(this.listeners, evt2)
 	}
 
-	this.ctx["size"] = preTransformLength
-	transform, err := transform.New(&this.ctx, this.blockTransformType)
+	component = tName + " transform"
+	t.SetSkipFlags(skipFlags)
+	var oIdx uint
+	dst := data
 
-	if err != nil {
-		// Error => return
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC}
-		return
+	if this.maxDecoded > 0 {
+		// The transforms fail rather than decode more than the declared block size
+		dst = dst[0:min(len(dst), maxInverseLength(t, skipFlags, this.maxDecoded))]
 	}
 
-	transform.SetSkipFlags(skipFlags)
-	var oIdx uint
-
 	// Inverse transform
-	if _, oIdx, err = transform.Inverse(buffer[0:preTransformLength], data); err != nil {
+	if _, oIdx, err = t.Inverse(buffer[0:preTransformLength], dst); err != nil {
 		// Error => return
-		res.err = &IOError{msg: err.Error(), code: kanzi.ERR_PROCESS_BLOCK}
+		errMsg := fmt.Sprintf("%s: %v", component, err)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK, err: err, component: component}
+		return
+	}
+
+	if this.maxDecoded > 0 && int(oIdx) > this.maxDecoded {
+		errMsg := fmt.Sprintf("%s: invalid decoded block size: %d", component, oIdx)
+		res.err = &IOError{msg: errMsg, code: kanzi.ERR_PROCESS_BLOCK, component: component}
 		return
 	}
 
 	decoded = int(oIdx)
+	component = ""
 
 	// Verify checksum
 	if this.hasher32 != nil {
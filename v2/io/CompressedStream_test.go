@@ -16,12 +16,26 @@ limitations under the License.
 package io
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	kanzi "github.com/flanglet/kanzi-go/v2"
 	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+	"io"
+	"io/fs"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestCompressedStream(b *testing.T) {
@@ -85,6 +99,106 @@ func TestCompressedStream(b *testing.T) {
 		sum += res
 	}
 
+	if res := compressWithReset(values[0:65536], incompressible[0:65536<<1]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		if res := compressWithFlush(values[0:65536<<1], jobs); res == 0 {
+			fmt.Println("Success")
+		} else {
+			fmt.Printf("Failure %v\n", res)
+			sum += res
+		}
+	}
+
+	if res := compressWithAutoCodecs(values[0:65536<<2], incompressible[0:65536<<2]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithContentChecksum(values[0 : 65536<<2]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithCorruptedBlock(values[0 : 65536<<2]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithPassword(values[0 : 65536<<2]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithMetadata(values[0:65536]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithDictionary(); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressArchive(values[0 : 65536<<1]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithInfo(values[0:65536<<1], incompressible[0:65536]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithEvents(values[0:65536<<2], incompressible[0:65536]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithCancel(values[0 : 65536<<4]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithMemoryLimit(values[0 : 65536<<4]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
+	if res := compressWithStrictMode(values[0 : 65536<<2]); res == 0 {
+		fmt.Println("Success")
+	} else {
+		fmt.Printf("Failure %v\n", res)
+		sum += res
+	}
+
 	fmt.Println()
 
 	if sum != 0 {
@@ -180,89 +294,2086 @@ func compress(block []byte, entropy, transform string) int {
 	return 0
 }
 
-func compressAfterWriteClose(block []byte) int {
-	fmt.Println("Test - write after close")
-	buf := make([]byte, len(block))
-	copy(buf, block)
+func compressWithReset(block1, block2 []byte) int {
+	fmt.Println("Test - reuse writer and reader after reset")
 	bs := internal.NewBufferStream()
-
-	os, err := NewWriter(bs, "NONE", "HUFFMAN", uint(len(block)), 1, 0, 0, false)
+	w, err := NewWriter(bs, "LZ", "HUFFMAN", 32768, 2, 32, int64(len(block1)), false)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		return 1
 	}
 
-	_, err = os.Write(block)
+	var r *Reader
 
-	if err != nil {
-		fmt.Printf("%v\n", err)
-		return 2
-	}
+	for i, block := range [][]byte{block1, block2, block1} {
+		if i > 0 {
+			bs = internal.NewBufferStream()
 
-	if err = os.Close(); err != nil {
-		fmt.Printf("%v\n", err)
-		return 3
-	}
+			if err = w.Reset(bs); err != nil {
+				fmt.Printf("%v\n", err)
+				return 2
+			}
+		}
 
-	_, err = os.Write(block)
+		if _, err = w.Write(block); err != nil {
+			fmt.Printf("%v\n", err)
+			return 3
+		}
 
-	if err != nil {
-		fmt.Printf("OK - expected error: %v\n", err)
-		return 0
+		if err = w.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+			return 4
+		}
+
+		if i == 0 {
+			r, err = NewReader(bs, 2)
+		} else {
+			err = r.Reset(bs)
+		}
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 5
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 6
+		}
+
+		if err = r.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+			return 7
+		}
+
+		if bytes.Equal(res, block) == false {
+			fmt.Printf("Invalid data after reset %d\n", i)
+			return 8
+		}
+
+		// The buffers are released by Close unless the writer has been reset
+		if released := len(w.buffers[0].Buf) == 0; released != (i == 0) {
+			fmt.Printf("Invalid buffers after close %d\n", i)
+			return 10
+		}
 	}
 
-	return 4
-}
+	if err = w.Reset(nil); err == nil {
+		fmt.Println("Reset with null stream should fail")
+		return 9
+	}
 
-func compressAfterReadClose(block []byte) int {
-	fmt.Println("Test - read after close")
-	bs := internal.NewBufferStream()
+	return 0
+}
 
-	os, err := NewWriter(bs, "NONE", "NONE", uint(len(block)), 1, 0, 0, false)
+func compressWithFlush(block []byte, jobs uint) int {
+	fmt.Printf("Test - flush blocks to a pipe, reader jobs: %d\n", jobs)
+	pr, pw := io.Pipe()
+	w, err := NewWriter(pw, "LZ", "HUFFMAN", 65536, 2, 32, 0, false)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		return 1
 	}
 
-	_, err = os.Write(block)
+	// Keep a copy of the stream to test random access
+	var compressed bytes.Buffer
+	r, err := NewReader(io.NopCloser(io.TeeReader(pr, &compressed)), jobs)
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
 		return 2
 	}
 
-	if err = os.Close(); err != nil {
+	// Short block, full block + short block, empty flush, short block
+	chunks := [][]byte{block[0:100], block[100:70100], block[0:0], block[70100:75100]}
+	acks := make(chan int)
+
+	go func() {
+		buf := make([]byte, len(block))
+
+		for _, chunk := range chunks {
+			read := 0
+
+			for read < len(chunk) {
+				n, err := r.Read(buf[read:])
+
+				if err != nil {
+					fmt.Printf("%v\n", err)
+					acks <- 3
+					return
+				}
+
+				read += n
+			}
+
+			if bytes.Equal(buf[0:read], chunk) == false {
+				fmt.Println("Invalid data after flush")
+				acks <- 4
+				return
+			}
+
+			acks <- 0
+		}
+
+		if _, err := r.Read(buf); err != io.EOF {
+			fmt.Printf("Expected EOF, got %v\n", err)
+			acks <- 5
+			return
+		}
+
+		acks <- 0
+	}()
+
+	for _, chunk := range chunks {
+		if _, err = w.Write(chunk); err != nil {
+			fmt.Printf("%v\n", err)
+			return 6
+		}
+
+		if err = w.Flush(); err != nil {
+			fmt.Printf("%v\n", err)
+			return 7
+		}
+
+		// The reader must get the data before the stream is closed
+		select {
+		case res := <-acks:
+			if res != 0 {
+				return res
+			}
+		case <-time.After(10 * time.Second):
+			fmt.Println("Timeout: flushed data not available to the reader")
+			return 8
+		}
+	}
+
+	if err = w.Close(); err != nil {
 		fmt.Printf("%v\n", err)
-		return 3
+		return 9
 	}
 
-	is, err := NewReader(bs, 1)
+	if res := <-acks; res != 0 {
+		return res
+	}
+
+	if err = w.Flush(); err == nil {
+		fmt.Println("Flush after close should fail")
+		return 10
+	}
+
+	// No block index: the short blocks must be located by the scan
+	ra, err := NewReaderAt(bytes.NewReader(compressed.Bytes()), int64(compressed.Len()), map[string]any{"jobs": jobs})
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
-		return 4
+		return 11
 	}
 
-	_, err = is.Read(block)
+	expected := make([]byte, 0, len(block))
+
+	for _, chunk := range chunks {
+		expected = append(expected, chunk...)
+	}
+
+	index, err := ra.Index()
 
 	if err != nil {
 		fmt.Printf("%v\n", err)
-		return 5
+		return 12
 	}
 
-	if err = is.Close(); err != nil {
-		fmt.Printf("%v\n", err)
-		return 6
+	if last := index[len(index)-1]; last.Position+int64(last.OriginalSize) != int64(len(expected)) {
+		fmt.Printf("Invalid stream size in index: %d\n", last.Position+int64(last.OriginalSize))
+		return 13
 	}
 
-	_, err = is.Read(block)
+	for _, off := range []int{0, 90, 100, 65636, 70099, 70100, len(expected) - 10} {
+		buf := make([]byte, min(2000, len(expected)-off))
+
+		if _, err = ra.ReadAt(buf, int64(off)); err != nil {
+			fmt.Printf("%v\n", err)
+			return 14
+		}
+
+		if bytes.Equal(buf, expected[off:off+len(buf)]) == false {
+			fmt.Printf("Invalid data read at %d\n", off)
+			return 15
+		}
+	}
+
+	return 0
+}
+
+func compressWithAutoCodecs(block1, block2 []byte) int {
+	fmt.Println("Test - automatic codec selection per block")
+	block := append(append([]byte{}, block1...), block2...)
+	sizes := make([]int, 0)
+
+	for _, candidates := range []string{"", "NONE&NONE,LZ&HUFFMAN,TEXT+BWT+MTFT+ZRLT&ANS0"} {
+		bs := internal.NewBufferStream()
+		ctx := make(map[string]any)
+		ctx["entropy"] = "NONE"
+		ctx["transform"] = "NONE"
+		ctx["blockSize"] = uint(65536)
+		ctx["jobs"] = uint(2)
+		ctx["checksum"] = uint(32)
+		ctx["blockIndex"] = true
+		ctx["autoCandidates"] = candidates
+		ctx["autoBudget"] = uint(10000)
+		w, err := NewWriterWithCtx(bs, ctx)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 1
+		}
+
+		if _, err = w.Write(block); err != nil {
+			fmt.Printf("%v\n", err)
+			return 2
+		}
+
+		if err = w.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+			return 3
+		}
+
+		compressed := make([]byte, bs.Len())
+		bs.Read(compressed)
+		sizes = append(sizes, len(compressed))
+		r, err := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(2)})
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 4
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 5
+		}
+
+		if bytes.Equal(res, block) == false {
+			fmt.Println("Invalid data after sequential read")
+			return 6
+		}
+
+		// Decode a single block
+		buf := make([]byte, 1000)
+
+		if _, err = r.ReadAt(buf, int64(len(block1))-500); err != nil {
+			fmt.Printf("%v\n", err)
+			return 7
+		}
+
+		if bytes.Equal(buf, block[len(block1)-500:len(block1)+500]) == false {
+			fmt.Println("Invalid data after random access")
+			return 8
+		}
+	}
+
+	fmt.Printf("Compressed size without/with automatic selection: %d/%d\n", sizes[0], sizes[1])
+
+	if sizes[1] >= sizes[0] {
+		fmt.Println("The automatic selection should improve the compression")
+		return 9
+	}
+
+	return 0
+}
+
+func compressWithContentChecksum(block []byte) int {
+	fmt.Println("Test - content checksum in the stream trailer")
+	bs := internal.NewBufferStream()
+	ctx := make(map[string]any)
+	ctx["entropy"] = "ANS0"
+	ctx["transform"] = "LZ"
+	ctx["blockSize"] = uint(65536)
+	ctx["jobs"] = uint(4)
+	ctx["checksum"] = uint(0)
+	ctx["contentChecksum"] = true
+	ctx["blockIndex"] = true
+	w, err := NewWriterWithCtx(bs, ctx)
 
 	if err != nil {
-		fmt.Printf("OK - expected error: %v\n", err)
-		return 0
+		fmt.Printf("%v\n", err)
+		return 1
 	}
 
-	return 7
+	if _, err = w.Write(block); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+
+	for _, jobs := range []uint{1, 4} {
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": jobs})
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 4
+		}
+
+		if bytes.Equal(res, block) == false {
+			fmt.Println("Invalid data after decompression")
+			return 5
+		}
+
+		ra, _ := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": jobs})
+
+		if res, err = io.ReadAll(ra); err != nil {
+			fmt.Printf("%v\n", err)
+			return 6
+		}
+
+		if bytes.Equal(res, block) == false {
+			fmt.Println("Invalid data after decompression (random access reader)")
+			return 7
+		}
+	}
+
+	// Corrupt the checksum in the trailer (located before the index)
+	r, _ := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1)})
+	index, _ := r.Index()
+	last := index[len(index)-1]
+	pos := (last.Offset+last.Size+8+160)>>3 - 2
+	corrupted := append([]byte{}, compressed...)
+	corrupted[pos] ^= 0x10
+
+	for _, jobs := range []uint{1, 4} {
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": jobs})
+		_, err := io.ReadAll(r)
+		var ioErr *IOError
+
+		if errors.As(err, &ioErr) == false || ioErr.ErrorCode() != kanzi.ERR_CONTENT_CHECK {
+			fmt.Printf("Expected a content checksum error, got: %v\n", err)
+			return 8
+		}
+
+		fmt.Printf("OK - expected error: %v\n", err)
+	}
+
+	// No verification after a seek
+	ra, _ := NewReaderAt(bytes.NewReader(corrupted), int64(len(corrupted)), map[string]any{"jobs": uint(2)})
+	ra.Seek(100000, io.SeekStart)
+
+	if res, err := io.ReadAll(ra); err != nil || bytes.Equal(res, block[100000:]) == false {
+		fmt.Printf("Invalid data after seek: %v\n", err)
+		return 9
+	}
+
+	return 0
+}
+
+func compressWithCorruptedBlock(block []byte) int {
+	fmt.Println("Test - ID of the corrupted block")
+	bs := internal.NewBufferStream()
+	ctx := make(map[string]any)
+	ctx["entropy"] = "HUFFMAN"
+	ctx["transform"] = "LZ"
+	ctx["blockSize"] = uint(65536)
+	ctx["jobs"] = uint(4)
+	ctx["checksum"] = uint(32)
+	ctx["blockIndex"] = true
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	if _, err = w.Write(block); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+
+	// Corrupt the middle of the third block
+	r, _ := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1)})
+	index, err := r.Index()
+
+	if err != nil || len(index) != 4 {
+		fmt.Printf("Invalid block index: %v\n", err)
+		return 4
+	}
+
+	corrupted := append([]byte{}, compressed...)
+	corrupted[(index[2].Offset+index[2].Size/2)>>3] ^= 0x55
+
+	for _, jobs := range []uint{1, 4} {
+		r1, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": jobs})
+		r2, _ := NewReaderAt(bytes.NewReader(corrupted), int64(len(corrupted)), map[string]any{"jobs": jobs})
+		readers := []io.Reader{r1, r2}
+
+		for _, r := range readers {
+			_, err := io.ReadAll(r)
+			var ioErr *IOError
+
+			if errors.As(err, &ioErr) == false || ioErr.BlockID() != 3 {
+				fmt.Printf("Expected an error in block 3, got: %v\n", err)
+				return 5
+			}
+
+			fmt.Printf("OK - expected error in block %d: %v\n", ioErr.BlockID(), err)
+		}
+	}
+
+	// Errors unrelated to a block
+	r3, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed[0:8])), map[string]any{"jobs": uint(1)})
+	_, err = io.ReadAll(r3)
+	var ioErr *IOError
+
+	if errors.As(err, &ioErr) == false || ioErr.BlockID() != 0 {
+		fmt.Printf("Expected an error unrelated to a block, got: %v\n", err)
+		return 6
+	}
+
+	return 0
+}
+
+func compressArchive(block []byte) int {
+	fmt.Println("Test - archive of several files in shared blocks")
+	mtime := time.Unix(1700000000, 123456789)
+	entries := []ArchiveEntry{
+		{Name: "a.txt", Mode: 0644, ModTime: mtime, Size: 1000},
+		{Name: "dir/empty", Mode: 0600, ModTime: mtime, Size: 0},
+		{Name: "dir/link", Mode: fs.ModeSymlink | 0777, ModTime: mtime, Link: "../a.txt"},
+		{Name: "dir/sub/b.bin", Mode: 0755, ModTime: mtime, Size: int64(len(block) - 1000)},
+	}
+
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"entropy": "HUFFMAN", "transform": "LZ", "blockSize": uint(65536), "jobs": uint(2), "checksum": uint(0)}
+	w, _ := NewWriterWithCtx(bs, ctx)
+	aw, err := NewArchiveWriter(w, entries)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	offset := 0
+
+	for {
+		e, err := aw.Next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 2
+		}
+
+		if _, err = aw.Write(block[offset : offset+int(e.Size)]); err != nil {
+			fmt.Printf("%v\n", err)
+			return 3
+		}
+
+		offset += int(e.Size)
+	}
+
+	if err = aw.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 4
+	}
+
+	w.Close()
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	fmt.Printf("%d files, %d bytes => %d bytes\n", len(entries), len(block), len(compressed))
+	r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(2)})
+	ar, err := NewArchiveReader(r)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 5
+	}
+
+	if len(ar.Entries()) != len(entries) {
+		fmt.Printf("Invalid number of entries: %d\n", len(ar.Entries()))
+		return 6
+	}
+
+	offset = 0
+
+	for i := range entries {
+		e, err := ar.Next()
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 7
+		}
+
+		if e.Name != entries[i].Name || e.Mode != entries[i].Mode || e.Size != entries[i].Size ||
+			e.Link != entries[i].Link || e.ModTime.Equal(mtime) == false {
+			fmt.Printf("Invalid entry: %+v\n", *e)
+			return 8
+		}
+
+		// Skip the content of the first file
+		if i == 0 {
+			offset += int(e.Size)
+			continue
+		}
+
+		res, err := io.ReadAll(ar)
+
+		if err != nil || bytes.Equal(res, block[offset:offset+int(e.Size)]) == false {
+			fmt.Printf("Invalid content for entry '%s': %v\n", e.Name, err)
+			return 9
+		}
+
+		offset += int(e.Size)
+	}
+
+	if _, err = ar.Next(); err != io.EOF {
+		fmt.Printf("Expected end of archive, got: %v\n", err)
+		return 10
+	}
+
+	// Names escaping the archive root are rejected
+	for _, name := range []string{"../a", "/etc/passwd", "a/../../b", ""} {
+		invalid := []ArchiveEntry{{Name: name, Mode: 0644, ModTime: mtime}}
+
+		if _, err = NewArchiveWriter(io.Discard, invalid); err == nil {
+			fmt.Printf("Expected an error for name '%s'\n", name)
+			return 11
+		}
+	}
+
+	// Missing content
+	aw, _ = NewArchiveWriter(io.Discard, entries)
+	aw.Next()
+	aw.Write(block[0:10])
+
+	if err = aw.Close(); err == nil {
+		fmt.Println("Expected an error for missing content")
+		return 12
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// A truncated table announcing the maximum number of entries must not
+	// allocate the whole table upfront
+	table := binary.BigEndian.AppendUint32(nil, _ARCHIVE_MAGIC)
+	table = append(table, _ARCHIVE_VERSION)
+	table = binary.AppendUvarint(table, _ARCHIVE_MAX_ENTRIES)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	if _, err = NewArchiveReader(bytes.NewReader(table)); err == nil {
+		fmt.Println("Expected an error for truncated file table")
+		return 13
+	}
+
+	runtime.ReadMemStats(&after)
+
+	if after.TotalAlloc-before.TotalAlloc > 1<<20 {
+		fmt.Printf("Too much memory allocated for truncated file table: %d\n", after.TotalAlloc-before.TotalAlloc)
+		return 14
+	}
+
+	return 0
+}
+
+func compressWithInfo(block1, block2 []byte) int {
+	fmt.Println("Test - stream info without decoding the blocks")
+	bs := internal.NewBufferStream()
+	ctx := make(map[string]any)
+	ctx["entropy"] = "HUFFMAN"
+	ctx["transform"] = "LZ"
+	ctx["blockSize"] = uint(65536)
+	ctx["jobs"] = uint(2)
+	ctx["checksum"] = uint(64)
+	ctx["skipBlocks"] = true
+	ctx["contentChecksum"] = true
+	ctx["password"] = "secret"
+	ctx["fileSize"] = int64(len(block1) + len(block2))
+	w, _ := NewWriterWithCtx(bs, ctx)
+	w.Write(block1)
+	w.Write(block2)
+
+	if err := w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	var decrypted *StreamInfo
+
+	for _, password := range []string{"", "secret"} {
+		rctx := map[string]any{"jobs": uint(1)}
+
+		if len(password) > 0 {
+			rctx["password"] = password
+		}
+
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), rctx)
+		info, err := r.Info()
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 2
+		}
+
+		fmt.Printf("%d blocks, %d bits => %d bytes\n", len(info.Blocks), info.CompressedSize, info.OriginalSize)
+
+		if info.Entropy != "HUFFMAN" || info.Transform != "LZ" || info.BlockSize != 65536 || info.Checksum != 64 ||
+			info.OriginalSize != int64(len(block1)+len(block2)) || info.Encrypted == false || info.ContentChecksum == false {
+			fmt.Println("Invalid stream info")
+			return 3
+		}
+
+		if len(info.Blocks) != 3 || info.Blocks[0].Offset != info.HeaderSize {
+			fmt.Println("Invalid block info")
+			return 4
+		}
+
+		end := info.HeaderSize
+
+		for _, b := range info.Blocks {
+			if b.Offset != end || b.Opaque != (len(password) == 0) {
+				fmt.Printf("Invalid block info: %+v\n", b)
+				return 5
+			}
+
+			end += b.Size
+		}
+
+		if info.CompressedSize != end+8 {
+			fmt.Printf("Invalid compressed size: %d\n", info.CompressedSize)
+			return 6
+		}
+
+		if len(password) > 0 && (info.Blocks[0].Copy == true || info.Blocks[2].Copy == false || info.Blocks[0].DataSize == 0) {
+			fmt.Println("Invalid block modes")
+			return 7
+		}
+
+		if n, err := r.Read(make([]byte, 16)); n != 0 || err == nil {
+			fmt.Println("Expected end of stream after info")
+			return 8
+		}
+
+		decrypted = info
+	}
+
+	// The encrypted blocks must fit in the memory limit
+	rctx := map[string]any{"jobs": uint(1), "password": "secret", "maxMemory": uint(1024)}
+	r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), rctx)
+	var ioErr *IOError
+
+	if _, err := r.Info(); errors.As(err, &ioErr) == false || ioErr.ErrorCode() != kanzi.ERR_MEMORY_LIMIT {
+		fmt.Printf("Expected a memory limit error, got: %v\n", err)
+		return 9
+	}
+
+	// Same blocks without encryption: only the block headers are read
+	delete(ctx, "password")
+	bs = internal.NewBufferStream()
+	w, _ = NewWriterWithCtx(bs, ctx)
+	w.Write(block1)
+	w.Write(block2)
+	w.Close()
+	compressed = make([]byte, bs.Len())
+	bs.Read(compressed)
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1)})
+	info, err := r.Info()
+
+	if err != nil || len(info.Blocks) != len(decrypted.Blocks) {
+		fmt.Printf("Invalid stream info: %v\n", err)
+		return 10
+	}
+
+	for i, b := range info.Blocks {
+		d := decrypted.Blocks[i]
+
+		if b.Copy != d.Copy || b.SkipFlags != d.SkipFlags || b.DataSize != d.DataSize || b.Checksum != d.Checksum {
+			fmt.Printf("Invalid block info: %+v, expected %+v\n", b, d)
+			return 11
+		}
+	}
+
+	return 0
+}
+
+func isDecryptionError(err error) bool {
+	var ioErr *IOError
+	return errors.As(err, &ioErr) && ioErr.ErrorCode() == kanzi.ERR_DECRYPTION
+}
+
+func compressWithPassword(block []byte) int {
+	fmt.Println("Test - encrypted blocks")
+	bs := internal.NewBufferStream()
+	ctx := make(map[string]any)
+	ctx["entropy"] = "HUFFMAN"
+	ctx["transform"] = "LZ"
+	ctx["blockSize"] = uint(65536)
+	ctx["jobs"] = uint(4)
+	ctx["checksum"] = uint(32)
+	ctx["password"] = "secret"
+	ctx["blockIndex"] = true
+	ctx["contentChecksum"] = true
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	// Include a flushed (aligned) block
+	if _, err = w.Write(block[0:1000]); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = w.Flush(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if _, err = w.Write(block[1000:]); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+
+	if bytes.Contains(compressed, block[0:64]) == true {
+		fmt.Println("Unencrypted data found in the output")
+		return 4
+	}
+
+	for _, jobs := range []uint{1, 4} {
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": jobs, "password": []byte("secret")})
+		res, err := io.ReadAll(r)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 5
+		}
+
+		if bytes.Equal(res, block) == false {
+			fmt.Println("Invalid data after decompression")
+			return 6
+		}
+	}
+
+	ra, _ := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(2), "password": "secret"})
+	buf := make([]byte, 1000)
+
+	if _, err := ra.ReadAt(buf, 100000); err != nil || bytes.Equal(buf, block[100000:101000]) == false {
+		fmt.Printf("Invalid data after random access: %v\n", err)
+		return 7
+	}
+
+	// Wrong or missing password
+	for _, password := range []any{"wrong", nil} {
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(2), "password": password})
+
+		if _, err = io.ReadAll(r); isDecryptionError(err) == false {
+			fmt.Printf("Expected a decryption error, got: %v\n", err)
+			return 8
+		}
+
+		fmt.Printf("OK - expected error: %v\n", err)
+	}
+
+	// Tamper with the data of the second block
+	r, _ := NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1), "password": "secret"})
+	index, _ := r.Index()
+	corrupted := append([]byte{}, compressed...)
+	corrupted[(index[1].Offset+index[1].Size/2)>>3] ^= 0x01
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": uint(2), "password": "secret"})
+
+	if _, err = io.ReadAll(r); isDecryptionError(err) == false {
+		fmt.Printf("Expected a decryption error, got: %v\n", err)
+		return 9
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// Tamper with the header: the checksum size is not covered by the header checksum
+	corrupted = append([]byte{}, compressed...)
+	corrupted[4] &^= 0x0C
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": uint(2), "password": "secret"})
+
+	if _, err = io.ReadAll(r); isDecryptionError(err) == false {
+		fmt.Printf("Expected a decryption error, got: %v\n", err)
+		return 10
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// Truncate the stream after the flushed (byte aligned) first block, then
+	// append an end block and the trailer of the original stream
+	last := index[len(index)-1]
+	trailerPos := (last.Offset+last.Size)>>3 + 1
+	trailer := compressed[trailerPos : trailerPos+_TRAILER_SIZE+_CIPHER_TAG_SIZE]
+	truncated := append([]byte{}, compressed[0:(index[0].Offset+index[0].Size)>>3]...)
+	truncated = append(append(truncated, 0), trailer...)
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(truncated)), map[string]any{"jobs": uint(2), "password": "secret"})
+
+	if _, err = io.ReadAll(r); isDecryptionError(err) == false {
+		fmt.Printf("Expected a decryption error, got: %v\n", err)
+		return 11
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// The block index is encrypted: not available without the password
+	r, _ = NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1)})
+
+	if _, err = r.Index(); err == nil {
+		fmt.Println("Expected an error reading the block index without the password")
+		return 12
+	}
+
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1), "password": "secret"})
+	info, err := r.Info()
+
+	if err != nil || info.ContentHash == 0 || info.OriginalSize != int64(len(block)) {
+		fmt.Printf("Invalid stream info: %v\n", err)
+		return 13
+	}
+
+	return 0
+}
+
+func jsonRecord(i int) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"name":"user%d","email":"user%d@example.com",`+
+		`"active":%v,"roles":["reader","writer"],"created":"2024-0%d-1%dT10:%02d:00Z"}`,
+		i, rand.Intn(100000), rand.Intn(100000), i%2 == 0, 1+i%9, i%10, i%60))
+}
+
+func compressWithMetadata(block []byte) int {
+	fmt.Println("Test - file metadata in the header")
+	md := &FileMetadata{
+		Mode:       0o755 | fs.ModeSetgid,
+		ModTime:    time.Unix(1700000000, 123456789),
+		AccessTime: time.Unix(1700000100, 0),
+		UID:        1000,
+		GID:        100,
+		Xattrs:     map[string][]byte{"user.origin": []byte("backup"), "user.empty": {}},
+	}
+
+	for _, password := range []string{"", "secret"} {
+		bs := internal.NewBufferStream()
+		ctx := map[string]any{"entropy": "HUFFMAN", "transform": "LZ", "blockSize": uint(65536),
+			"jobs": uint(2), "checksum": uint(32), "metadata": md}
+
+		if len(password) > 0 {
+			ctx["password"] = password
+		}
+
+		w, err := NewWriterWithCtx(bs, ctx)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 1
+		}
+
+		if _, err = w.Write(block); err != nil {
+			fmt.Printf("%v\n", err)
+			return 2
+		}
+
+		if err = w.Close(); err != nil {
+			fmt.Printf("%v\n", err)
+			return 3
+		}
+
+		compressed := make([]byte, bs.Len())
+		bs.Read(compressed)
+		r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(2), "password": password})
+
+		if r.Metadata() != nil {
+			fmt.Println("Unexpected metadata before reading the header")
+			return 4
+		}
+
+		res, err := io.ReadAll(r)
+
+		if err != nil || bytes.Equal(res, block) == false {
+			fmt.Printf("Invalid data after decompression: %v\n", err)
+			return 5
+		}
+
+		md2 := r.Metadata()
+
+		if md2 == nil || md2.Mode != md.Mode || md2.ModTime.Equal(md.ModTime) == false ||
+			md2.AccessTime.Equal(md.AccessTime) == false || md2.UID != md.UID || md2.GID != md.GID ||
+			len(md2.Xattrs) != 2 || string(md2.Xattrs["user.origin"]) != "backup" {
+			fmt.Printf("Invalid metadata: %+v\n", md2)
+			return 6
+		}
+
+		// Metadata only available with the password
+		r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1)})
+		info, err := r.Info()
+
+		if err != nil || (info.Metadata == nil) != (len(password) > 0) {
+			fmt.Printf("Invalid stream info: %v\n", err)
+			return 7
+		}
+
+		// Corrupt the metadata (after the header and the metadata length)
+		corrupted := append([]byte{}, compressed...)
+		pos := 20 + 4
+
+		if len(password) > 0 {
+			pos += 29 // cipher parameters
+		}
+
+		corrupted[pos+2] ^= 0x01
+		r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": uint(1), "password": password})
+		_, err = io.ReadAll(r)
+		var ioErr *IOError
+
+		if errors.As(err, &ioErr) == false || (ioErr.ErrorCode() != kanzi.ERR_CRC_CHECK && ioErr.ErrorCode() != kanzi.ERR_DECRYPTION) {
+			fmt.Printf("Expected a metadata error, got: %v\n", err)
+			return 8
+		}
+
+		fmt.Printf("OK - expected error: %v\n", err)
+	}
+
+	// The metadata applies to the first stream only
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"entropy": "NONE", "transform": "NONE", "blockSize": uint(65536), "jobs": uint(1),
+		"checksum": uint(0), "metadata": md}
+	w, _ := NewWriterWithCtx(bs, ctx)
+	w.Write(block)
+	w.Close()
+	bs2 := internal.NewBufferStream()
+	w.Reset(bs2)
+	w.Write(block)
+	w.Close()
+	r, _ := NewReaderWithCtx(bs2, map[string]any{"jobs": uint(1)})
+
+	if res, err := io.ReadAll(r); err != nil || bytes.Equal(res, block) == false || r.Metadata() != nil {
+		fmt.Printf("Unexpected metadata after reset: %v\n", err)
+		return 9
+	}
+
+	return 0
+}
+
+func isDictionaryError(err error) bool {
+	var ioErr *IOError
+	return errors.As(err, &ioErr) && ioErr.ErrorCode() == kanzi.ERR_DICTIONARY
+}
+
+func compressWithDictionary() int {
+	fmt.Println("Test - compression of small payloads with a dictionary")
+	samples := make([][]byte, 2000)
+
+	for i := range samples {
+		samples[i] = jsonRecord(i)
+	}
+
+	dict, err := TrainDictionary(samples, 4096)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	// Save and reload the dictionary
+	var buf bytes.Buffer
+
+	if _, err = dict.WriteTo(&buf); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if dict, err = ReadDictionary(&buf); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	other, _ := NewDictionary(bytes.Repeat([]byte("another dictionary"), 16))
+	payload := jsonRecord(12345)
+
+	for _, codecs := range [][2]string{{"LZ", "HUFFMAN"}, {"ROLZX", "NONE"}, {"TEXT+LZX", "ANS0"}, {"NONE", "CM"}, {"NONE", "TPAQ"}} {
+		sizes := make([]int, 0)
+
+		for _, d := range []*Dictionary{nil, dict} {
+			bs := internal.NewBufferStream()
+			ctx := make(map[string]any)
+			ctx["transform"] = codecs[0]
+			ctx["entropy"] = codecs[1]
+			ctx["blockSize"] = uint(65536)
+			ctx["jobs"] = uint(1)
+			ctx["checksum"] = uint(32)
+
+			if d != nil {
+				ctx["dictionary"] = d
+			}
+
+			w, err := NewWriterWithCtx(bs, ctx)
+
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return 4
+			}
+
+			if _, err = w.Write(payload); err != nil {
+				fmt.Printf("%v\n", err)
+				return 5
+			}
+
+			if err = w.Close(); err != nil {
+				fmt.Printf("%v\n", err)
+				return 6
+			}
+
+			compressed := make([]byte, bs.Len())
+			bs.Read(compressed)
+			sizes = append(sizes, len(compressed))
+			r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1), "dictionary": d})
+			res, err := io.ReadAll(r)
+
+			if err != nil {
+				fmt.Printf("%v\n", err)
+				return 7
+			}
+
+			if bytes.Equal(res, payload) == false {
+				fmt.Printf("Invalid data after decompression (%s&%s)\n", codecs[0], codecs[1])
+				return 8
+			}
+
+			if d == nil {
+				continue
+			}
+
+			// Decompress without dictionary or with the wrong one
+			for _, wrong := range []any{nil, other} {
+				r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1), "dictionary": wrong})
+
+				if _, err = io.ReadAll(r); isDictionaryError(err) == false {
+					fmt.Printf("Expected a dictionary error, got: %v\n", err)
+					return 9
+				}
+			}
+		}
+
+		fmt.Printf("%s&%s: compressed size without/with dictionary: %d/%d\n", codecs[0], codecs[1], sizes[0], sizes[1])
+
+		if sizes[1] >= sizes[0] {
+			fmt.Println("The dictionary should improve the compression")
+			return 10
+		}
+	}
+
+	return 0
+}
+
+// eventCollector keeps the events of a stream
+type eventCollector struct {
+	lock   sync.Mutex
+	events []*kanzi.Event
+}
+
+func (this *eventCollector) ProcessEvent(evt *kanzi.Event) {
+	this.lock.Lock()
+	this.events = append(this.events, evt)
+	this.lock.Unlock()
+}
+
+// blockInfos returns the skip flags and offsets of the BLOCK_INFO events by block ID
+func (this *eventCollector) blockInfos() map[int]*kanzi.Event {
+	res := make(map[int]*kanzi.Event)
+
+	for _, evt := range this.events {
+		if evt.Type() == kanzi.EVT_BLOCK_INFO {
+			res[evt.ID()] = evt
+		}
+	}
+
+	return res
+}
+
+func compressWithEvents(block1, block2 []byte) int {
+	fmt.Println("Test - typed block and header events")
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"entropy": "HUFFMAN", "transform": "LZ+ZRLT", "blockSize": uint(65536),
+		"jobs": uint(2), "checksum": uint(32), "skipBlocks": true, "blockIndex": true}
+	w, _ := NewWriterWithCtx(bs, ctx)
+	wEvents := &eventCollector{}
+	w.AddListener(wEvents)
+	w.Write(block1)
+	w.Write(block2)
+
+	if err := w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(1)})
+	info, err := r.Info()
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	// Random access and sequential decoding must report the same offsets
+	for _, ra := range []bool{true, false} {
+		var r *Reader
+
+		if ra == true {
+			r, err = NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(2)})
+		} else {
+			r, err = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(2)})
+		}
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 3
+		}
+
+		rEvents := &eventCollector{}
+		r.AddListener(rEvents)
+
+		if _, err = io.ReadAll(r); err != nil {
+			fmt.Printf("%v\n", err)
+			return 4
+		}
+
+		var header *kanzi.HeaderInfo
+
+		for _, evt := range rEvents.events {
+			if evt.Type() == kanzi.EVT_AFTER_HEADER_DECODING {
+				header = evt.Header()
+			}
+		}
+
+		if header == nil || header.Entropy != "HUFFMAN" || header.Transform != "LZ+ZRLT" || header.Checksum != 32 ||
+			header.BlockSize != 65536 || header.OriginalSize != 0 {
+			fmt.Printf("Invalid header event: %+v\n", header)
+			return 5
+		}
+
+		for _, events := range []*eventCollector{wEvents, rEvents} {
+			infos := events.blockInfos()
+
+			if len(infos) != len(info.Blocks) {
+				fmt.Printf("Invalid number of block events: %d\n", len(infos))
+				return 6
+			}
+
+			for _, b := range info.Blocks {
+				if evt := infos[b.ID]; evt == nil || evt.Offset() != int64(b.Offset) ||
+					(b.Copy == false && evt.SkipFlags() != b.SkipFlags) {
+					fmt.Printf("Invalid block event for block %d: %v\n", b.ID, evt)
+					return 7
+				}
+			}
+
+			for _, evt := range events.events {
+				buf, err := json.Marshal(evt)
+
+				if err != nil || json.Valid(buf) == false {
+					fmt.Printf("Invalid JSON event: %s\n", buf)
+					return 8
+				}
+			}
+		}
+	}
+
+	fmt.Printf("%d block events\n", len(info.Blocks))
+	return 0
+}
+
+// cancelListener cancels a context when the first block is processed
+type cancelListener struct {
+	cancel context.CancelFunc
+}
+
+func (this cancelListener) ProcessEvent(evt *kanzi.Event) {
+	if evt.Type() == kanzi.EVT_AFTER_TRANSFORM {
+		this.cancel()
+	}
+}
+
+func isCanceled(err error) bool {
+	var ioErr *IOError
+	return errors.As(err, &ioErr) && ioErr.ErrorCode() == kanzi.ERR_CANCELED && errors.Is(err, context.Canceled)
+}
+
+func compressWithCancel(block []byte) int {
+	fmt.Println("Test - cancel compression and decompression")
+	bs := internal.NewBufferStream()
+	w, err := NewWriter(bs, "NONE", "HUFFMAN", 65536, 4, 0, 0, false)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	cctx, cancel := context.WithCancel(context.Background())
+	w.SetContext(cctx)
+	w.AddListener(cancelListener{cancel: cancel})
+
+	if _, err = w.Write(block); isCanceled(err) == false {
+		fmt.Printf("Expected cancellation error, got %v\n", err)
+		return 2
+	}
+
+	if err = w.Close(); isCanceled(err) == false {
+		fmt.Printf("Expected cancellation error, got %v\n", err)
+		return 3
+	}
+
+	// Compress without context, then cancel the decompression
+	bs = internal.NewBufferStream()
+
+	if w, err = NewWriter(bs, "NONE", "HUFFMAN", 65536, 4, 0, 0, false); err != nil {
+		fmt.Printf("%v\n", err)
+		return 4
+	}
+
+	if _, err = w.Write(block); err != nil {
+		fmt.Printf("%v\n", err)
+		return 5
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 6
+	}
+
+	r, err := NewReader(bs, 4)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 7
+	}
+
+	cctx, cancel = context.WithCancel(context.Background())
+	r.SetContext(cctx)
+	r.AddListener(cancelListener{cancel: cancel})
+
+	if _, err = io.ReadAll(r); isCanceled(err) == false {
+		fmt.Printf("Expected cancellation error, got %v\n", err)
+		return 8
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+	return 0
+}
+
+func isMemoryLimitError(err error) bool {
+	var ioErr *IOError
+	return errors.As(err, &ioErr) && ioErr.ErrorCode() == kanzi.ERR_MEMORY_LIMIT
+}
+
+func compressWithMemoryLimit(block []byte) int {
+	fmt.Println("Test - memory limit")
+	ctx := map[string]any{"entropy": "HUFFMAN", "transform": "LZ", "blockSize": uint(65536), "jobs": uint(4), "checksum": uint(0)}
+	bufSize, _ := blockBufferSize(ctx, 65536, transform.LZ_TYPE)
+	perBlock := 2 * uint64(bufSize)
+
+	// Not enough memory for one block
+	ctx["maxMemory"] = perBlock - 1
+
+	w, err := NewWriterWithCtx(internal.NewBufferStream(), ctx)
+
+	if isMemoryLimitError(err) == false {
+		fmt.Printf("Expected a memory limit error, got: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// The number of jobs is reduced to fit in the limit
+	bs := internal.NewBufferStream()
+	ctx["maxMemory"] = 2*perBlock + 1000
+
+	if w, err = NewWriterWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if w.jobs != 2 {
+		fmt.Printf("Invalid number of jobs: %d\n", w.jobs)
+		return 3
+	}
+
+	if _, err = w.Write(block); err != nil {
+		fmt.Printf("%v\n", err)
+		return 4
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 5
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(4), "maxMemory": uint(perBlock)})
+	res, err := io.ReadAll(r)
+
+	if err != nil || bytes.Equal(res, block) == false {
+		fmt.Printf("Invalid data after decompression: %v\n", err)
+		return 6
+	}
+
+	if r.jobs != 1 {
+		fmt.Printf("Invalid number of jobs: %d\n", r.jobs)
+		return 7
+	}
+
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(4), "maxMemory": perBlock - 1})
+
+	if _, err = io.ReadAll(r); isMemoryLimitError(err) == false {
+		fmt.Printf("Expected a memory limit error, got: %v\n", err)
+		return 8
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// Codecs selected per block: the reader does not know the candidates and
+	// sizes the buffers for the largest block accepted by the decoder
+	bs = internal.NewBufferStream()
+	ctx = map[string]any{"entropy": "HUFFMAN", "transform": "NONE", "blockSize": uint(1 << 20), "jobs": uint(2),
+		"checksum": uint(0), "autoCandidates": "NONE&HUFFMAN,EXE+LZ&HUFFMAN,TEXT+UTF&ANS0,MM+RLT&HUFFMAN"}
+
+	if w, err = NewWriterWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 12
+	}
+
+	w.Write(block)
+	w.Close()
+
+	// The writer also counts the trial buffers of the candidates
+	candidates, _ := parseCandidates(ctx["autoCandidates"].(string))
+	tTypes := []uint64{transform.NONE_TYPE}
+
+	for _, c := range candidates {
+		tTypes = append(tTypes, c.transformType)
+	}
+
+	bufSize, _ = blockBufferSize(ctx, 1<<20, tTypes...)
+	ctx["maxMemory"] = uint64((2+_AUTO_TRIAL_BUFFERS)*bufSize) + 1000
+	ctx["jobs"] = uint(4)
+
+	if w, err = NewWriterWithCtx(internal.NewBufferStream(), ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 16
+	}
+
+	w.Write(block)
+	w.Flush()
+
+	if w.jobs != 1 || len(w.buffers) != 2+_AUTO_TRIAL_BUFFERS || len(w.buffers[2].Buf) == 0 {
+		fmt.Printf("Invalid trial buffers: %d jobs, %d buffers\n", w.jobs, len(w.buffers))
+		return 17
+	}
+
+	w.Close()
+	compressed = make([]byte, bs.Len())
+	bs.Read(compressed)
+	maxLen := int(maxTransformLength(uint(1<<20 + max(_EXTRA_BUFFER_SIZE, 1<<16))))
+	worst := uint64(maxLen + maxLen>>3 + _EXTRA_BUFFER_SIZE)
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(4), "maxMemory": 2 * worst})
+	res, err = io.ReadAll(r)
+
+	if err != nil || bytes.Equal(res, block) == false {
+		fmt.Printf("Invalid data after decompression: %v\n", err)
+		return 13
+	}
+
+	if r.jobs != 1 || r.maxBufferSize != int(worst) {
+		fmt.Printf("Invalid buffer size or number of jobs: %d, %d\n", r.maxBufferSize, r.jobs)
+		return 14
+	}
+
+	// Enough memory for the transform in the header but not for the worst case
+	r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(4), "maxMemory": 2*worst - 1})
+
+	if _, err = io.ReadAll(r); isMemoryLimitError(err) == false {
+		fmt.Printf("Expected a memory limit error, got: %v\n", err)
+		return 15
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// A block larger than the block size provided to a headerless reader
+	// must be rejected before allocating its buffer
+	bs = internal.NewBufferStream()
+	ctx = map[string]any{"entropy": "NONE", "transform": "NONE", "blockSize": uint(len(block)), "jobs": uint(1),
+		"checksum": uint(0), "headerless": true}
+
+	if w, err = NewWriterWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 9
+	}
+
+	w.Write(block)
+	w.Close()
+	ctx["blockSize"] = uint(65536)
+	ctx["maxMemory"] = uint64(16 * len(block))
+
+	if r, err = NewReaderWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 10
+	}
+
+	if _, err = io.ReadAll(r); isMemoryLimitError(err) == false {
+		fmt.Printf("Expected a memory limit error, got: %v\n", err)
+		return 11
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+	return 0
+}
+
+func compressWithStrictMode(block []byte) int {
+	fmt.Println("Test - strict mode")
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"entropy": "NONE", "transform": "ROLZX", "blockSize": uint(65536), "jobs": uint(1),
+		"checksum": uint(0), "blockIndex": true}
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	w.Write(block)
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	r, _ := NewReaderWithCtx(io.NopCloser(bytes.NewReader(compressed)), map[string]any{"jobs": uint(2), "strict": true})
+	res, err := io.ReadAll(r)
+
+	if err != nil || bytes.Equal(res, block) == false {
+		fmt.Printf("Invalid data after decompression: %v\n", err)
+		return 3
+	}
+
+	// Corrupt the second block: the errors must name the failing codec
+	r, _ = NewReaderAt(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1)})
+	index, err := r.Index()
+
+	if err != nil || len(index) != 4 {
+		fmt.Printf("Invalid block index: %v\n", err)
+		return 4
+	}
+
+	named := 0
+
+	for i := uint64(0); i < 64; i++ {
+		corrupted := append([]byte{}, compressed...)
+		corrupted[(index[1].Offset+i*index[1].Size/64)>>3] ^= byte(1 << (i & 7))
+		r, _ = NewReaderWithCtx(io.NopCloser(bytes.NewReader(corrupted)), map[string]any{"jobs": uint(1), "strict": true})
+
+		if _, err = io.ReadAll(r); err == nil {
+			continue
+		}
+
+		var ioErr *IOError
+
+		if errors.As(err, &ioErr) == false || strings.Contains(err.Error(), "runtime error") == true {
+			fmt.Printf("Unexpected error: %v\n", err)
+			return 5
+		}
+
+		if ioErr.Component() != "" {
+			named++
+		}
+	}
+
+	if named == 0 {
+		fmt.Println("No error naming the failing codec")
+		return 6
+	}
+
+	fmt.Printf("OK - %d errors naming the failing codec\n", named)
+
+	// A block larger than the block size provided to a headerless reader
+	bs = internal.NewBufferStream()
+	ctx = map[string]any{"entropy": "NONE", "transform": "NONE", "blockSize": uint(65536), "jobs": uint(1),
+		"checksum": uint(0), "headerless": true}
+
+	if w, err = NewWriterWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 7
+	}
+
+	w.Write(block[0:65536])
+	w.Close()
+	ctx["blockSize"] = uint(49152)
+	ctx["strict"] = true
+
+	if r, err = NewReaderWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 8
+	}
+
+	_, err = io.ReadAll(r)
+	var ioErr *IOError
+
+	if errors.As(err, &ioErr) == false || ioErr.ErrorCode() != kanzi.ERR_BLOCK_SIZE || ioErr.Component() != "NONE transform" {
+		fmt.Printf("Expected a block size error, got: %v\n", err)
+		return 9
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+
+	// A compressed block small enough but decoded to more than the block size:
+	// the inverse transform must fail instead of writing the whole block
+	bs = internal.NewBufferStream()
+	ctx = map[string]any{"entropy": "NONE", "transform": "LZ", "blockSize": uint(65536), "jobs": uint(1),
+		"checksum": uint(0), "headerless": true}
+
+	if w, err = NewWriterWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 10
+	}
+
+	w.Write(bytes.Repeat([]byte("strict mode "), 6000)[0:65536])
+	w.Close()
+	ctx["blockSize"] = uint(62976) // the padded buffers can hold 65536 bytes
+	ctx["strict"] = true
+
+	if r, err = NewReaderWithCtx(bs, ctx); err != nil {
+		fmt.Printf("%v\n", err)
+		return 11
+	}
+
+	_, err = io.ReadAll(r)
+
+	if errors.As(err, &ioErr) == false || ioErr.ErrorCode() != kanzi.ERR_PROCESS_BLOCK || ioErr.Component() != "LZ transform" ||
+		strings.Contains(err.Error(), "invalid decoded block size") == true {
+		fmt.Printf("Expected an inverse transform error, got: %v\n", err)
+		return 12
+	}
+
+	fmt.Printf("OK - expected error: %v\n", err)
+	return 0
+}
+
+func compressAfterWriteClose(block []byte) int {
+	fmt.Println("Test - write after close")
+	buf := make([]byte, len(block))
+	copy(buf, block)
+	bs := internal.NewBufferStream()
+
+	os, err := NewWriter(bs, "NONE", "HUFFMAN", uint(len(block)), 1, 0, 0, false)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	_, err = os.Write(block)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = os.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	_, err = os.Write(block)
+
+	if err != nil {
+		fmt.Printf("OK - expected error: %v\n", err)
+		return 0
+	}
+
+	return 4
+}
+
+func compressAfterReadClose(block []byte) int {
+	fmt.Println("Test - read after close")
+	bs := internal.NewBufferStream()
+
+	os, err := NewWriter(bs, "NONE", "NONE", uint(len(block)), 1, 0, 0, false)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	_, err = os.Write(block)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = os.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	is, err := NewReader(bs, 1)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 4
+	}
+
+	_, err = is.Read(block)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 5
+	}
+
+	if err = is.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 6
+	}
+
+	_, err = is.Read(block)
+
+	if err != nil {
+		fmt.Printf("OK - expected error: %v\n", err)
+		return 0
+	}
+
+	return 7
+}
+
+func TestRandomAccess(b *testing.T) {
+	fmt.Println("Random Access Test")
+	values := make([]byte, 300000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + (i>>12)&0x3F)
+	}
+
+	sum := 0
+
+	for _, withIndex := range []bool{true, false} {
+		for _, size := range []int64{int64(len(values)), 0} {
+			fmt.Printf("Index: %v, original size provided: %v\n", withIndex, size != 0)
+
+			if res := seekAndReadAt(values, withIndex, size); res == 0 {
+				fmt.Println("Success")
+			} else {
+				fmt.Printf("Failure %v\n", res)
+				sum += res
+			}
+		}
+	}
+
+	fmt.Println()
+
+	if sum != 0 {
+		b.Error()
+	}
+}
+
+func seekAndReadAt(block []byte, withIndex bool, fileSize int64) int {
+	bs := internal.NewBufferStream()
+	ctx := make(map[string]any)
+	ctx["entropy"] = "HUFFMAN"
+	ctx["transform"] = "LZ"
+	ctx["blockSize"] = uint(32768)
+	ctx["jobs"] = uint(rand.Intn(4) + 1)
+	ctx["checksum"] = uint(32)
+	ctx["fileSize"] = fileSize
+	ctx["blockIndex"] = withIndex
+
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	if _, err = w.Write(block); err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = w.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	compressed := make([]byte, bs.Len())
+	bs.Read(compressed)
+	ra := bytes.NewReader(compressed)
+	rctx := make(map[string]any)
+	rctx["jobs"] = uint(2)
+	r, err := NewReaderAt(ra, int64(len(compressed)), rctx)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 4
+	}
+
+	if indexed, err := r.HasIndex(); err != nil || indexed != withIndex {
+		fmt.Printf("Invalid block index flag: %v, %v\n", indexed, err)
+		return 19
+	}
+
+	index, err := r.Index()
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 5
+	}
+
+	if len(index) != (len(block)+32767)/32768 {
+		fmt.Printf("Invalid number of blocks: %d\n", len(index))
+		return 6
+	}
+
+	// Sequential read with concurrent block reads
+	all, err := io.ReadAll(r)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 16
+	}
+
+	if bytes.Equal(all, block) == false {
+		fmt.Println("Invalid data after sequential read")
+		return 17
+	}
+
+	if r.GetRead() != uint64(len(compressed)) {
+		fmt.Printf("Invalid number of bytes read: %d\n", r.GetRead())
+		return 18
+	}
+
+	buf := make([]byte, 50000)
+
+	for i := 0; i < 10; i++ {
+		off := rand.Intn(len(block) - len(buf))
+
+		if _, err = r.Seek(int64(off), io.SeekStart); err != nil {
+			fmt.Printf("%v\n", err)
+			return 7
+		}
+
+		if _, err = io.ReadFull(r, buf); err != nil {
+			fmt.Printf("%v\n", err)
+			return 8
+		}
+
+		if bytes.Equal(buf, block[off:off+len(buf)]) == false {
+			fmt.Printf("Invalid data after seek to %d\n", off)
+			return 9
+		}
+
+		off = rand.Intn(len(block) - len(buf))
+
+		if _, err = r.ReadAt(buf, int64(off)); err != nil {
+			fmt.Printf("%v\n", err)
+			return 10
+		}
+
+		if bytes.Equal(buf, block[off:off+len(buf)]) == false {
+			fmt.Printf("Invalid data read at %d\n", off)
+			return 11
+		}
+	}
+
+	// Read past the end
+	if n, err := r.ReadAt(buf, int64(len(block)-100)); n != 100 || err != io.EOF {
+		fmt.Printf("Invalid read at end of stream: %d, %v\n", n, err)
+		return 12
+	}
+
+	if pos, _ := r.Seek(0, io.SeekEnd); pos != int64(len(block)) {
+		fmt.Printf("Invalid stream size: %d\n", pos)
+		return 13
+	}
+
+	if _, err = r.Read(buf); err != io.EOF {
+		fmt.Printf("Expected EOF, got %v\n", err)
+		return 14
+	}
+
+	if err = r.Close(); err != nil {
+		fmt.Printf("%v\n", err)
+		return 15
+	}
+
+	return 0
+}
+
+func TestFileSystem(b *testing.T) {
+	fmt.Println("File System Test")
+	values := make([]byte, 300000)
+
+	for i := range values {
+		values[i] = byte(rand.Intn(16) + (i>>12)&0x3F)
+	}
+
+	sum := 0
+
+	for _, test := range []func([]byte) int{archiveFileSystem, streamFileSystem} {
+		if res := test(values); res == 0 {
+			fmt.Println("Success")
+		} else {
+			fmt.Printf("Failure %v\n", res)
+			sum += res
+		}
+	}
+
+	fmt.Println()
+
+	if sum != 0 {
+		b.Error()
+	}
+}
+
+func compressToBytes(data []byte, ctx map[string]any, entries []ArchiveEntry) ([]byte, error) {
+	bs := internal.NewBufferStream()
+	w, err := NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if entries == nil {
+		_, err = w.Write(data)
+	} else {
+		var aw *ArchiveWriter
+
+		if aw, err = NewArchiveWriter(w, entries); err == nil {
+			for _, e := range entries {
+				if _, err = aw.Next(); err != nil {
+					break
+				}
+
+				if _, err = aw.Write(data[0:e.Size]); err != nil {
+					break
+				}
+
+				data = data[e.Size:]
+			}
+		}
+	}
+
+	if err2 := w.Close(); err == nil {
+		err = err2
+	}
+
+	res := make([]byte, bs.Len())
+	bs.Read(res)
+	return res, err
+}
+
+func archiveFileSystem(block []byte) int {
+	fmt.Println("Test - file system over an archive")
+	mtime := time.Unix(1700000000, 0)
+	entries := []ArchiveEntry{
+		{Name: "a.txt", Mode: 0644, ModTime: mtime, Size: 1000},
+		{Name: "dir/empty", Mode: 0600, ModTime: mtime, Size: 0},
+		{Name: "dir/sub/b.bin", Mode: 0755, ModTime: mtime, Size: 200000},
+		{Name: "dir/sub/c.bin", Mode: 0755, ModTime: mtime, Size: int64(len(block) - 201000)},
+	}
+
+	ctx := map[string]any{"entropy": "HUFFMAN", "transform": "LZ", "blockSize": uint(32768), "jobs": uint(2),
+		"checksum": uint(32), "blockIndex": true}
+	compressed, err := compressToBytes(block, ctx, entries)
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 1
+	}
+
+	fsys, err := NewArchiveFS(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(2)})
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = fstest.TestFS(fsys, "a.txt", "dir/empty", "dir/sub/b.bin", "dir/sub/c.bin"); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	offset := 0
+
+	for _, e := range entries {
+		data, err := fs.ReadFile(fsys, e.Name)
+
+		if err != nil || bytes.Equal(data, block[offset:offset+int(e.Size)]) == false {
+			fmt.Printf("Invalid content for '%s': %v\n", e.Name, err)
+			return 4
+		}
+
+		fi, err := fs.Stat(fsys, e.Name)
+
+		if err != nil || fi.Size() != e.Size || fi.Mode() != e.Mode || fi.ModTime().Equal(mtime) == false {
+			fmt.Printf("Invalid file info for '%s': %v\n", e.Name, err)
+			return 5
+		}
+
+		offset += int(e.Size)
+	}
+
+	// Symbolic links are followed
+	entries = append(entries, ArchiveEntry{Name: "dir/link", Mode: fs.ModeSymlink | 0777, ModTime: mtime, Link: "sub/b.bin"},
+		ArchiveEntry{Name: "loop", Mode: fs.ModeSymlink | 0777, ModTime: mtime, Link: "loop"})
+
+	if compressed, err = compressToBytes(block, ctx, entries); err != nil {
+		fmt.Printf("%v\n", err)
+		return 6
+	}
+
+	if fsys, err = NewArchiveFS(bytes.NewReader(compressed), int64(len(compressed)), map[string]any{"jobs": uint(1)}); err != nil {
+		fmt.Printf("%v\n", err)
+		return 7
+	}
+
+	if data, err := fs.ReadFile(fsys, "dir/link"); err != nil || bytes.Equal(data, block[1000:201000]) == false {
+		fmt.Printf("Invalid content for link: %v\n", err)
+		return 8
+	}
+
+	if _, err = fsys.Open("loop"); errors.Is(err, fs.ErrNotExist) == false {
+		fmt.Printf("Expected error for link loop, got: %v\n", err)
+		return 9
+	}
+
+	if _, err = fsys.Open("../a.txt"); errors.Is(err, fs.ErrInvalid) == false {
+		fmt.Printf("Expected error for invalid path, got: %v\n", err)
+		return 10
+	}
+
+	return 0
+}
+
+func streamFileSystem(block []byte) int {
+	fmt.Println("Test - file system over a directory of compressed files")
+	mtime := time.Unix(1700000000, 0)
+	md := &FileMetadata{Mode: 0o640, ModTime: time.Unix(1600000000, 0), UID: -1, GID: -1}
+	mapFS := fstest.MapFS{
+		"readme.txt": {Data: []byte("not compressed"), ModTime: mtime},
+		"sub":        {Mode: fs.ModeDir | 0755, ModTime: mtime},
+	}
+
+	for i, name := range []string{"a.bin.knz", "sub/b.bin.knz", "sub/md.bin.knz"} {
+		ctx := map[string]any{"entropy": "ANS0", "transform": "LZ", "blockSize": uint(65536), "jobs": uint(2),
+			"checksum": uint(0)}
+
+		// Original size stored in the header or not
+		if i == 0 {
+			ctx["fileSize"] = int64(len(block))
+		}
+
+		if i == 2 {
+			ctx["metadata"] = md
+		}
+
+		compressed, err := compressToBytes(block[i*1000:], ctx, nil)
+
+		if err != nil {
+			fmt.Printf("%v\n", err)
+			return 1
+		}
+
+		mapFS[name] = &fstest.MapFile{Data: compressed, Mode: 0644, ModTime: mtime}
+	}
+
+	fsys, err := NewStreamFS(mapFS, map[string]any{"jobs": uint(2)})
+
+	if err != nil {
+		fmt.Printf("%v\n", err)
+		return 2
+	}
+
+	if err = fstest.TestFS(fsys, "a.bin", "sub/b.bin", "sub/md.bin"); err != nil {
+		fmt.Printf("%v\n", err)
+		return 3
+	}
+
+	for i, name := range []string{"a.bin", "sub/b.bin", "sub/md.bin"} {
+		fi, err := fs.Stat(fsys, name)
+
+		if err != nil || fi.Size() != int64(len(block)-i*1000) {
+			fmt.Printf("Invalid size for '%s': %v\n", name, err)
+			return 4
+		}
+
+		if i == 2 && (fi.Mode() != 0o640 || fi.ModTime().Equal(md.ModTime) == false) {
+			fmt.Printf("Invalid metadata for '%s': %v %v\n", name, fi.Mode(), fi.ModTime())
+			return 5
+		}
+
+		f, _ := fsys.Open(name)
+
+		// Original size in the header: the blocks are located on the first access
+		if indexed := f.(*fsFile).reader.index != nil; indexed != (i != 0) {
+			fmt.Printf("Unexpected block index after opening '%s': %v\n", name, indexed)
+			return 9
+		}
+
+		buf := make([]byte, 5000)
+		off := int64(rand.Intn(len(block) - 10000))
+
+		if _, err = f.(io.Seeker).Seek(off, io.SeekStart); err != nil {
+			fmt.Printf("%v\n", err)
+			return 6
+		}
+
+		if _, err = io.ReadFull(f, buf); err != nil || bytes.Equal(buf, block[int64(i*1000)+off:int64(i*1000)+off+5000]) == false {
+			fmt.Printf("Invalid data after seek in '%s': %v\n", name, err)
+			return 7
+		}
+
+		f.Close()
+	}
+
+	if _, err = fsys.Open("readme.txt"); errors.Is(err, fs.ErrNotExist) == false {
+		fmt.Printf("Expected error for uncompressed file, got: %v\n", err)
+		return 8
+	}
+
+	return 0
 }
@@ -0,0 +1,292 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+// A dictionary is provided to the Writer and the Reader using the 'dictionary'
+// key of the context map. It preloads the history of the LZ and ROLZ codecs,
+// seeds the word dictionary of the text codec and primes the models of the
+// CM and TPAQ codecs before each block is processed, which mostly benefits
+// small blocks. The ID of the dictionary is stored in the stream header.
+//
+// Dictionary file format:
+// 'KNZD' (32 bits) | ID (32 bits) | size (32 bits) | data (size bytes)
+
+const (
+	_DICTIONARY_MAGIC        = 0x4B4E5A44 // "KNZD"
+	_DICTIONARY_HEADER_SIZE  = 12
+	_DICTIONARY_MIN_SIZE     = 16
+	_DICTIONARY_MAX_SIZE     = 1 << 20
+	_DICTIONARY_DEFAULT_SIZE = 64 * 1024
+	_TRAIN_KMER_SIZE         = 8
+	_TRAIN_SEGMENT_SIZE      = 256
+	_TRAIN_SEGMENT_STEP      = 64
+	_TRAIN_HASH_LOG          = 20
+)
+
+// Dictionary is a block of data shared by the compressor and the decompressor.
+type Dictionary struct {
+	data []byte
+	id   uint32
+}
+
+// NewDictionary creates a dictionary from the provided data (not copied)
+func NewDictionary(data []byte) (*Dictionary, error) {
+	if len(data) < _DICTIONARY_MIN_SIZE || len(data) > _DICTIONARY_MAX_SIZE {
+		return nil, fmt.Errorf("Invalid dictionary size: %d (must be in [%d..%d])",
+			len(data), _DICTIONARY_MIN_SIZE, _DICTIONARY_MAX_SIZE)
+	}
+
+	hasher, _ := hash.NewXXHash32(_DICTIONARY_MAGIC)
+	return &Dictionary{data: data, id: hasher.Hash(data)}, nil
+}
+
+// ID returns the identifier of the dictionary (a hash of its content)
+func (this *Dictionary) ID() uint32 {
+	return this.id
+}
+
+// Bytes returns the content of the dictionary
+func (this *Dictionary) Bytes() []byte {
+	return this.data
+}
+
+// WriteTo writes the dictionary to w. Returns the number of bytes written.
+func (this *Dictionary) WriteTo(w io.Writer) (int64, error) {
+	var header [_DICTIONARY_HEADER_SIZE]byte
+	binary.BigEndian.PutUint32(header[0:], _DICTIONARY_MAGIC)
+	binary.BigEndian.PutUint32(header[4:], this.id)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(this.data)))
+	n, err := w.Write(header[:])
+
+	if err != nil {
+		return int64(n), err
+	}
+
+	m, err := w.Write(this.data)
+	return int64(n + m), err
+}
+
+// ReadDictionary reads a dictionary written by Dictionary.WriteTo
+func ReadDictionary(r io.Reader) (*Dictionary, error) {
+	var header [_DICTIONARY_HEADER_SIZE]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("Cannot read dictionary header: %v", err)
+	}
+
+	if binary.BigEndian.Uint32(header[0:]) != _DICTIONARY_MAGIC {
+		return nil, errors.New("Invalid dictionary: missing magic")
+	}
+
+	size := binary.BigEndian.Uint32(header[8:])
+
+	if size < _DICTIONARY_MIN_SIZE || size > _DICTIONARY_MAX_SIZE {
+		return nil, fmt.Errorf("Invalid dictionary size: %d", size)
+	}
+
+	data := make([]byte, size)
+
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("Cannot read dictionary data: %v", err)
+	}
+
+	d, err := NewDictionary(data)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if d.id != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errors.New("Invalid dictionary: ID mismatch")
+	}
+
+	return d, nil
+}
+
+// dictionaryFromContext returns the dictionary provided in the context, if any
+func dictionaryFromContext(ctx map[string]any) *Dictionary {
+	if d, hasKey := ctx["dictionary"]; hasKey == true {
+		if dict, ok := d.(*Dictionary); ok == true {
+			return dict
+		}
+	}
+
+	return nil
+}
+
+// trainSegment is a candidate segment of a sample for the dictionary
+type trainSegment struct {
+	sample int
+	start  int
+	end    int
+	score  int
+}
+
+type trainSegments []trainSegment
+
+func (this trainSegments) Len() int { return len(this) }
+
+func (this trainSegments) Less(i, j int) bool { return this[i].score > this[j].score }
+
+func (this trainSegments) Swap(i, j int) { this[i], this[j] = this[j], this[i] }
+
+func (this *trainSegments) Push(x any) { *this = append(*this, x.(trainSegment)) }
+
+func (this *trainSegments) Pop() any {
+	old := *this
+	s := old[len(old)-1]
+	*this = old[0 : len(old)-1]
+	return s
+}
+
+func trainHash(p []byte) uint32 {
+	return uint32((binary.LittleEndian.Uint64(p) * 0x9E3779B97F4A7C15) >> (64 - _TRAIN_HASH_LOG))
+}
+
+// TrainDictionary builds a dictionary of at most maxSize bytes (or a default
+// size if maxSize is 0) from the provided samples. The segments of the samples
+// sharing the most frequent substrings are selected, the most useful ones last
+// (closest to the data to compress).
+func TrainDictionary(samples [][]byte, maxSize int) (*Dictionary, error) {
+	if maxSize == 0 {
+		maxSize = _DICTIONARY_DEFAULT_SIZE
+	}
+
+	if maxSize < _DICTIONARY_MIN_SIZE || maxSize > _DICTIONARY_MAX_SIZE {
+		return nil, fmt.Errorf("Invalid dictionary size: %d (must be in [%d..%d])",
+			maxSize, _DICTIONARY_MIN_SIZE, _DICTIONARY_MAX_SIZE)
+	}
+
+	total := 0
+
+	for _, s := range samples {
+		total += len(s)
+	}
+
+	if total < _DICTIONARY_MIN_SIZE {
+		return nil, fmt.Errorf("Not enough sample data to train a dictionary: %d bytes", total)
+	}
+
+	if total <= maxSize {
+		// All the samples fit in the dictionary
+		data := make([]byte, 0, total)
+
+		for _, s := range samples {
+			data = append(data, s...)
+		}
+
+		return NewDictionary(data)
+	}
+
+	// Count the occurrences of all substrings of _TRAIN_KMER_SIZE bytes
+	freqs := make([]int32, 1<<_TRAIN_HASH_LOG)
+
+	for _, s := range samples {
+		for i := 0; i+_TRAIN_KMER_SIZE <= len(s); i++ {
+			freqs[trainHash(s[i:])]++
+		}
+	}
+
+	// Score each candidate segment with the frequencies of its distinct substrings
+	seen := make([]int32, 1<<_TRAIN_HASH_LOG)
+	mark := int32(0)
+
+	score := func(seg trainSegment) int {
+		mark++
+		res := 0
+		s := samples[seg.sample]
+
+		for i := seg.start; i+_TRAIN_KMER_SIZE <= seg.end; i++ {
+			h := trainHash(s[i:])
+
+			if seen[h] != mark {
+				seen[h] = mark
+
+				// Substrings seen once do not help
+				if freqs[h] > 1 {
+					res += int(freqs[h])
+				}
+			}
+		}
+
+		return res
+	}
+
+	segments := make(trainSegments, 0, total/_TRAIN_SEGMENT_STEP+len(samples))
+
+	for i, s := range samples {
+		for start := 0; start+_TRAIN_KMER_SIZE <= len(s); start += _TRAIN_SEGMENT_STEP {
+			seg := trainSegment{sample: i, start: start, end: min(start+_TRAIN_SEGMENT_SIZE, len(s))}
+			seg.score = score(seg)
+
+			if seg.score > 0 {
+				segments = append(segments, seg)
+			}
+		}
+	}
+
+	heap.Init(&segments)
+	selected := make([]trainSegment, 0)
+	size := 0
+
+	// Greedy selection. The scores only decrease when segments are selected,
+	// so a stale score is an upper bound: recompute it before selection.
+	for size < maxSize && len(segments) > 0 {
+		seg := heap.Pop(&segments).(trainSegment)
+
+		if seg.score = score(seg); seg.score == 0 {
+			continue
+		}
+
+		if len(segments) > 0 && seg.score < segments[0].score {
+			heap.Push(&segments, seg)
+			continue
+		}
+
+		seg.end = min(seg.end, seg.start+maxSize-size)
+		selected = append(selected, seg)
+		size += seg.end - seg.start
+		s := samples[seg.sample]
+
+		// The substrings of the selected segment are covered
+		for i := seg.start; i+_TRAIN_KMER_SIZE <= seg.end; i++ {
+			freqs[trainHash(s[i:])] = 0
+		}
+	}
+
+	if size < _DICTIONARY_MIN_SIZE {
+		return nil, errors.New("Cannot train a dictionary: no repeated content in the samples")
+	}
+
+	data := make([]byte, 0, size)
+
+	for i := len(selected) - 1; i >= 0; i-- {
+		seg := selected[i]
+		data = append(data, samples[seg.sample][seg.start:seg.end]...)
+	}
+
+	return NewDictionary(data)
+}
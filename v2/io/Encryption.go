@@ -0,0 +1,236 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// A stream is encrypted when a password is provided to the Writer using the
+// 'password' key of the context map (string or []byte). Each block is
+// encrypted and authenticated with AES-256-GCM after entropy coding. The key
+// is derived from the password with PBKDF2-HMAC-SHA256 and a random salt.
+// The nonce of a block is made of a random prefix and the block ID, so that
+// blocks cannot be reordered. The fields of the stream header are
+// authenticated with each block. The parameters are stored in the stream
+// header:
+//
+// cipher (8 bits) | KDF iterations (32 bits) | salt (128 bits) | nonce prefix (64 bits)
+//
+// The end block is followed by an encrypted trailer (instead of the clear
+// trailer of the content checksum) authenticated as the last item of the
+// stream, so that a truncation is detected:
+//
+// encrypted number of blocks (32 bits) | original size (64 bits) | XXHash64 of the original data (64 bits)
+//
+// The size and checksum are 0 without the 'contentChecksum' option. The
+// entries of the block index (if any) are encrypted as well.
+
+const (
+	_CIPHER_AES256_GCM  = 1 // AES-256-GCM, key derived with PBKDF2-HMAC-SHA256
+	_KDF_ITERATIONS     = 600000
+	_KDF_MAX_ITERATIONS = 1 << 24
+	_KDF_SALT_SIZE      = 16
+	_NONCE_PREFIX_SIZE  = 8
+	_CIPHER_KEY_SIZE    = 32
+	_CIPHER_TAG_SIZE    = 16 // GCM authentication tag
+	_TRAILER_SIZE       = 20 // number of blocks, original size and checksum
+)
+
+// blockCipher encrypts and authenticates the blocks of a stream
+type blockCipher struct {
+	aead       cipher.AEAD
+	password   []byte
+	iterations uint32
+	salt       [_KDF_SALT_SIZE]byte
+	prefix     [_NONCE_PREFIX_SIZE]byte // first bytes of the block nonces
+	header     [2][]byte                // additional data of the items (see setHeader)
+}
+
+// newBlockCipher creates a cipher with a random salt and nonce prefix
+func newBlockCipher(password []byte) (*blockCipher, error) {
+	this := &blockCipher{password: append([]byte{}, password...), iterations: _KDF_ITERATIONS}
+
+	if _, err := rand.Read(this.salt[:]); err != nil {
+		return nil, fmt.Errorf("Cannot generate salt: %v", err)
+	}
+
+	if err := this.init(); err != nil {
+		return nil, err
+	}
+
+	return this, this.renewNonce()
+}
+
+// init derives the key from the password and salt
+func (this *blockCipher) init() error {
+	if this.iterations == 0 {
+		return fmt.Errorf("Invalid number of KDF iterations: %d", this.iterations)
+	}
+
+	key := deriveKey(this.password, this.salt[:], int(this.iterations), _CIPHER_KEY_SIZE)
+	block, err := aes.NewCipher(key)
+
+	if err != nil {
+		return err
+	}
+
+	this.aead, err = cipher.NewGCM(block)
+	return err
+}
+
+// renewNonce generates a new nonce prefix (EG. for a new stream using the same key)
+func (this *blockCipher) renewNonce() error {
+	if _, err := rand.Read(this.prefix[:]); err != nil {
+		return fmt.Errorf("Cannot generate nonce: %v", err)
+	}
+
+	return nil
+}
+
+// words returns the parameters as 32 bit values (header checksum)
+func (this *blockCipher) words() []uint32 {
+	res := []uint32{_CIPHER_AES256_GCM, this.iterations}
+
+	for i := 0; i < _KDF_SALT_SIZE; i += 4 {
+		res = append(res, binary.BigEndian.Uint32(this.salt[i:]))
+	}
+
+	for i := 0; i < _NONCE_PREFIX_SIZE; i += 4 {
+		res = append(res, binary.BigEndian.Uint32(this.prefix[i:]))
+	}
+
+	return res
+}
+
+func (this *blockCipher) nonce(blockID int32) []byte {
+	nonce := make([]byte, this.aead.NonceSize())
+	copy(nonce, this.prefix[:])
+	binary.BigEndian.PutUint32(nonce[len(nonce)-4:], uint32(blockID))
+	return nonce
+}
+
+// setHeader sets the fields of the stream header authenticated with each
+// item of the stream (metadata, blocks, trailer and index), completed with a
+// byte set for the last items (trailer and index)
+func (this *blockCipher) setHeader(fields ...uint64) {
+	var ad []byte
+
+	for _, f := range fields {
+		ad = binary.BigEndian.AppendUint64(ad, f)
+	}
+
+	for _, w := range this.words() {
+		ad = binary.BigEndian.AppendUint32(ad, w)
+	}
+
+	this.header[0] = append(ad, 0)
+	this.header[1] = append(ad[0:len(ad):len(ad)], 1)
+}
+
+// additionalData returns the authenticated data of an item
+func (this *blockCipher) additionalData(last bool) []byte {
+	if last == true {
+		return this.header[1]
+	}
+
+	return this.header[0]
+}
+
+// seal encrypts the item in place (reallocated if too small for the tag)
+func (this *blockCipher) seal(data []byte, id int32, last bool) []byte {
+	return this.aead.Seal(data[:0], this.nonce(id), data, this.additionalData(last))
+}
+
+// open authenticates and decrypts the item in place
+func (this *blockCipher) open(data []byte, id int32, last bool) ([]byte, error) {
+	return this.aead.Open(data[:0], this.nonce(id), data, this.additionalData(last))
+}
+
+// sealTrailer encrypts the trailer of a stream of nbBlocks blocks
+func (this *blockCipher) sealTrailer(nbBlocks int32, size, checksum uint64) []byte {
+	trailer := make([]byte, _TRAILER_SIZE, _TRAILER_SIZE+_CIPHER_TAG_SIZE)
+	binary.BigEndian.PutUint32(trailer[0:], uint32(nbBlocks))
+	binary.BigEndian.PutUint64(trailer[4:], size)
+	binary.BigEndian.PutUint64(trailer[12:], checksum)
+	return this.seal(trailer, nbBlocks+1, true)
+}
+
+// openTrailer authenticates and decrypts the trailer following nbBlocks
+// blocks. Returns the original size and the checksum.
+func (this *blockCipher) openTrailer(data []byte, nbBlocks int32) (uint64, uint64, error) {
+	trailer, err := this.open(data, nbBlocks+1, true)
+
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if binary.BigEndian.Uint32(trailer[0:]) != uint32(nbBlocks) {
+		return 0, 0, fmt.Errorf("%d block(s) expected", binary.BigEndian.Uint32(trailer[0:]))
+	}
+
+	return binary.BigEndian.Uint64(trailer[4:]), binary.BigEndian.Uint64(trailer[12:]), nil
+}
+
+// passwordFromContext returns the password provided in the context, if any
+func passwordFromContext(ctx map[string]any) []byte {
+	switch p := ctx["password"].(type) {
+	case string:
+		return []byte(p)
+	case []byte:
+		return p
+	default:
+		return nil
+	}
+}
+
+// deriveKey implements PBKDF2 (RFC 8018) with HMAC-SHA256
+func deriveKey(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hLen := prf.Size()
+	nbBlocks := (keyLen + hLen - 1) / hLen
+	key := make([]byte, 0, nbBlocks*hLen)
+	u := make([]byte, 0, hLen)
+	var buf [4]byte
+
+	for block := 1; block <= nbBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf[:], uint32(block))
+		prf.Write(buf[:])
+		key = prf.Sum(key)
+		t := key[len(key)-hLen:]
+		u = append(u[:0], t...)
+
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+
+	return key[0:keyLen]
+}
@@ -0,0 +1,641 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+// Read only file systems (fs.FS) backed by compressed streams. The files are
+// decompressed lazily: each open file has its own Reader created with
+// NewReaderAt so that only the blocks overlapping the data read are decoded.
+// The open files support Read, Seek and ReadAt (EG. http.FileServer).
+
+const (
+	_FS_SUFFIX         = ".knz"
+	_FS_MAX_LINK_DEPTH = 8
+)
+
+// ArchiveFS is a file system over an archive stored in a compressed stream
+// (see NewArchiveWriter and the --archive option of the CLI). The directories
+// are derived from the names of the entries and the symbolic links are
+// followed if the target is in the archive.
+type ArchiveFS struct {
+	ra    io.ReaderAt
+	size  int64
+	ctx   map[string]any
+	index []BlockIndexEntry // shared by the readers of the files
+	nodes map[string]*fsNode
+}
+
+// fsNode is a file, link or directory of an ArchiveFS
+type fsNode struct {
+	info     fsFileInfo
+	offset   int64  // offset of the content in the decompressed stream
+	link     string // target of a symbolic link
+	children []*fsNode
+}
+
+// NewArchiveFS creates a file system over the archive stored in the first
+// 'size' bytes of ra. The context provides the parameters of the readers
+// (EG. 'jobs', 'password', 'dictionary'). The file table is read once.
+func NewArchiveFS(ra io.ReaderAt, size int64, ctx map[string]any) (*ArchiveFS, error) {
+	if ctx == nil {
+		return nil, &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	var readerCtx map[string]any
+	r, err := NewReaderAt(ra, size, copyContext(&readerCtx, ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer r.Close()
+
+	if err = r.buildIndex(); err != nil {
+		return nil, err
+	}
+
+	ar, err := NewArchiveReader(r)
+
+	if err != nil {
+		return nil, err
+	}
+
+	this := &ArchiveFS{ra: ra, size: size, ctx: ctx, index: r.index}
+	this.nodes = make(map[string]*fsNode, len(ar.Entries())+1)
+	root := &fsNode{info: fsFileInfo{name: ".", mode: fs.ModeDir | 0555}}
+	this.nodes["."] = root
+	offset := ar.r.count
+
+	for i := range ar.Entries() {
+		e := &ar.Entries()[i]
+		node := &fsNode{offset: offset, link: e.Link}
+		node.info = fsFileInfo{name: path.Base(e.Name), size: e.Size, mode: e.Mode, modTime: e.ModTime}
+
+		if e.IsSymlink() == true {
+			node.info.size = int64(len(e.Link))
+		} else {
+			offset += e.Size
+		}
+
+		if err = this.add(e.Name, node); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, node := range this.nodes {
+		sort.Slice(node.children, func(i, j int) bool {
+			return node.children[i].info.name < node.children[j].info.name
+		})
+	}
+
+	return this, nil
+}
+
+// add inserts a node and creates the missing parent directories
+func (this *ArchiveFS) add(name string, node *fsNode) error {
+	if _, exists := this.nodes[name]; exists == true {
+		errMsg := fmt.Sprintf("Invalid archive: duplicate entry '%s'", name)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this.nodes[name] = node
+
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		parent, exists := this.nodes[dir]
+
+		if exists == true {
+			if parent.info.IsDir() == false {
+				errMsg := fmt.Sprintf("Invalid archive: entry '%s' is not a directory", dir)
+				return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+			}
+
+			parent.children = append(parent.children, node)
+			return nil
+		}
+
+		parent = &fsNode{info: fsFileInfo{name: path.Base(dir), mode: fs.ModeDir | 0555}}
+		parent.children = append(parent.children, node)
+		this.nodes[dir] = parent
+		node = parent
+	}
+}
+
+// Open opens the named file or directory (the symbolic links are followed)
+func (this *ArchiveFS) Open(name string) (fs.File, error) {
+	if fs.ValidPath(name) == false {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	node := this.nodes[name]
+	target := name
+
+	for depth := 0; node != nil && node.info.mode&fs.ModeSymlink != 0; depth++ {
+		if depth == _FS_MAX_LINK_DEPTH || path.IsAbs(node.link) == true {
+			node = nil
+			break
+		}
+
+		target = path.Join(path.Dir(target), node.link)
+
+		if fs.ValidPath(target) == false {
+			node = nil
+			break
+		}
+
+		node = this.nodes[target]
+	}
+
+	if node == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	info := node.info
+	info.name = path.Base(name)
+
+	if node.info.IsDir() == true {
+		entries := make([]fs.DirEntry, len(node.children))
+
+		for i, child := range node.children {
+			entries[i] = fs.FileInfoToDirEntry(child.info)
+		}
+
+		return &fsDir{info: info, entries: entries}, nil
+	}
+
+	r, err := this.newReader()
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	f, err := newFSFile(info, r, node.offset, nil)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return f, nil
+}
+
+// newReader creates a reader sharing the block index of the file system
+func (this *ArchiveFS) newReader() (*Reader, error) {
+	var ctx map[string]any
+	r, err := NewReaderAt(this.ra, this.size, copyContext(&ctx, this.ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.readHeader(); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	r.index = this.index
+	return r, nil
+}
+
+// StreamFS is a file system over a directory of compressed files (EG. created
+// by the CLI or with a Writer). The file 'name.knz' of the underlying file
+// system is presented as 'name' with the original size stored in the header
+// (or the sum of the block sizes if missing) and the file metadata stored in
+// the header (if any). Open and Stat only read the header when the original
+// size is known, the blocks are located on the first read. The other files
+// are ignored.
+type StreamFS struct {
+	fsys fs.FS
+	ctx  map[string]any
+}
+
+// NewStreamFS creates a file system over fsys (EG. os.DirFS(dir)). The files
+// of fsys must implement io.ReaderAt. The context provides the parameters of
+// the readers (EG. 'jobs', 'password', 'dictionary').
+func NewStreamFS(fsys fs.FS, ctx map[string]any) (*StreamFS, error) {
+	if fsys == nil {
+		return nil, &IOError{msg: "Invalid null file system parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	if ctx == nil {
+		return nil, &IOError{msg: "Invalid null context parameter", code: kanzi.ERR_CREATE_DECOMPRESSOR}
+	}
+
+	return &StreamFS{fsys: fsys, ctx: ctx}, nil
+}
+
+// Open opens the named directory or the named file (decompressed)
+func (this *StreamFS) Open(name string) (fs.File, error) {
+	if fs.ValidPath(name) == false {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	if fi, err := fs.Stat(this.fsys, name); err == nil && fi.IsDir() == true {
+		return this.openDir(name, fi)
+	}
+
+	f, err := this.fsys.Open(name + _FS_SUFFIX)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+
+	file, err := this.openStream(name, f)
+
+	if err != nil {
+		f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return file, nil
+}
+
+func (this *StreamFS) openStream(name string, f fs.File) (fs.File, error) {
+	fi, err := f.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Mode().IsRegular() == false {
+		return nil, fs.ErrNotExist
+	}
+
+	ra, isReaderAt := f.(io.ReaderAt)
+
+	if isReaderAt == false {
+		return nil, &IOError{msg: "The compressed file does not support random access", code: kanzi.ERR_READ_FILE}
+	}
+
+	var ctx map[string]any
+	r, err := NewReaderAt(ra, fi.Size(), copyContext(&ctx, this.ctx))
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the header is read, the blocks are located on the first read
+	if err = r.readHeader(); err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	info := fsFileInfo{name: path.Base(name), size: r.outputSize, mode: fi.Mode().Perm(), modTime: fi.ModTime()}
+
+	if info.size == 0 {
+		// Original size missing in the header
+		if err = r.buildIndex(); err != nil {
+			r.Close()
+			return nil, err
+		}
+
+		info.size = r.totalSize()
+	}
+
+	if md := r.Metadata(); md != nil {
+		info.mode = md.Mode.Perm()
+		info.modTime = md.ModTime
+	}
+
+	return &fsFile{info: info, reader: r, closer: f}, nil
+}
+
+func (this *StreamFS) openDir(name string, fi fs.FileInfo) (fs.File, error) {
+	list, err := fs.ReadDir(this.fsys, name)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: unwrapPathError(err)}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(list))
+
+	for _, e := range list {
+		if e.IsDir() == true {
+			entries = append(entries, e)
+		} else if e.Type().IsRegular() == true && len(e.Name()) > len(_FS_SUFFIX) && strings.HasSuffix(e.Name(), _FS_SUFFIX) == true {
+			entries = append(entries, &streamDirEntry{fsys: this, name: strings.TrimSuffix(e.Name(), _FS_SUFFIX), dir: name})
+		}
+	}
+
+	// The names without suffix may not be sorted anymore
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	info := fsFileInfo{name: path.Base(name), mode: fi.Mode(), modTime: fi.ModTime()}
+	return &fsDir{info: info, entries: entries}, nil
+}
+
+// Stat returns the description of the named file (the header of a compressed
+// file is read)
+func (this *StreamFS) Stat(name string) (fs.FileInfo, error) {
+	f, err := this.Open(name)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: unwrapPathError(err)}
+	}
+
+	defer f.Close()
+	return f.Stat()
+}
+
+func unwrapPathError(err error) error {
+	if pe, isPathErr := err.(*fs.PathError); isPathErr == true {
+		return pe.Err
+	}
+
+	return err
+}
+
+// streamDirEntry describes a compressed file in a directory listing. The
+// header is read on the first call to Info.
+type streamDirEntry struct {
+	fsys *StreamFS
+	name string
+	dir  string
+	info fs.FileInfo
+}
+
+func (this *streamDirEntry) Name() string {
+	return this.name
+}
+
+func (this *streamDirEntry) IsDir() bool {
+	return false
+}
+
+func (this *streamDirEntry) Type() fs.FileMode {
+	return 0
+}
+
+func (this *streamDirEntry) Info() (fs.FileInfo, error) {
+	if this.info == nil {
+		info, err := this.fsys.Stat(path.Join(this.dir, this.name))
+
+		if err != nil {
+			return nil, err
+		}
+
+		this.info = info
+	}
+
+	return this.info, nil
+}
+
+func (this *streamDirEntry) String() string {
+	return fs.FormatDirEntry(this)
+}
+
+type fsFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (this fsFileInfo) Name() string {
+	return this.name
+}
+
+func (this fsFileInfo) Size() int64 {
+	return this.size
+}
+
+func (this fsFileInfo) Mode() fs.FileMode {
+	return this.mode
+}
+
+func (this fsFileInfo) ModTime() time.Time {
+	return this.modTime
+}
+
+func (this fsFileInfo) IsDir() bool {
+	return this.mode.IsDir()
+}
+
+func (this fsFileInfo) Sys() any {
+	return nil
+}
+
+// fsFile is an open file: the range [start, start+size) of a decompressed
+// stream
+type fsFile struct {
+	info   fsFileInfo
+	reader *Reader
+	start  int64
+	pos    int64
+	closer io.Closer // underlying compressed file (if any)
+
+	// Last block decoded by ReadAt
+	mutex    sync.Mutex
+	block    []byte
+	blockIdx int
+}
+
+func newFSFile(info fsFileInfo, r *Reader, start int64, closer io.Closer) (*fsFile, error) {
+	if start != 0 {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+
+	return &fsFile{info: info, reader: r, start: start, closer: closer}, nil
+}
+
+func (this *fsFile) Stat() (fs.FileInfo, error) {
+	return this.info, nil
+}
+
+func (this *fsFile) Read(p []byte) (int, error) {
+	if this.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: this.info.name, Err: fs.ErrClosed}
+	}
+
+	if this.pos >= this.info.size {
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > this.info.size-this.pos {
+		p = p[0 : this.info.size-this.pos]
+	}
+
+	n, err := this.reader.Read(p)
+	this.pos += int64(n)
+
+	if err == io.EOF {
+		if this.pos < this.info.size {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		if n > 0 {
+			err = nil
+		}
+	}
+
+	return n, err
+}
+
+func (this *fsFile) Seek(offset int64, whence int) (int64, error) {
+	if this.reader == nil {
+		return 0, &fs.PathError{Op: "seek", Path: this.info.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.pos
+	case io.SeekEnd:
+		offset += this.info.size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: this.info.name, Err: fs.ErrInvalid}
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: this.info.name, Err: fs.ErrInvalid}
+	}
+
+	if offset != this.pos {
+		if _, err := this.reader.Seek(this.start+offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+
+		this.pos = offset
+	}
+
+	return offset, nil
+}
+
+func (this *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if this.reader == nil {
+		return 0, &fs.PathError{Op: "read", Path: this.info.name, Err: fs.ErrClosed}
+	}
+
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: this.info.name, Err: fs.ErrInvalid}
+	}
+
+	if off >= this.info.size {
+		return 0, io.EOF
+	}
+
+	buf := p
+
+	if int64(len(buf)) > this.info.size-off {
+		buf = buf[0 : this.info.size-off]
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if err := this.reader.buildIndex(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+
+	for n < len(buf) {
+		pos := this.start + off + int64(n)
+		idx := this.reader.findBlock(pos)
+
+		if idx == len(this.reader.index) {
+			return n, io.ErrUnexpectedEOF
+		}
+
+		// Small reads at close offsets hit the same block
+		if this.block == nil || this.blockIdx != idx {
+			data, err := this.reader.blockData(idx)
+
+			if err != nil {
+				return n, err
+			}
+
+			this.block = data
+			this.blockIdx = idx
+		}
+
+		n += copy(buf[n:], this.block[pos-this.reader.index[idx].Position:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+func (this *fsFile) Close() error {
+	if this.reader == nil {
+		return &fs.PathError{Op: "close", Path: this.info.name, Err: fs.ErrClosed}
+	}
+
+	err := this.reader.Close()
+	this.reader = nil
+	this.block = nil
+
+	if this.closer != nil {
+		if err2 := this.closer.Close(); err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+// fsDir is an open directory
+type fsDir struct {
+	info    fsFileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (this *fsDir) Stat() (fs.FileInfo, error) {
+	return this.info, nil
+}
+
+func (this *fsDir) Read(p []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: this.info.name, Err: fs.ErrInvalid}
+}
+
+func (this *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir returns the next n entries of the directory (all the remaining
+// entries if n <= 0)
+func (this *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := len(this.entries) - this.offset
+
+	if n > 0 && remaining == 0 {
+		return nil, io.EOF
+	}
+
+	if n <= 0 || n > remaining {
+		n = remaining
+	}
+
+	res := make([]fs.DirEntry, n)
+	copy(res, this.entries[this.offset:])
+	this.offset += n
+	return res, nil
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// The memory used by the block buffers of a Writer or a Reader is limited
+// when a number of bytes is provided using the 'maxMemory' key of the context
+// map (uint or uint64). Each block processed concurrently uses two buffers
+// (plus the trial buffers of the automatic codec selection) whose worst case
+// size is derived from the block size and the maximum encoded length of the
+// transforms. The number of jobs is reduced to fit in
+// the limit and an IOError with code ERR_MEMORY_LIMIT is returned if one
+// block does not fit (by the Writer constructor or when the Reader reads the
+// header). The Reader also rejects the blocks larger than the buffers before
+// allocating them. With codecs selected per block, the candidates are not
+// known to the Reader: its buffers are sized for the largest block accepted
+// by the decoder.
+// The memory used internally by the transforms and entropy codecs is not
+// included.
+
+const (
+	_MIN_BLOCK_BUFFER_SIZE = 512 * 1024
+)
+
+// maxMemoryFromContext returns the memory limit in the context (0 means no
+// limit)
+func maxMemoryFromContext(ctx map[string]any) uint64 {
+	switch m := ctx["maxMemory"].(type) {
+	case uint:
+		return uint64(m)
+	case uint64:
+		return m
+	default:
+		return 0
+	}
+}
+
+// blockBufferSize returns the worst case size of a buffer used to encode or
+// decode a block of blockSize bytes with the provided transforms: the
+// maximum encoded length plus a margin for the entropy coding.
+func blockBufferSize(ctx map[string]any, blockSize int, transformTypes ...uint64) (int, error) {
+	maxLen := blockSize
+	var tCtx map[string]any
+
+	for _, tType := range transformTypes {
+		// The transforms may update their context
+		copyContext(&tCtx, ctx)
+		tCtx["size"] = uint(blockSize)
+		t, err := transform.New(&tCtx, tType)
+
+		if err != nil {
+			return 0, err
+		}
+
+		maxLen = max(maxLen, t.MaxEncodedLen(blockSize))
+	}
+
+	return max(maxLen+maxLen>>3, _MIN_BLOCK_BUFFER_SIZE) + _EXTRA_BUFFER_SIZE, nil
+}
+
+// maxTransformLength returns the largest size of a block before the inverse
+// transform accepted by the decoder (blockLength includes the padding area)
+func maxTransformLength(blockLength uint) uint {
+	return min(max(blockLength+blockLength/2, 2048), _MAX_BITSTREAM_BLOCK_SIZE)
+}
+
+// maxBlockBufferSize returns the size of the largest block buffer required by
+// the decoder for a block of blockSize bytes, whatever the transforms
+func maxBlockBufferSize(blockSize int) int {
+	maxLen := int(maxTransformLength(uint(blockSize + max(_EXTRA_BUFFER_SIZE, blockSize>>4))))
+	return maxLen + maxLen>>3 + _EXTRA_BUFFER_SIZE
+}
+
+// limitJobs returns the number of blocks (at most jobs) that can be processed
+// concurrently with nbBuffers buffers of bufSize bytes per block without
+// exceeding maxMemory bytes
+func limitJobs(jobs int, bufSize int, nbBuffers int, maxMemory uint64) (int, *IOError) {
+	if maxMemory == 0 {
+		return jobs, nil
+	}
+
+	perBlock := uint64(nbBuffers) * uint64(bufSize)
+
+	if perBlock > maxMemory {
+		errMsg := fmt.Sprintf("The memory limit (%d bytes) is lower than the memory required to process one block (%d bytes)", maxMemory, perBlock)
+		return 0, &IOError{msg: errMsg, code: kanzi.ERR_MEMORY_LIMIT}
+	}
+
+	return int(min(uint64(jobs), maxMemory/perBlock)), nil
+}
+
+// limitMemory reduces the number of jobs of the reader to fit the block
+// buffers in the memory limit (if any)
+func (this *Reader) limitMemory() error {
+	maxMemory := maxMemoryFromContext(this.ctx)
+
+	if maxMemory == 0 {
+		return nil
+	}
+
+	bufSize, err := blockBufferSize(this.ctx, this.blockSize, this.transformType)
+
+	if err != nil {
+		return &IOError{msg: err.Error(), code: kanzi.ERR_INVALID_CODEC}
+	}
+
+	if this.flags&_HEADER_FLAG_AUTO != 0 {
+		// The transforms are selected per block among candidates unknown to
+		// the reader: size the buffers for the largest block accepted by the
+		// decoder
+		bufSize = max(bufSize, maxBlockBufferSize(this.blockSize))
+	}
+
+	jobs, ioErr := limitJobs(int(this.ctx["jobs"].(uint)), bufSize, 2, maxMemory)
+
+	if ioErr != nil {
+		return ioErr
+	}
+
+	this.jobs = jobs
+	this.maxBufferSize = bufSize
+	return nil
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/hash"
+)
+
+// The metadata of the original file ('metadata' option of the Writer) follows
+// the header checksum:
+//
+// length (32 bits) | payload | XXHash32 of the payload (32 bits)
+//
+// If the stream is encrypted, the payload is sealed with the block cipher
+// (block ID 0) and the checksum is replaced with the authentication tag.
+//
+// Payload:
+// version (8 bits) | fields (8 bits) | mode (varint) | mtime (varint, ns since epoch) |
+// [atime (varint)] | [uid (varint) | gid (varint)] | [number of attributes (varint) |
+// (name length (varint) | name | value length (varint) | value)*]
+
+const (
+	_METADATA_VERSION    = 1
+	_METADATA_ATIME      = 0x01
+	_METADATA_OWNER      = 0x02
+	_METADATA_XATTRS     = 0x04
+	_METADATA_MAX_SIZE   = 1 << 24
+	_METADATA_CIPHER_ID  = 0 // nonce ID of the metadata (blocks start at 1)
+	_METADATA_SETUID     = 0o4000
+	_METADATA_SETGID     = 0o2000
+	_METADATA_STICKY     = 0o1000
+	_METADATA_MAX_XATTRS = 1 << 16
+)
+
+// FileMetadata describes the original file of a stream
+type FileMetadata struct {
+	Mode       fs.FileMode       `json:"mode"` // permissions plus setuid, setgid and sticky bits
+	ModTime    time.Time         `json:"modTime"`
+	AccessTime time.Time         `json:"accessTime"`       // zero if not available
+	UID        int               `json:"uid"`              // -1 if not available
+	GID        int               `json:"gid"`              // -1 if not available
+	Xattrs     map[string][]byte `json:"xattrs,omitempty"` // extended attributes (optional)
+}
+
+func (this *FileMetadata) marshal() []byte {
+	fields := byte(0)
+
+	if this.AccessTime.IsZero() == false {
+		fields |= _METADATA_ATIME
+	}
+
+	if this.UID >= 0 && this.GID >= 0 {
+		fields |= _METADATA_OWNER
+	}
+
+	if len(this.Xattrs) > 0 {
+		fields |= _METADATA_XATTRS
+	}
+
+	mode := uint64(this.Mode.Perm())
+
+	if this.Mode&fs.ModeSetuid != 0 {
+		mode |= _METADATA_SETUID
+	}
+
+	if this.Mode&fs.ModeSetgid != 0 {
+		mode |= _METADATA_SETGID
+	}
+
+	if this.Mode&fs.ModeSticky != 0 {
+		mode |= _METADATA_STICKY
+	}
+
+	buf := append(make([]byte, 0, 64), _METADATA_VERSION, fields)
+	buf = binary.AppendUvarint(buf, mode)
+	buf = binary.AppendVarint(buf, this.ModTime.UnixNano())
+
+	if fields&_METADATA_ATIME != 0 {
+		buf = binary.AppendVarint(buf, this.AccessTime.UnixNano())
+	}
+
+	if fields&_METADATA_OWNER != 0 {
+		buf = binary.AppendUvarint(buf, uint64(this.UID))
+		buf = binary.AppendUvarint(buf, uint64(this.GID))
+	}
+
+	if fields&_METADATA_XATTRS != 0 {
+		names := make([]string, 0, len(this.Xattrs))
+
+		for name := range this.Xattrs {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+		buf = binary.AppendUvarint(buf, uint64(len(names)))
+
+		for _, name := range names {
+			buf = binary.AppendUvarint(buf, uint64(len(name)))
+			buf = append(buf, name...)
+			buf = binary.AppendUvarint(buf, uint64(len(this.Xattrs[name])))
+			buf = append(buf, this.Xattrs[name]...)
+		}
+	}
+
+	return buf
+}
+
+func unmarshalMetadata(buf []byte) (*FileMetadata, error) {
+	if len(buf) < 2 {
+		return nil, errors.New("truncated metadata")
+	}
+
+	if buf[0] != _METADATA_VERSION {
+		return nil, fmt.Errorf("unsupported metadata version: %d", buf[0])
+	}
+
+	fields := buf[1]
+	buf = buf[2:]
+	res := &FileMetadata{UID: -1, GID: -1}
+	var err error
+
+	uvarint := func() uint64 {
+		v, n := binary.Uvarint(buf)
+
+		if n <= 0 {
+			err = errors.New("truncated metadata")
+			return 0
+		}
+
+		buf = buf[n:]
+		return v
+	}
+
+	varint := func() int64 {
+		v, n := binary.Varint(buf)
+
+		if n <= 0 {
+			err = errors.New("truncated metadata")
+			return 0
+		}
+
+		buf = buf[n:]
+		return v
+	}
+
+	readBytes := func() []byte {
+		n := uvarint()
+
+		if err != nil || n > uint64(len(buf)) {
+			err = errors.New("truncated metadata")
+			return nil
+		}
+
+		v := buf[0:n:n]
+		buf = buf[n:]
+		return v
+	}
+
+	mode := uvarint()
+	res.Mode = fs.FileMode(mode) & fs.ModePerm
+
+	if mode&_METADATA_SETUID != 0 {
+		res.Mode |= fs.ModeSetuid
+	}
+
+	if mode&_METADATA_SETGID != 0 {
+		res.Mode |= fs.ModeSetgid
+	}
+
+	if mode&_METADATA_STICKY != 0 {
+		res.Mode |= fs.ModeSticky
+	}
+
+	res.ModTime = time.Unix(0, varint())
+
+	if fields&_METADATA_ATIME != 0 {
+		res.AccessTime = time.Unix(0, varint())
+	}
+
+	if fields&_METADATA_OWNER != 0 {
+		uid, gid := uvarint(), uvarint()
+
+		if uid > 1<<31 || gid > 1<<31 {
+			return nil, errors.New("invalid owner in metadata")
+		}
+
+		res.UID, res.GID = int(uid), int(gid)
+	}
+
+	if fields&_METADATA_XATTRS != 0 {
+		count := uvarint()
+
+		if count > _METADATA_MAX_XATTRS {
+			return nil, fmt.Errorf("too many attributes in metadata: %d", count)
+		}
+
+		res.Xattrs = make(map[string][]byte, count)
+
+		for i := uint64(0); i < count && err == nil; i++ {
+			name := string(readBytes())
+			res.Xattrs[name] = readBytes()
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (this *Writer) writeMetadata() *IOError {
+	payload := this.metadata.marshal()
+
+	if len(payload) > _METADATA_MAX_SIZE {
+		errMsg := fmt.Sprintf("The file metadata is too large: %d bytes (max %d)", len(payload), _METADATA_MAX_SIZE)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_PARAM}
+	}
+
+	if this.cipher != nil {
+		payload = this.cipher.seal(payload, _METADATA_CIPHER_ID, false)
+	} else {
+		hasher, _ := hash.NewXXHash32(_BITSTREAM_TYPE)
+		payload = binary.BigEndian.AppendUint32(payload, hasher.Hash(payload))
+	}
+
+	if this.obs.WriteBits(uint64(len(payload)), 32) != 32 ||
+		this.obs.WriteArray(payload, uint(8*len(payload))) != uint(8*len(payload)) {
+		return &IOError{msg: "Cannot write file metadata to header", code: kanzi.ERR_WRITE_FILE}
+	}
+
+	return nil
+}
+
+// readMetadata reads the metadata following the header. It is decoded once
+// the key of the cipher is known (see decodeMetadata).
+func (this *Reader) readMetadata() error {
+	length := this.ibs.ReadBits(32)
+
+	if length < 4 || length > _METADATA_MAX_SIZE+64 {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect size of file metadata: %d", length)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this.rawMetadata = make([]byte, length)
+	this.ibs.ReadArray(this.rawMetadata, uint(8*length))
+	return nil
+}
+
+func (this *Reader) decodeMetadata() error {
+	payload := this.rawMetadata
+	this.rawMetadata = nil
+
+	if this.cipher != nil {
+		if this.cipher.aead == nil {
+			// Inspecting an encrypted stream without password
+			return nil
+		}
+
+		var err error
+
+		if payload, err = this.cipher.open(payload, _METADATA_CIPHER_ID, false); err != nil {
+			errMsg := "Cannot decrypt file metadata: invalid password or corrupted data"
+			return &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+		}
+	} else {
+		hasher, _ := hash.NewXXHash32(_BITSTREAM_TYPE)
+		n := len(payload) - 4
+
+		if hasher.Hash(payload[0:n]) != binary.BigEndian.Uint32(payload[n:]) {
+			return &IOError{msg: "Invalid bitstream: file metadata checksum mismatch", code: kanzi.ERR_CRC_CHECK}
+		}
+
+		payload = payload[0:n]
+	}
+
+	md, err := unmarshalMetadata(payload)
+
+	if err != nil {
+		errMsg := fmt.Sprintf("Invalid bitstream, incorrect file metadata: %v", err)
+		return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_FILE}
+	}
+
+	this.metadata = md
+	return nil
+}
+
+// Metadata returns the metadata of the original file stored in the stream
+// (see the 'metadata' option of the Writer) or nil. The metadata is available
+// once the header has been read (EG. after the first call to Read).
+func (this *Reader) Metadata() *FileMetadata {
+	return this.metadata
+}
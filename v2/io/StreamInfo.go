@@ -0,0 +1,293 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+	"github.com/flanglet/kanzi-go/v2/bitstream"
+	"github.com/flanglet/kanzi-go/v2/entropy"
+	"github.com/flanglet/kanzi-go/v2/internal"
+	"github.com/flanglet/kanzi-go/v2/transform"
+)
+
+// StreamInfo describes a compressed stream (see Reader.Info)
+type StreamInfo struct {
+	Version         uint          `json:"bitstreamVersion"`
+	Entropy         string        `json:"entropy"`
+	Transform       string        `json:"transform"`
+	BlockSize       int           `json:"blockSize"`
+	Checksum        uint          `json:"checksum"`        // size of the block checksums in bits (0, 32 or 64)
+	OriginalSize    int64         `json:"originalSize"`    // 0 if not known
+	HeaderSize      uint64        `json:"headerSize"`      // in bits
+	CompressedSize  uint64        `json:"compressedSize"`  // size of the header and blocks in bits (end block included)
+	BlockIndex      bool          `json:"blockIndex"`      // block index appended to the stream
+	AutoCodecs      bool          `json:"autoCodecs"`      // codecs selected per block
+	ContentChecksum bool          `json:"contentChecksum"` // content checksum in the trailer
+	ContentHash     uint64        `json:"contentHash"`     // content checksum (if any)
+	Encrypted       bool          `json:"encrypted"`
+	DictionaryID    uint32        `json:"dictionaryId"`       // 0 if no dictionary
+	Metadata        *FileMetadata `json:"metadata,omitempty"` // nil if none (or encrypted and no password)
+	Blocks          []BlockInfo   `json:"blocks"`
+}
+
+// BlockInfo describes a block of a compressed stream
+type BlockInfo struct {
+	ID        int    `json:"id"`
+	Offset    uint64 `json:"offset"`    // offset of the block in the compressed stream (in bits)
+	Size      uint64 `json:"size"`      // size of the compressed block (in bits)
+	Opaque    bool   `json:"opaque"`    // encrypted block and no password: the fields below are not available
+	Entropy   string `json:"entropy"`   // entropy codec of the block
+	Transform string `json:"transform"` // transform chain of the block
+	Copy      bool   `json:"copy"`      // block stored without transform and entropy coding
+	SkipFlags byte   `json:"skipFlags"` // one bit per transform of the chain (1 means skipped)
+	DataSize  uint   `json:"dataSize"`  // size of the data between the transforms and the entropy codec
+	Checksum  uint64 `json:"checksum"`  // block checksum (if any)
+}
+
+// Info reads the stream header and walks the block headers without decoding
+// the blocks (no entropy decoding, no inverse transform). The dictionary is
+// not required. The block headers of an encrypted stream are only available
+// if the password is provided (the blocks are then read entirely to be
+// decrypted, within the memory limit if any). Info must be called before any
+// Read and consumes the stream.
+func (this *Reader) Info() (*StreamInfo, error) {
+	if atomic.LoadInt32(&this.closed) == 1 {
+		return nil, &IOError{msg: "Stream closed", code: kanzi.ERR_READ_FILE}
+	}
+
+	if this.headless == true || atomic.LoadInt32(&this.initialized) != 0 {
+		return nil, &IOError{msg: "Stream info is only available before reading a stream with a header", code: kanzi.ERR_READ_FILE}
+	}
+
+	this.inspecting = true
+	err := this.readHeader()
+	this.inspecting = false
+
+	if err != nil {
+		return nil, err
+	}
+
+	res := &StreamInfo{
+		Version:         this.ctx["bsVersion"].(uint),
+		BlockSize:       this.blockSize,
+		OriginalSize:    this.outputSize,
+		HeaderSize:      this.headerSize,
+		BlockIndex:      this.flags&_HEADER_FLAG_INDEX != 0,
+		AutoCodecs:      this.flags&_HEADER_FLAG_AUTO != 0,
+		ContentChecksum: this.flags&_HEADER_FLAG_TRAILER != 0,
+		Encrypted:       this.flags&_HEADER_FLAG_ENCRYPTED != 0,
+		DictionaryID:    this.dictID,
+		Metadata:        this.metadata,
+		Blocks:          make([]BlockInfo, 0),
+	}
+
+	res.Entropy, _ = entropy.GetName(this.entropyType)
+	res.Transform, _ = transform.GetName(this.transformType)
+
+	if this.hasher32 != nil {
+		res.Checksum = 32
+	} else if this.hasher64 != nil {
+		res.Checksum = 64
+	}
+
+	if err = this.readBlockInfos(res); err != nil {
+		return nil, err
+	}
+
+	atomic.StoreInt32(&this.blockID, _CANCEL_TASKS_ID)
+	return res, nil
+}
+
+func (this *Reader) readBlockInfos(res *StreamInfo) (err error) {
+	id := 0
+
+	defer func() {
+		if r := recover(); r != nil {
+			errMsg := fmt.Sprintf("Invalid bitstream in block %d: %v", id, r)
+			err = &IOError{msg: errMsg, code: kanzi.ERR_READ_FILE}
+		}
+	}()
+
+	// Only the block headers are read, except for encrypted blocks that must
+	// be authenticated as a whole to be decrypted
+	decrypt := this.cipher != nil && this.cipher.aead != nil
+	maxBlock := maxBlockBufferSize(this.blockSize)
+	maxMemory := maxMemoryFromContext(this.ctx)
+	var header [24]byte // large enough for the largest block header
+	var data, skip []byte
+
+	for id = 1; ; id++ {
+		offset := this.ibs.Read()
+		lr := uint(this.ibs.ReadBits(5)) + 3
+		read := this.ibs.ReadBits(lr)
+
+		if read == 0 {
+			// End block
+			break
+		}
+
+		if read > uint64(1)<<34 {
+			errMsg := fmt.Sprintf("Invalid size of block %d", id)
+			return &IOError{msg: errMsg, code: kanzi.ERR_BLOCK_SIZE}
+		}
+
+		r := int((read + 7) >> 3)
+		blockBits := read
+
+		if decrypt == true {
+			if r > maxBlock {
+				errMsg := fmt.Sprintf("Invalid size of block %d", id)
+				return &IOError{msg: errMsg, code: kanzi.ERR_BLOCK_SIZE}
+			}
+
+			if maxMemory > 0 && uint64(r) > maxMemory {
+				errMsg := fmt.Sprintf("Block %d exceeds the memory limit: %d bytes", id, r)
+				return &IOError{msg: errMsg, code: kanzi.ERR_MEMORY_LIMIT}
+			}
+
+			if len(data) < r {
+				data = make([]byte, r)
+			}
+
+			for n := uint(0); read > 0; {
+				chkSize := uint(min(read, 1<<30))
+				this.ibs.ReadArray(data[n:], chkSize)
+				n += (chkSize + 7) >> 3
+				read -= uint64(chkSize)
+			}
+		} else {
+			n := min(read, uint64(8*len(header)))
+			this.ibs.ReadArray(header[:], uint(n))
+			data = header[0 : (n+7)>>3]
+			read -= n
+
+			// Skip the payload
+			if read > 0 && len(skip) == 0 {
+				skip = make([]byte, 65536)
+			}
+
+			for read > 0 {
+				chkSize := min(read, uint64(8*len(skip)))
+				this.ibs.ReadArray(skip, uint(chkSize))
+				read -= chkSize
+			}
+		}
+
+		bi := BlockInfo{ID: id, Offset: offset, Size: this.ibs.Read() - offset}
+
+		if err = this.readBlockHeader(&bi, data, blockBits); err != nil {
+			return err
+		}
+
+		res.Blocks = append(res.Blocks, bi)
+	}
+
+	res.CompressedSize = this.ibs.Read()
+
+	var size int64
+
+	if this.cipher != nil {
+		// Encrypted trailer (see Encryption.go)
+		data := make([]byte, _TRAILER_SIZE+_CIPHER_TAG_SIZE)
+		this.ibs.ReadArray(data, uint(8*len(data)))
+
+		if decrypt == false {
+			return nil
+		}
+
+		trailerSize, checksum, err := this.cipher.openTrailer(data, int32(len(res.Blocks)))
+
+		if err != nil {
+			errMsg := "Cannot decrypt the trailer: truncated stream or corrupted data"
+			return &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+		}
+
+		size, res.ContentHash = int64(trailerSize), checksum
+	} else if res.ContentChecksum == true {
+		this.ibs.ReadBits(32) // number of blocks
+		size = int64(this.ibs.ReadBits(64))
+		res.ContentHash = this.ibs.ReadBits(64)
+	}
+
+	if res.ContentChecksum == true && res.OriginalSize == 0 {
+		res.OriginalSize = size
+	}
+
+	return nil
+}
+
+// readBlockHeader reads the mode, skip flags and sizes at the start of a block
+func (this *Reader) readBlockHeader(bi *BlockInfo, data []byte, blockBits uint64) error {
+	if this.cipher != nil {
+		if this.cipher.aead == nil {
+			bi.Opaque = true
+			return nil
+		}
+
+		var err error
+
+		// Ignore the alignment bits
+		if data, err = this.cipher.open(data[0:blockBits>>3], int32(bi.ID), false); err != nil {
+			errMsg := fmt.Sprintf("Cannot decrypt block %d: invalid password or corrupted data", bi.ID)
+			return &IOError{msg: errMsg, code: kanzi.ERR_DECRYPTION, err: err}
+		}
+	}
+
+	ibs, _ := bitstream.NewDefaultInputBitStream(internal.NewBufferStream(data), 1024)
+	bi.Entropy, _ = entropy.GetName(this.entropyType)
+	bi.Transform, _ = transform.GetName(this.transformType)
+
+	if this.flags&_HEADER_FLAG_AUTO != 0 {
+		eType := uint32(ibs.ReadBits(5))
+		tType := ibs.ReadBits(48)
+		var err error
+
+		if bi.Entropy, err = entropy.GetName(eType); err == nil {
+			bi.Transform, err = transform.GetName(tType)
+		}
+
+		if err != nil {
+			errMsg := fmt.Sprintf("Invalid codec in block %d: %v", bi.ID, err)
+			return &IOError{msg: errMsg, code: kanzi.ERR_INVALID_CODEC}
+		}
+	}
+
+	mode := byte(ibs.ReadBits(8))
+
+	if mode&_COPY_BLOCK_MASK != 0 {
+		bi.Copy = true
+		bi.Entropy = "NONE"
+		bi.Transform = "NONE"
+	} else if mode&_TRANSFORMS_MASK != 0 {
+		bi.SkipFlags = byte(ibs.ReadBits(8))
+	} else {
+		bi.SkipFlags = (mode << 4) | 0x0F
+	}
+
+	dataSize := 1 + uint((mode>>5)&0x03)
+	bi.DataSize = uint(ibs.ReadBits(dataSize << 3))
+
+	if this.hasher32 != nil {
+		bi.Checksum = ibs.ReadBits(32)
+	} else if this.hasher64 != nil {
+		bi.Checksum = ibs.ReadBits(64)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package io
+
+import "github.com/flanglet/kanzi-go/v2/transform"
+
+// The transforms and entropy decoders validate the header fields of each
+// block (EG. Huffman chunk sizes, ANS and SRT frequencies, ROLZ and LZ match
+// lengths) against the size of the block and a block that cannot be decoded
+// yields an IOError naming the failing codec (see IOError.Component()).
+// The Reader decodes untrusted input in strict mode when the 'strict' key of
+// the context map is true: the blocks whose compressed size exceeds the
+// maximum encoded length of the block size declared in the header and the
+// blocks decoded to more than the declared block size are rejected (the
+// output buffer of the inverse transform is capped).
+
+// maxDecodedLength returns the maximum size of a decoded block in strict
+// mode (0 otherwise)
+func (this *Reader) maxDecodedLength() int {
+	if this.strict == false {
+		return 0
+	}
+
+	return this.blockSize
+}
+
+// maxInverseLength returns the size of the output buffer of the inverse
+// transform of a block in strict mode: the declared block size or, if several
+// transforms are applied, the maximum encoded length of the declared block
+// size (the intermediate results of a sequence can be larger than the block).
+func maxInverseLength(t *transform.ByteTransformSequence, skipFlags byte, maxDecoded int) int {
+	n := 0
+
+	for i := 0; i < t.Len(); i++ {
+		if skipFlags&(1<<(7-uint(i))) == 0 {
+			n++
+		}
+	}
+
+	if n > 1 {
+		return t.MaxEncodedLen(maxDecoded)
+	}
+
+	return maxDecoded
+}
@@ -0,0 +1,293 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics aggregates the block events of compressed streams into
+// counters and histograms exposed in the Prometheus text format.
+//
+// EG.
+//
+//	collector := metrics.NewCollector("kanzi")
+//	http.Handle("/metrics", collector)
+//	...
+//	w, _ := io.NewWriterWithCtx(os, ctx)
+//	w.AddListener(collector.NewListener(metrics.COMPRESSION))
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+
+	kanzi "github.com/flanglet/kanzi-go/v2"
+)
+
+const (
+	COMPRESSION   = 0 // Listener of a Writer
+	DECOMPRESSION = 1 // Listener of a Reader
+
+	_STAGE_TRANSFORM = 0
+	_STAGE_ENTROPY   = 1
+	_SKIPPED_BLOCK   = 0xFF // all the transforms of the block were skipped
+)
+
+var (
+	_DIRECTIONS = []string{"compress", "decompress"}
+	_STAGES     = []string{"transform", "entropy"}
+
+	// Upper bounds of the buckets of the latency histograms in seconds
+	_LATENCY_BUCKETS = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01,
+		0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+type histogram struct {
+	counts []uint64 // per bucket (not cumulative), last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+func (this *histogram) observe(v float64) {
+	i := 0
+
+	for i < len(_LATENCY_BUCKETS) && v > _LATENCY_BUCKETS[i] {
+		i++
+	}
+
+	this.counts[i]++
+	this.sum += v
+	this.count++
+}
+
+type stageMetrics struct {
+	bytesIn  uint64
+	bytesOut uint64
+	latency  histogram
+}
+
+// Collector aggregates the events of all the listeners it creates. It is an
+// http.Handler serving the metrics in the Prometheus text exposition format.
+//
+// Metrics (with the 'direction' label set to compress or decompress):
+//
+//	<namespace>_stage_bytes_in_total{stage}     bytes entering the transform or entropy stage
+//	<namespace>_stage_bytes_out_total{stage}    bytes leaving the transform or entropy stage
+//	<namespace>_stage_duration_seconds{stage}   histogram of the stage latency per block
+//	<namespace>_blocks_total                    blocks processed
+//	<namespace>_blocks_skipped_total            blocks with all the transforms skipped
+//
+// The compression ratio is the ratio of the bytes out of the entropy stage
+// and the bytes in the transform stage (compress direction).
+type Collector struct {
+	lock      sync.Mutex
+	namespace string
+	stages    [2][2]stageMetrics // direction, stage
+	blocks    [2]uint64
+	skipped   [2]uint64
+}
+
+// NewCollector creates a new instance of Collector. The namespace is the
+// prefix of the metric names (EG. "kanzi").
+func NewCollector(namespace string) *Collector {
+	this := &Collector{namespace: namespace}
+
+	for d := range this.stages {
+		for s := range this.stages[d] {
+			this.stages[d][s].latency.counts = make([]uint64, len(_LATENCY_BUCKETS)+1)
+		}
+	}
+
+	return this
+}
+
+// NewListener returns a listener feeding this collector. The events of a
+// block are matched by block ID so one listener must be created per stream
+// (Writer or Reader) and the direction is COMPRESSION or DECOMPRESSION.
+func (this *Collector) NewListener(direction int) *Listener {
+	return &Listener{collector: this, direction: direction & 1, pending: make(map[int]*kanzi.Event)}
+}
+
+// Listener a kanzi.Listener matching the events before and after each stage
+// of a block (see Collector.NewListener)
+type Listener struct {
+	lock      sync.Mutex
+	collector *Collector
+	direction int
+	pending   map[int]*kanzi.Event // event before a stage by block ID
+}
+
+// ProcessEvent receives an event and updates the metrics of the collector
+func (this *Listener) ProcessEvent(evt *kanzi.Event) {
+	switch evt.Type() {
+	case kanzi.EVT_BEFORE_TRANSFORM, kanzi.EVT_BEFORE_ENTROPY:
+		this.lock.Lock()
+		this.pending[evt.ID()] = evt
+		this.lock.Unlock()
+
+	case kanzi.EVT_AFTER_TRANSFORM, kanzi.EVT_AFTER_ENTROPY:
+		this.lock.Lock()
+		before, exists := this.pending[evt.ID()]
+		delete(this.pending, evt.ID())
+		this.lock.Unlock()
+
+		stage := _STAGE_TRANSFORM
+		beforeType := kanzi.EVT_BEFORE_TRANSFORM
+
+		if evt.Type() == kanzi.EVT_AFTER_ENTROPY {
+			stage = _STAGE_ENTROPY
+			beforeType = kanzi.EVT_BEFORE_ENTROPY
+		}
+
+		if exists == false || before.Type() != beforeType {
+			return
+		}
+
+		// The last stage of the block: entropy for compression, transform for decompression
+		last := (stage == _STAGE_ENTROPY) == (this.direction == COMPRESSION)
+		this.collector.observe(this.direction, stage, before, evt, last)
+
+	case kanzi.EVT_BLOCK_INFO:
+		if evt.SkipFlags() == _SKIPPED_BLOCK {
+			this.collector.lock.Lock()
+			this.collector.skipped[this.direction]++
+			this.collector.lock.Unlock()
+		}
+	}
+}
+
+func (this *Collector) observe(direction, stage int, before, after *kanzi.Event, last bool) {
+	duration := after.Time().Sub(before.Time()).Seconds()
+	this.lock.Lock()
+	sm := &this.stages[direction][stage]
+	sm.bytesIn += uint64(max(before.Size(), 0))
+	sm.bytesOut += uint64(max(after.Size(), 0))
+	sm.latency.observe(max(duration, 0))
+
+	if last == true {
+		this.blocks[direction]++
+	}
+
+	this.lock.Unlock()
+}
+
+// WriteMetrics writes the metrics in the Prometheus text exposition format
+func (this *Collector) WriteMetrics(w io.Writer) error {
+	// Copy the metrics to write without holding the lock
+	this.lock.Lock()
+	stages := this.stages
+	blocks := this.blocks
+	skipped := this.skipped
+
+	for d := range stages {
+		for s := range stages[d] {
+			stages[d][s].latency.counts = append([]uint64(nil), this.stages[d][s].latency.counts...)
+		}
+	}
+
+	this.lock.Unlock()
+	bw := bufio.NewWriter(w)
+	ns := this.namespace
+
+	if len(ns) > 0 {
+		ns += "_"
+	}
+
+	counters := []struct {
+		name  string
+		help  string
+		value func(d, s int) uint64
+	}{
+		{"stage_bytes_in_total", "Bytes entering a stage of the block pipeline.",
+			func(d, s int) uint64 { return stages[d][s].bytesIn }},
+		{"stage_bytes_out_total", "Bytes leaving a stage of the block pipeline.",
+			func(d, s int) uint64 { return stages[d][s].bytesOut }},
+	}
+
+	for _, c := range counters {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s counter\n", ns, c.name, c.help, ns, c.name)
+
+		for d := range _DIRECTIONS {
+			for s := range _STAGES {
+				fmt.Fprintf(bw, "%s%s{%s} %d\n", ns, c.name, labels(d, s), c.value(d, s))
+			}
+		}
+	}
+
+	name := ns + "stage_duration_seconds"
+	fmt.Fprintf(bw, "# HELP %s Duration of a stage of the block pipeline per block.\n", name)
+	fmt.Fprintf(bw, "# TYPE %s histogram\n", name)
+
+	for d := range _DIRECTIONS {
+		for s := range _STAGES {
+			h := &stages[d][s].latency
+			cumulated := uint64(0)
+
+			for i, c := range h.counts {
+				le := "+Inf"
+
+				if i < len(_LATENCY_BUCKETS) {
+					le = strconv.FormatFloat(_LATENCY_BUCKETS[i], 'g', -1, 64)
+				}
+
+				cumulated += c
+				fmt.Fprintf(bw, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels(d, s), le, cumulated)
+			}
+
+			fmt.Fprintf(bw, "%s_sum{%s} %s\n", name, labels(d, s), strconv.FormatFloat(h.sum, 'g', -1, 64))
+			fmt.Fprintf(bw, "%s_count{%s} %d\n", name, labels(d, s), h.count)
+		}
+	}
+
+	blockCounters := []struct {
+		name   string
+		help   string
+		values [2]uint64
+	}{
+		{"blocks_total", "Blocks processed.", blocks},
+		{"blocks_skipped_total", "Blocks with all the transforms skipped.", skipped},
+	}
+
+	for _, c := range blockCounters {
+		fmt.Fprintf(bw, "# HELP %s%s %s\n# TYPE %s%s counter\n", ns, c.name, c.help, ns, c.name)
+
+		for d := range _DIRECTIONS {
+			fmt.Fprintf(bw, "%s%s{direction=\"%s\"} %d\n", ns, c.name, _DIRECTIONS[d], c.values[d])
+		}
+	}
+
+	return bw.Flush()
+}
+
+func labels(direction, stage int) string {
+	return fmt.Sprintf("direction=\"%s\",stage=\"%s\"", _DIRECTIONS[direction], _STAGES[stage])
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (this *Collector) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	this.WriteMetrics(w)
+}
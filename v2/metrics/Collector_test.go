@@ -0,0 +1,146 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/flanglet/kanzi-go/v2/internal"
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+func TestCollector(b *testing.T) {
+	fmt.Println("Test - scrape metrics of compressed and decompressed streams")
+	collector := NewCollector("kanzi")
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	// 3 compressible blocks and 1 incompressible block
+	block := make([]byte, 4*65536)
+
+	for i := range block {
+		if i < 3*65536 {
+			block[i] = byte(rand.Intn(8))
+		} else {
+			block[i] = byte(rand.Intn(256))
+		}
+	}
+
+	bs := internal.NewBufferStream()
+	ctx := map[string]any{"transform": "LZ", "entropy": "HUFFMAN", "blockSize": uint(65536), "jobs": uint(2), "checksum": uint(0)}
+	w, err := kio.NewWriterWithCtx(bs, ctx)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	w.AddListener(collector.NewListener(COMPRESSION))
+
+	if _, err = w.Write(block); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	if err = w.Close(); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	compressed := uint64(bs.Len())
+	r, err := kio.NewReaderWithCtx(bs, map[string]any{"jobs": uint(2)})
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	r.AddListener(collector.NewListener(DECOMPRESSION))
+
+	if _, err = io.ReadAll(r); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	resp, err := http.Get(server.URL)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); strings.HasPrefix(ct, "text/plain; version=0.0.4") == false {
+		b.Errorf("Invalid content type: %s", ct)
+	}
+
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(resp.Body)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "#") || len(line) == 0 {
+			continue
+		}
+
+		idx := strings.LastIndexByte(line, ' ')
+		v, err := strconv.ParseFloat(line[idx+1:], 64)
+
+		if err != nil {
+			b.Errorf("Invalid sample: %s", line)
+			continue
+		}
+
+		values[line[0:idx]] = v
+	}
+
+	expected := map[string]float64{
+		`kanzi_blocks_total{direction="compress"}`:                                                4,
+		`kanzi_blocks_total{direction="decompress"}`:                                              4,
+		`kanzi_stage_bytes_in_total{direction="compress",stage="transform"}`:                      float64(len(block)),
+		`kanzi_stage_bytes_out_total{direction="decompress",stage="transform"}`:                   float64(len(block)),
+		`kanzi_stage_duration_seconds_count{direction="compress",stage="entropy"}`:                4,
+		`kanzi_stage_duration_seconds_bucket{direction="decompress",stage="transform",le="+Inf"}`: 4,
+	}
+
+	for k, v := range expected {
+		if values[k] != v {
+			b.Errorf("Invalid value for %s: expected %v, got %v", k, v, values[k])
+		}
+	}
+
+	// The entropy stage output is the payload of the blocks
+	if out := values[`kanzi_stage_bytes_out_total{direction="compress",stage="entropy"}`]; out == 0 || uint64(out) > compressed {
+		b.Errorf("Invalid size after entropy coding: %v (compressed size %d)", out, compressed)
+	}
+
+	if values[`kanzi_stage_bytes_in_total{direction="decompress",stage="entropy"}`] !=
+		values[`kanzi_stage_bytes_out_total{direction="compress",stage="entropy"}`] {
+		b.Error("Expected the same entropy coded sizes for compression and decompression")
+	}
+
+	// The LZ transform fails on the random block
+	if values[`kanzi_blocks_skipped_total{direction="compress"}`] != 1 ||
+		values[`kanzi_blocks_skipped_total{direction="decompress"}`] != 1 {
+		b.Errorf("Invalid number of skipped blocks: %v", values)
+	}
+
+	fmt.Printf("%d samples\n", len(values))
+}
@@ -326,8 +326,16 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		n = 256 - n
 		srcIdx = 1
 
+		if srcIdx+n+1 > srcEnd {
+			return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (input array too small)")
+		}
+
 		if n == 1 {
 			// One symbol
+			if len(src) < 6 {
+				return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (input array too small)")
+			}
+
 			val := src[1]
 			oSize := int(binary.LittleEndian.Uint32(src[2:]))
 
@@ -353,7 +361,7 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 			adjust := int(src[srcIdx])
 			srcIdx++
 
-			if adjust < 0 || adjust > 3 {
+			if adjust < 0 || adjust > 3 || srcIdx+adjust > srcEnd {
 				return 0, 0, errors.New("Alias codec inverse transform failed: invalid data")
 			}
 
@@ -373,6 +381,10 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 					decodeMap[i] = val
 				}
 
+				if adjust+4*(srcEnd-srcIdx-adjust) > len(dst) {
+					return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (incorrect output size)")
+				}
+
 				copy(dst[dstIdx:], src[srcIdx:srcIdx+adjust])
 				srcIdx += adjust
 				dstIdx += adjust
@@ -393,6 +405,14 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 					decodeMap[i] = val
 				}
 
+				if adjust != 0 && srcIdx == srcEnd {
+					return 0, 0, errors.New("Alias codec inverse transform failed: invalid data")
+				}
+
+				if len(dst) < 2*(srcEnd-srcIdx)-min(adjust, 1) {
+					return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (incorrect output size)")
+				}
+
 				if adjust != 0 {
 					dst[dstIdx] = src[srcIdx]
 					srcIdx++
@@ -413,6 +433,10 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		srcEnd := len(src) - int(src[1])
 		srcIdx = 2
 
+		if srcEnd < srcIdx+3*n {
+			return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (input array too small)")
+		}
+
 		for i := range &map16 {
 			map16[i] = 0x10000 | int(i)
 		}
@@ -423,6 +447,10 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		for srcIdx < srcEnd {
+			if dstIdx+2 > len(dst) {
+				return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (incorrect output size)")
+			}
+
 			val := map16[int(src[srcIdx])]
 			srcIdx++
 			dst[dstIdx] = byte(val)
@@ -431,6 +459,10 @@ func (this *AliasCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		if src[1] != 0 {
+			if dstIdx >= len(dst) {
+				return 0, 0, errors.New("Alias codec inverse transform failed: invalid data (incorrect output size)")
+			}
+
 			dst[dstIdx] = src[srcIdx]
 			srcIdx++
 			dstIdx++
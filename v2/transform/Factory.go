@@ -18,6 +18,7 @@ package transform
 import (
 	"fmt"
 	"strings"
+	"sync"
 
 	kanzi "github.com/flanglet/kanzi-go/v2"
 )
@@ -48,11 +49,84 @@ const (
 	UTF_TYPE    = uint64(17) // UTF codec
 	PACK_TYPE   = uint64(18) // Alias Codec
 	DNA_TYPE    = uint64(19) // DNA Alias Codec
-	RESERVED3   = uint64(20) // Reserved
-	RESERVED4   = uint64(21) // Reserved
-	RESERVED5   = uint64(22) // Reserved
+	RESERVED3   = uint64(20) // Reserved (available for user transforms)
+	RESERVED4   = uint64(21) // Reserved (available for user transforms)
+	RESERVED5   = uint64(22) // Reserved (available for user transforms)
+
+	// Range of types available for user transforms (see Register). The other
+	// types are kept for future built-in transforms.
+	MIN_USER_TYPE = RESERVED3
+	MAX_USER_TYPE = RESERVED5
 )
 
+// userTransform a transform registered with Register
+type userTransform struct {
+	name    string
+	factory func(*map[string]any) (kanzi.ByteTransform, error)
+}
+
+var (
+	userTransforms     = make(map[uint64]userTransform)
+	userTransformsLock sync.RWMutex
+)
+
+// Register makes a custom transform available to New, GetName and GetType
+// (hence to the Writer and Reader) under the provided type and name.
+// The type must be in [MIN_USER_TYPE..MAX_USER_TYPE] and the name must not
+// be used by another transform. Names are case insensitive.
+// The same transform must be registered to decompress a stream using it.
+func Register(id uint64, name string, factory func(*map[string]any) (kanzi.ByteTransform, error)) error {
+	if id < MIN_USER_TYPE || id > MAX_USER_TYPE {
+		return fmt.Errorf("Invalid transform type: '%d' (must be in [%d..%d])", id, MIN_USER_TYPE, MAX_USER_TYPE)
+	}
+
+	if factory == nil {
+		return fmt.Errorf("Invalid null factory for transform type: '%d'", id)
+	}
+
+	name = strings.ToUpper(name)
+
+	if len(name) == 0 || strings.ContainsAny(name, "+&") == true {
+		return fmt.Errorf("Invalid transform name: '%s'", name)
+	}
+
+	userTransformsLock.Lock()
+	defer userTransformsLock.Unlock()
+
+	if _, exists := userTransforms[id]; exists == true {
+		return fmt.Errorf("Transform type '%d' already registered", id)
+	}
+
+	if _, err := getByteFunctionTypeToken(name); err == nil {
+		return fmt.Errorf("Transform name '%s' already used", name)
+	}
+
+	for _, t := range userTransforms {
+		if t.name == name {
+			return fmt.Errorf("Transform name '%s' already used", name)
+		}
+	}
+
+	userTransforms[id] = userTransform{name: name, factory: factory}
+	return nil
+}
+
+func getUserTransform(functionType uint64) (userTransform, error) {
+	userTransformsLock.RLock()
+	t, exists := userTransforms[functionType]
+	userTransformsLock.RUnlock()
+
+	if exists == false {
+		if functionType >= MIN_USER_TYPE {
+			return t, fmt.Errorf("Unknown transform type: '%d' (not registered, see transform.Register)", functionType)
+		}
+
+		return t, fmt.Errorf("Unknown transform type: '%d'", functionType)
+	}
+
+	return t, nil
+}
+
 // New creates a new instance of ByteTransformSequence based on the provided
 // function type.
 func New(ctx *map[string]any, functionType uint64) (*ByteTransformSequence, error) {
@@ -169,7 +243,13 @@ func newToken(ctx *map[string]any, functionType uint64) (kanzi.ByteTransform, er
 		return NewNullTransformWithCtx(ctx)
 
 	default:
-		return nil, fmt.Errorf("Unknown transform type: '%d'", functionType)
+		t, err := getUserTransform(functionType)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return t.factory(ctx)
 	}
 }
 
@@ -269,7 +349,13 @@ func getByteFunctionNameToken(functionType uint64) (string, error) {
 		return "NONE", nil
 
 	default:
-		return "", fmt.Errorf("Unknown transform type: '%d'", functionType)
+		t, err := getUserTransform(functionType)
+
+		if err != nil {
+			return "", err
+		}
+
+		return t.name, nil
 	}
 }
 
@@ -277,7 +363,7 @@ func getByteFunctionNameToken(functionType uint64) (string, error) {
 // The returned type contains 8 transform type values (masks).
 func GetType(name string) (uint64, error) {
 	if strings.IndexByte(name, byte('+')) < 0 {
-		res, err := getByteFunctionTypeToken(name)
+		res, err := getFunctionTypeToken(name)
 
 		if err != nil {
 			return 0, err
@@ -300,7 +386,7 @@ func GetType(name string) (uint64, error) {
 	shift := _BFF_MAX_SHIFT
 
 	for _, token := range tokens {
-		tkType, err := getByteFunctionTypeToken(token)
+		tkType, err := getFunctionTypeToken(token)
 
 		if err != nil {
 			return 0, err
@@ -382,3 +468,26 @@ func getByteFunctionTypeToken(name string) (uint64, error) {
 		return 0, fmt.Errorf("Unknown transform type: '%s'", name)
 	}
 }
+
+// getFunctionTypeToken looks up built-in then user transforms
+func getFunctionTypeToken(name string) (uint64, error) {
+	if res, err := getByteFunctionTypeToken(name); err == nil {
+		return res, nil
+	}
+
+	return getUserFunctionTypeToken(name)
+}
+
+func getUserFunctionTypeToken(name string) (uint64, error) {
+	name = strings.ToUpper(name)
+	userTransformsLock.RLock()
+	defer userTransformsLock.RUnlock()
+
+	for id, t := range userTransforms {
+		if t.name == name {
+			return id, nil
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown transform type: '%s'", name)
+}
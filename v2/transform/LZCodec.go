@@ -132,6 +132,8 @@ type LZXCodec struct {
 	extra     bool
 	ctx       *map[string]any
 	bsVersion uint
+	dict      []byte // optional data preceding each block
+	buf       []byte // dictionary + block
 }
 
 // NewLZXCodec creates a new instance of LZXCodec
@@ -167,6 +169,10 @@ func NewLZXCodecWithCtx(ctx *map[string]any) (*LZXCodec, error) {
 		if val, containsKey := (*ctx)["bsVersion"]; containsKey {
 			this.bsVersion = val.(uint)
 		}
+
+		if val, containsKey := (*ctx)["dictionaryData"]; containsKey {
+			this.dict = val.([]byte)
+		}
 	}
 
 	return this, nil
@@ -213,6 +219,20 @@ func readLengthLZ(block []byte) (int, int) {
 	return res, 4
 }
 
+// lengthSizeLZ returns the number of bytes used to encode a length starting
+// with b
+func lengthSizeLZ(b byte) int {
+	if b < 254 {
+		return 1
+	}
+
+	if b == 254 {
+		return 3
+	}
+
+	return 4
+}
+
 func emitLiteralsLZ(src, dst []byte) {
 	copy(dst, src)
 }
@@ -270,7 +290,21 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 		this.tkBuf = make([]byte, minBufSize)
 	}
 
-	srcEnd := count - 16 - 1
+	start := 0
+
+	if len(this.dict) > 0 {
+		// Prepend the dictionary so that matches can refer to it
+		start = len(this.dict)
+		buf := prependDictionary(this.dict, &this.buf, count)
+		copy(buf[start:], src)
+		src = buf
+
+		for i := 1; i < start; i++ {
+			this.hashes[this.hash(src[i:])] = int32(i)
+		}
+	}
+
+	srcEnd := len(src) - 16 - 1
 	maxDist := _LZX_MAX_DISTANCE2
 	dst[12] = 1
 
@@ -295,13 +329,13 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 		}
 	}
 
-	srcIdx := 0
+	srcIdx := start
 	dstIdx := 13
-	anchor := 0
+	anchor := start
 	mLenIdx := 0
 	mIdx := 0
 	tkIdx := 0
-	var repd = []int{count, count}
+	var repd = []int{len(src), len(src)}
 	repdIdx := 0
 	srcInc := 0
 
@@ -487,7 +521,7 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 	}
 
 	// Emit last literals
-	litLen := count - anchor
+	litLen := len(src) - anchor
 
 	if dstIdx+litLen+tkIdx+mIdx >= count {
 		return uint(count), uint(dstIdx), errors.New("LZCodec forward transform skip: no compression")
@@ -523,6 +557,19 @@ func (this *LZXCodec) Forward(src, dst []byte) (uint, uint, error) {
 	return uint(count), uint(dstIdx), nil
 }
 
+// prependDictionary returns a slice of the provided buffer (reallocated if too
+// small) starting with the dictionary, followed by room for n bytes.
+func prependDictionary(dict []byte, buf *[]byte, n int) []byte {
+	n += len(dict)
+
+	if len(*buf) < n {
+		*buf = make([]byte, n)
+	}
+
+	copy(*buf, dict)
+	return (*buf)[0:n]
+}
+
 func findMatchLZX(src []byte, srcIdx, ref, maxMatch int) int {
 	bestLen := 0
 
@@ -552,10 +599,18 @@ func (this *LZXCodec) Inverse(src, dst []byte) (uint, uint, error) {
 		return this.inverseV3(src, dst)
 	}
 
-	return this.inverseV4(src, dst)
+	if len(this.dict) > 0 {
+		// Decode after the dictionary so that matches can refer to it
+		buf := prependDictionary(this.dict, &this.buf, len(dst))
+		srcIdx, dstIdx, err := this.inverseV4(src, buf, len(this.dict))
+		copy(dst, buf[len(this.dict):len(this.dict)+int(dstIdx)])
+		return srcIdx, dstIdx, err
+	}
+
+	return this.inverseV4(src, dst, 0)
 }
 
-func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
+func (this *LZXCodec) inverseV4(src, dst []byte, start int) (uint, uint, error) {
 	if len(src) == 0 {
 		return 0, 0, nil
 	}
@@ -597,7 +652,7 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 	}
 
 	srcIdx := 13
-	dstIdx := 0
+	dstIdx := start
 	repd0 := 0
 	repd1 := 0
 
@@ -617,6 +672,11 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 				litLen = token >> 5
 			}
 
+			// Sanity check
+			if srcIdx+litLen > len(src) || dstIdx+litLen > len(dst) {
+				return uint(srcIdx), uint(dstIdx-start), errors.New("LZCodec inverse transform failed: invalid data")
+			}
+
 			// Emit literals
 			if dstIdx+litLen >= dstEnd {
 				copy(dst[dstIdx:], src[srcIdx:srcIdx+litLen])
@@ -638,6 +698,11 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 
 		if mLen == 15 {
 			// Repetition distance, read mLen fully outside of token
+			// Sanity check
+			if mLenIdx >= len(src) || mLenIdx+lengthSizeLZ(src[mLenIdx]) > len(src) {
+				return uint(srcIdx), uint(dstIdx-start), errors.New("LZCodec inverse transform failed: invalid data")
+			}
+
 			ll, delta := readLengthLZ(src[mLenIdx:])
 			mLen = minMatch + ll
 			mLenIdx += delta
@@ -650,6 +715,11 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 		} else {
 			// Read mLen remainder (if any) outside of token
 			if mLen == 14 {
+				// Sanity check
+				if mLenIdx >= len(src) || mLenIdx+lengthSizeLZ(src[mLenIdx]) > len(src) {
+					return uint(srcIdx), uint(dstIdx-start), errors.New("LZCodec inverse transform failed: invalid data")
+				}
+
 				ll, delta := readLengthLZ(src[mLenIdx:])
 				mLen = 14 + minMatch + ll
 				mLenIdx += delta
@@ -678,7 +748,7 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 
 		// Sanity check
 		if ref < 0 || dist > maxDist || mEnd > dstEnd {
-			return uint(srcIdx), uint(dstIdx), fmt.Errorf("LZCodec: invalid distance decoded: %d", dist)
+			return uint(srcIdx), uint(dstIdx-start), fmt.Errorf("LZCodec: invalid distance decoded: %d", dist)
 		}
 
 		// Copy match
@@ -708,7 +778,7 @@ func (this *LZXCodec) inverseV4(src, dst []byte) (uint, uint, error) {
 		err = errors.New("LZCodec inverse transform failed")
 	}
 
-	return uint(mIdx), uint(dstIdx), err
+	return uint(mIdx), uint(dstIdx-start), err
 }
 
 func (this *LZXCodec) inverseV3(src, dst []byte) (uint, uint, error) {
@@ -770,6 +840,11 @@ func (this *LZXCodec) inverseV3(src, dst []byte) (uint, uint, error) {
 				srcIdx += delta
 			}
 
+			// Sanity check
+			if srcIdx+litLen > len(src) || dstIdx+litLen > len(dst) {
+				return uint(srcIdx), uint(dstIdx), errors.New("LZCodec inverse transform failed, invalid data")
+			}
+
 			// Emit literals
 			if dstIdx+litLen >= dstEnd {
 				copy(dst[dstIdx:], src[srcIdx:srcIdx+litLen])
@@ -789,6 +864,11 @@ func (this *LZXCodec) inverseV3(src, dst []byte) (uint, uint, error) {
 		mLen := token & 0x0F
 
 		if mLen == 15 {
+			// Sanity check
+			if mLenIdx >= len(src) || mLenIdx+lengthSizeLZ(src[mLenIdx]) > len(src) {
+				return uint(srcIdx), uint(dstIdx), errors.New("LZCodec inverse transform failed, invalid data")
+			}
+
 			ll, delta := readLengthLZ(src[mLenIdx:])
 			mLen += ll
 			mLenIdx += delta
@@ -905,6 +985,11 @@ func (this *LZXCodec) inverseV2(src, dst []byte) (uint, uint, error) {
 				srcIdx += delta
 			}
 
+			// Sanity check
+			if srcIdx+litLen > len(src) || dstIdx+litLen > len(dst) {
+				return uint(srcIdx), uint(dstIdx), errors.New("LZCodec inverse transform failed, invalid data")
+			}
+
 			// Emit literals
 			if dstIdx+litLen >= dstEnd {
 				copy(dst[dstIdx:], src[srcIdx:srcIdx+litLen])
@@ -924,6 +1009,11 @@ func (this *LZXCodec) inverseV2(src, dst []byte) (uint, uint, error) {
 		mLen := token & 0x0F
 
 		if mLen == 15 {
+			// Sanity check
+			if mIdx >= len(src) || mIdx+lengthSizeLZ(src[mIdx]) > len(src) {
+				return uint(srcIdx), uint(dstIdx), errors.New("LZCodec inverse transform failed, invalid data")
+			}
+
 			ll, delta := readLengthLZ(src[mIdx:])
 			mLen += ll
 			mIdx += delta
@@ -207,6 +207,8 @@ type rolzCodec1 struct {
 	posChecks    int32
 	minMatch     int
 	ctx          *map[string]any
+	dict         []byte // optional data preceding the first chunk
+	buf          []byte // dictionary + first chunk
 }
 
 func newROLZCodec1(logPosChecks uint) (*rolzCodec1, error) {
@@ -237,9 +239,52 @@ func newROLZCodec1WithCtx(logPosChecks uint, ctx *map[string]any) (*rolzCodec1,
 	this.counters = make([]int32, 1<<16)
 	this.matches = make([]uint32, 0)
 	this.ctx = ctx
+
+	if ctx != nil {
+		if val, containsKey := (*ctx)["dictionaryData"]; containsKey {
+			this.dict = val.([]byte)
+		}
+	}
+
 	return this, nil
 }
 
+// useDictionary returns the length of the dictionary preceding the first chunk
+// of a block of the provided size (0 if the dictionary is not used).
+func useDictionary(dict []byte, blockSize int) int {
+	// The positions in the chunk must fit in the bits not used by the hash
+	if len(dict) == 0 || len(dict)+blockSize > _ROLZ_CHUNK_SIZE {
+		return 0
+	}
+
+	return len(dict)
+}
+
+// primeMatches records the positions of the dictionary located at the
+// beginning of buf in the match tables. The encoder also stores the hash
+// of each position.
+func primeMatches(matches []uint32, counters []int32, logPosChecks uint, maskChecks int32,
+	buf []byte, start, delta, minMatch int, hashed bool) {
+	for pos := delta; pos < start; pos++ {
+		var key uint32
+
+		if minMatch == _ROLZ_MIN_MATCH3 {
+			key = getKey1(buf[pos-delta:])
+		} else {
+			key = getKey2(buf[pos-delta:])
+		}
+
+		counters[key] = (counters[key] + 1) & maskChecks
+		val := uint32(pos)
+
+		if hashed == true {
+			val |= rolzhash(buf[pos : pos+4])
+		}
+
+		matches[(key<<logPosChecks)+uint32(counters[key])] = val
+	}
+}
+
 // findMatch returns match position index (logPosChecks bits) + length (8 bits) or -1
 func (this *rolzCodec1) findMatch(buf []byte, pos int, hash32 uint32, counter int32, matches []uint32) (int, int) {
 	maxMatch := min(_ROLZ_MAX_MATCH1, len(buf)-pos)
@@ -374,6 +419,8 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		this.matches = make([]uint32, _ROLZ_HASH_SIZE<<this.logPosChecks)
 	}
 
+	start := useDictionary(this.dict, len(src))
+
 	// Main loop
 	for startChunk < srcEnd {
 		litIdx := 0
@@ -393,7 +440,18 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		}
 
 		buf := src[startChunk:endChunk]
-		srcIdx = 0
+
+		if start > 0 {
+			// Prepend the dictionary so that matches can refer to it
+			// The dictionary is only used when the block fits in one chunk
+			buf = prependDictionary(this.dict, &this.buf, len(src))
+			copy(buf[start:], src)
+			buf = buf[0 : start+sizeChunk]
+			primeMatches(this.matches, this.counters, this.logPosChecks, this.maskChecks,
+				buf, start, delta, this.minMatch, true)
+		}
+
+		srcIdx = start
 		n := min(srcEnd-startChunk, 8)
 
 		for j := 0; j < n; j++ {
@@ -406,7 +464,7 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		srcInc := 0
 
 		// Next chunk
-		for srcIdx < sizeChunk {
+		for srcIdx < start+sizeChunk {
 			var key uint32
 
 			if this.minMatch == _ROLZ_MIN_MATCH3 {
@@ -492,7 +550,7 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Emit last chunk literals
-		srcIdx = sizeChunk
+		srcIdx = start + sizeChunk
 		litLen := srcIdx - firstLitIdx
 
 		if tkIdx != 0 {
@@ -577,6 +635,8 @@ func (this *rolzCodec1) Forward(src, dst []byte) (uint, uint, error) {
 		}
 
 		dstIdx += bufSize
+		srcIdx -= start
+		start = 0
 		startChunk = endChunk
 	}
 
@@ -675,6 +735,7 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 
 	this.posChecks = 1 << this.logPosChecks
 	this.maskChecks = this.posChecks - 1
+	start := useDictionary(this.dict, dstEnd+4)
 
 	// Main loop
 	for startChunk < dstEnd {
@@ -776,6 +837,15 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		dstIdx = 0
+
+		if start > 0 {
+			// Decode after the dictionary so that matches can refer to it
+			buf = prependDictionary(this.dict, &this.buf, len(dst))[0 : start+sizeChunk]
+			primeMatches(this.matches, this.counters, this.logPosChecks, this.maskChecks,
+				buf, start, delta, this.minMatch, false)
+			dstIdx = start
+		}
+
 		mm := 8
 
 		if bsVersion < 3 {
@@ -786,6 +856,11 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			mm = dstEnd - startChunk
 		}
 
+		if dstIdx+mm > len(buf) {
+			err = errors.New("ROLZ codec inverse transform failed: invalid data")
+			goto End
+		}
+
 		for j := 0; j < mm; j++ {
 			buf[dstIdx] = litBuf[litIdx]
 			dstIdx++
@@ -793,13 +868,24 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Next chunk
-		for dstIdx < sizeChunk {
+		for dstIdx < start+sizeChunk {
+			// Sanity check
+			if tkIdx >= len(tkBuf) {
+				err = errors.New("ROLZ codec inverse transform failed: invalid data")
+				goto End
+			}
+
 			// mode LLLLLMMM -> L lit length, M match length
 			mode := tkBuf[tkIdx]
 			tkIdx++
 			matchLen := int(mode & 0x07)
 
 			if matchLen == 7 {
+				if lenIdx+4 > len(mLenBuf) {
+					err = errors.New("ROLZ codec inverse transform failed: invalid data")
+					goto End
+				}
+
 				ml, deltaIdx := readLengthROLZ(mLenBuf[lenIdx : lenIdx+4])
 				lenIdx += deltaIdx
 				matchLen = ml + 7
@@ -810,13 +896,18 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			if mode < 0xF8 {
 				litLen = int(mode >> 3)
 			} else {
+				if lenIdx+4 > len(mLenBuf) {
+					err = errors.New("ROLZ codec inverse transform failed: invalid data")
+					goto End
+				}
+
 				ll, deltaIdx := readLengthROLZ(mLenBuf[lenIdx : lenIdx+4])
 				lenIdx += deltaIdx
 				litLen = ll + 31
 			}
 
 			if litLen > 0 {
-				if dstIdx+litLen > len(litBuf) {
+				if dstIdx+litLen > len(buf) || litIdx+litLen > len(litBuf) {
 					err = errors.New("ROLZ codec inverse transform failed: invalid data")
 					goto End
 				}
@@ -848,9 +939,9 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 				litIdx += litLen
 				dstIdx += litLen
 
-				if dstIdx >= sizeChunk {
+				if dstIdx >= start+sizeChunk {
 					// Last chunk literals not followed by match
-					if dstIdx == sizeChunk {
+					if dstIdx == start+sizeChunk {
 						break
 					}
 
@@ -860,7 +951,7 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			}
 
 			// Sanity check
-			if dstIdx+matchLen+this.minMatch > dstEnd {
+			if dstIdx+matchLen+this.minMatch > len(buf) || mIdx >= len(mIdxBuf) {
 				err = errors.New("ROLZ codec inverse transform failed: invalid data")
 				goto End
 			}
@@ -883,6 +974,12 @@ func (this *rolzCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 			m[this.counters[key]] = savedIdx
 		}
 
+		if start > 0 {
+			copy(dst[startChunk:endChunk], buf[start:])
+			dstIdx -= start
+			start = 0
+		}
+
 		startChunk = endChunk
 	}
 
@@ -891,7 +988,7 @@ End:
 		// Emit last literals
 		dstIdx += (startChunk - sizeChunk)
 
-		if dstIdx+4 > len(dst) && srcIdx+4 > len(src) {
+		if dstIdx+4 > len(dst) || srcIdx+4 > len(src) {
 			err = errors.New("ROLZ codec inverse transform failed: invalid input data")
 		} else {
 			dst[dstIdx] = src[srcIdx]
@@ -978,6 +1075,8 @@ type rolzCodec2 struct {
 	posChecks    int32
 	minMatch     int
 	ctx          *map[string]any
+	dict         []byte // optional data preceding the first chunk
+	buf          []byte // dictionary + first chunk
 }
 
 func newROLZCodec2(logPosChecks uint) (*rolzCodec2, error) {
@@ -1008,6 +1107,13 @@ func newROLZCodec2WithCtx(logPosChecks uint, ctx *map[string]any) (*rolzCodec2,
 	this.counters = make([]int32, 1<<16)
 	this.matches = make([]uint32, _ROLZ_HASH_SIZE<<logPosChecks)
 	this.ctx = ctx
+
+	if ctx != nil {
+		if val, containsKey := (*ctx)["dictionaryData"]; containsKey {
+			this.dict = val.([]byte)
+		}
+	}
+
 	return this, nil
 }
 
@@ -1126,6 +1232,7 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 
 	dst[4] = flags
 	sizeChunk := min(len(src), _ROLZ_CHUNK_SIZE)
+	start := useDictionary(this.dict, len(src))
 
 	// Main loop
 	for startChunk < srcEnd {
@@ -1142,7 +1249,18 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 		sizeChunk = endChunk - startChunk
 		re.reset()
 		buf := src[startChunk:endChunk]
-		srcIdx = 0
+
+		if start > 0 {
+			// Prepend the dictionary so that matches can refer to it
+			// The dictionary is only used when the block fits in one chunk
+			buf = prependDictionary(this.dict, &this.buf, len(src))
+			copy(buf[start:], src)
+			buf = buf[0 : start+sizeChunk]
+			primeMatches(this.matches, this.counters, this.logPosChecks, this.maskChecks,
+				buf, start, delta, this.minMatch, true)
+		}
+
+		srcIdx = start
 
 		// First literals
 		mm := 8
@@ -1158,7 +1276,7 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Next chunk
-		for srcIdx < sizeChunk {
+		for srcIdx < start+sizeChunk {
 			re.setContext(_ROLZ_LITERAL_CTX, buf[srcIdx-1])
 			var key uint32
 
@@ -1184,6 +1302,8 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 			srcIdx += (matchLen + this.minMatch)
 		}
 
+		srcIdx -= start
+		start = 0
 		startChunk = endChunk
 	}
 
@@ -1212,6 +1332,10 @@ func (this *rolzCodec2) Forward(src, dst []byte) (uint, uint, error) {
 // to the destination. Returns number of bytes read, number of bytes
 // written and possibly an error.
 func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
+	if len(src) < 5 {
+		return 0, 0, errors.New("ROLZX codec inverse transform failed: invalid input data (input array too small)")
+	}
+
 	dstEnd := int(binary.BigEndian.Uint32(src[0:]))
 
 	if dstEnd <= 0 || dstEnd > len(dst) {
@@ -1250,6 +1374,7 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 	dstIdx := 0
 	startChunk := 0
 	sizeChunk := min(len(dst), _ROLZ_CHUNK_SIZE)
+	start := useDictionary(this.dict, dstEnd)
 	rd, _ := newRolzDecoder(9, this.logPosChecks, src, &srcIdx)
 
 	for i := range this.counters {
@@ -1273,6 +1398,14 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 		rd.reset()
 		dstIdx = 0
 
+		if start > 0 {
+			// Decode after the dictionary so that matches can refer to it
+			buf = prependDictionary(this.dict, &this.buf, len(dst))[0 : start+sizeChunk]
+			primeMatches(this.matches, this.counters, this.logPosChecks, this.maskChecks,
+				buf, start, delta, this.minMatch, false)
+			dstIdx = start
+		}
+
 		// First literals
 		mm := 8
 
@@ -1286,12 +1419,17 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			mm = dstEnd - startChunk
 		}
 
+		if dstIdx+mm > len(buf) {
+			dstIdx += (startChunk - start)
+			return uint(srcIdx), uint(dstIdx), errors.New("ROLZX codec inverse transform failed: invalid data")
+		}
+
 		for j := 0; j < mm; j++ {
 			val := rd.decode9Bits()
 
 			// Sanity check
 			if val>>8 == _ROLZ_MATCH_FLAG {
-				dstIdx += startChunk
+				dstIdx += (startChunk - start)
 				return uint(srcIdx), uint(dstIdx), errors.New("ROLZX codec inverse transform failed: invalid data")
 			}
 
@@ -1300,7 +1438,7 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 		}
 
 		// Next chunk
-		for dstIdx < sizeChunk {
+		for dstIdx < start+sizeChunk {
 			savedIdx := dstIdx
 			var key uint32
 
@@ -1322,8 +1460,8 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 				matchLen := val & 0xFF
 
 				// Sanity check
-				if matchLen+3 > dstEnd {
-					dstIdx += startChunk
+				if dstIdx+matchLen+this.minMatch > len(buf) {
+					dstIdx += (startChunk - start)
 					return uint(srcIdx), uint(dstIdx), errors.New("ROLZX codec inverse transform failed: invalid data")
 				}
 
@@ -1338,6 +1476,12 @@ func (this *rolzCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			m[this.counters[key]] = uint32(savedIdx)
 		}
 
+		if start > 0 {
+			copy(dst[startChunk:endChunk], buf[start:])
+			dstIdx -= start
+			start = 0
+		}
+
 		startChunk = endChunk
 	}
 
@@ -190,13 +190,29 @@ func (this *SRT) Inverse(src, dst []byte) (uint, uint, error) {
 
 	// init arrays
 	freqs := [256]int32{}
-	headerSize := this.decodeHeader(src, freqs[:])
+	headerSize, err := this.decodeHeader(src, freqs[:])
+
+	if err != nil {
+		return 0, 0, err
+	}
+
 	src = src[headerSize:]
 
 	if len(src) > len(dst) {
 		return 0, 0, errors.New("SRT inverse transform failed: invalid data")
 	}
 
+	// The frequencies must add up to the size of the data
+	total := 0
+
+	for _, f := range freqs {
+		total += int(f)
+	}
+
+	if total != len(src) {
+		return 0, 0, errors.New("SRT inverse transform failed: invalid data (incorrect frequencies)")
+	}
+
 	symbols := [256]byte{}
 	nbSymbols := this.preprocess(freqs[:], symbols[:])
 	buckets := [256]int{}
@@ -282,10 +298,15 @@ func (this SRT) encodeHeader(freqs []int32, dst []byte) int {
 	return n
 }
 
-func (this SRT) decodeHeader(src []byte, freqs []int32) int {
+func (this SRT) decodeHeader(src []byte, freqs []int32) (int, error) {
 	n := 0
 
 	for i := range freqs {
+		// A frequency uses up to 4 bytes
+		if n >= len(src) {
+			return n, errors.New("SRT inverse transform failed: invalid header")
+		}
+
 		val := int32(src[n])
 		n++
 
@@ -294,6 +315,10 @@ func (this SRT) decodeHeader(src []byte, freqs []int32) int {
 			continue
 		}
 
+		if n+3 > len(src) {
+			return n, errors.New("SRT inverse transform failed: invalid header")
+		}
+
 		res := val & 0x7F
 		val = int32(src[n])
 		n++
@@ -314,7 +339,7 @@ func (this SRT) decodeHeader(src []byte, freqs []int32) int {
 		freqs[i] = res
 	}
 
-	return n
+	return n, nil
 }
 
 // MaxEncodedLen returns the max size required for the encoding output buffer
@@ -70,6 +70,7 @@ type textCodec1 struct {
 	hashMask       int32
 	isCRLF         bool // EOL = CR+LF ?
 	ctx            *map[string]any
+	dict           []byte // optional data used to seed the dynamic dictionary
 }
 
 type textCodec2 struct {
@@ -81,6 +82,7 @@ type textCodec2 struct {
 	hashMask       int32
 	isCRLF         bool // EOL = CR+LF ?
 	ctx            *map[string]any
+	dict           []byte // optional data used to seed the dynamic dictionary
 }
 
 var (
@@ -455,6 +457,45 @@ func createDictionary(words []byte, dict []dictEntry, maxWords, startWord int) i
 	return nbWords
 }
 
+// addWords adds the words found in data to the dynamic part of the dictionary,
+// starting at index 'words'. Returns the index of the next dictionary entry.
+func addWords(data []byte, dictMap []*dictEntry, dictList []dictEntry, hashMask int32, words, maxWords int) int {
+	delimAnchor := -1 // previous delimiter
+
+	for i := 0; i <= len(data) && words < maxWords; i++ {
+		if i < len(data) && isText(data[i]) {
+			continue
+		}
+
+		// Only words followed by a delimiter can be found by the encoder
+		if i < len(data) && isDelimiter(data[i]) == false {
+			delimAnchor = i
+			continue
+		}
+
+		if length := i - delimAnchor - 1; length > 3 && length <= _TC_MAX_WORD_LENGTH {
+			h := _TC_HASH1
+
+			for j := delimAnchor + 1; j < i; j++ {
+				h = h*_TC_HASH1 ^ int32(data[j])*_TC_HASH2
+			}
+
+			if dictMap[h&hashMask] == nil {
+				pe := &dictList[words]
+				pe.ptr = data[delimAnchor+1:]
+				pe.hash = h
+				pe.data = int32(length<<24) | int32(words)
+				dictMap[h&hashMask] = pe
+				words++
+			}
+		}
+
+		delimAnchor = i
+	}
+
+	return words
+}
+
 func isText(val byte) bool {
 	return isLowerCase(val | 0x20)
 }
@@ -585,6 +626,10 @@ func newTextCodec1WithCtx(ctx *map[string]any) (*textCodec1, error) {
 				log++
 			}
 		}
+
+		if val, hasKey := (*ctx)["dictionaryData"]; hasKey {
+			this.dict = val.([]byte)
+		}
 	}
 
 	this.logHashSize = uint(log)
@@ -638,6 +683,17 @@ func (this *textCodec1) reset(count int) {
 	}
 }
 
+// addDictionaryWords seeds the dynamic dictionary with the words of the
+// shared dictionary (if any). Returns the index of the next dictionary entry.
+func (this *textCodec1) addDictionaryWords() int {
+	if len(this.dict) == 0 {
+		return this.staticDictSize
+	}
+
+	// Stay below the smallest dictionary size to avoid a reset of the index
+	return addWords(this.dict, this.dictMap, this.dictList, this.hashMask, this.staticDictSize, min(this.dictSize, 1<<13)-1)
+}
+
 func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 	count := len(src)
 
@@ -677,7 +733,7 @@ func (this *textCodec1) Forward(src, dst []byte) (uint, uint, error) {
 	dstEnd := this.MaxEncodedLen(count)
 	dstEnd4 := dstEnd - 4
 	emitAnchor := 0 // never negative
-	words := this.staticDictSize
+	words := this.addDictionaryWords()
 
 	// DOS encoded end of line (CR+LF) ?
 	this.isCRLF = mode&_TC_MASK_CRLF != 0
@@ -914,7 +970,7 @@ func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 		delimAnchor = 0
 	}
 
-	words := this.staticDictSize
+	words := this.addDictionaryWords()
 	wordRun := false
 	err := error(nil)
 	this.isCRLF = src[0]&_TC_MASK_CRLF != 0
@@ -984,15 +1040,30 @@ func (this *textCodec1) Inverse(src, dst []byte) (uint, uint, error) {
 
 		if cur == _TC_ESCAPE_TOKEN1 || cur == _TC_ESCAPE_TOKEN2 {
 			// Word in dictionary => read word index (varint 5 bits + 7 bits + 7 bits)
+			if srcIdx >= srcEnd {
+				err = errors.New("Text transform failed. Invalid input data")
+				break
+			}
+
 			idx := int(src[srcIdx])
 			srcIdx++
 
 			if idx >= 128 {
+				if srcIdx >= srcEnd {
+					err = errors.New("Text transform failed. Invalid input data")
+					break
+				}
+
 				idx &= 0x7F
 				idx2 := int(src[srcIdx])
 				srcIdx++
 
 				if idx2 >= 0x80 {
+					if srcIdx >= srcEnd {
+						err = errors.New("Text transform failed. Invalid input data")
+						break
+					}
+
 					idx = ((idx & 0x1F) << 7) | (idx2 & 0x7F)
 					idx2 = int(src[srcIdx])
 					srcIdx++
@@ -1104,6 +1175,10 @@ func newTextCodec2WithCtx(ctx *map[string]any) (*textCodec2, error) {
 				log++
 			}
 		}
+
+		if val, hasKey := (*ctx)["dictionaryData"]; hasKey {
+			this.dict = val.([]byte)
+		}
 	}
 
 	this.logHashSize = uint(log)
@@ -1152,6 +1227,17 @@ func (this *textCodec2) reset(count int) {
 	}
 }
 
+// addDictionaryWords seeds the dynamic dictionary with the words of the
+// shared dictionary (if any). Returns the index of the next dictionary entry.
+func (this *textCodec2) addDictionaryWords() int {
+	if len(this.dict) == 0 {
+		return this.staticDictSize
+	}
+
+	// Stay below the smallest dictionary size to avoid a reset of the index
+	return addWords(this.dict, this.dictMap, this.dictList, this.hashMask, this.staticDictSize, min(this.dictSize, 1<<13)-1)
+}
+
 func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 	count := len(src)
 
@@ -1191,7 +1277,7 @@ func (this *textCodec2) Forward(src, dst []byte) (uint, uint, error) {
 	dstEnd := this.MaxEncodedLen(count)
 	dstEnd3 := dstEnd - 3
 	emitAnchor := 0 // never negative
-	words := this.staticDictSize
+	words := this.addDictionaryWords()
 
 	// DOS encoded end of line (CR+LF) ?
 	this.isCRLF = mode&_TC_MASK_CRLF != 0
@@ -1452,7 +1538,7 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 		delimAnchor = 0
 	}
 
-	words := this.staticDictSize
+	words := this.addDictionaryWords()
 	wordRun := false
 	var err error
 	this.isCRLF = src[0]&_TC_MASK_CRLF != 0
@@ -1527,10 +1613,20 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			idx := int(cur & 0x1F)
 
 			if cur&0x40 != 0 {
+				if srcIdx >= srcEnd {
+					err = errors.New("Text transform failed. Invalid input data")
+					break
+				}
+
 				idx2 := int(src[srcIdx])
 				srcIdx++
 
 				if idx2 >= 128 {
+					if srcIdx >= srcEnd {
+						err = errors.New("Text transform failed. Invalid input data")
+						break
+					}
+
 					idx = (idx << 7) | (idx2 & 0x7F)
 					idx2 = int(src[srcIdx])
 					srcIdx++
@@ -1577,6 +1673,11 @@ func (this *textCodec2) Inverse(src, dst []byte) (uint, uint, error) {
 			dstIdx += length
 		} else {
 			if cur == _TC_ESCAPE_TOKEN1 {
+				if srcIdx >= srcEnd {
+					err = errors.New("Text transform failed. Invalid input data")
+					break
+				}
+
 				dst[dstIdx] = src[srcIdx]
 				srcIdx++
 				dstIdx++
@@ -18,6 +18,8 @@ package transform
 import (
 	"fmt"
 	"math/rand"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -86,6 +88,12 @@ func getTransform(name string) (kanzi.ByteTransform, error) {
 	}
 }
 
+func TestRegister(b *testing.T) {
+	if err := testRegister(); err != nil {
+		b.Errorf(err.Error())
+	}
+}
+
 func TestLZ(b *testing.T) {
 	if err := testTransformCorrectness("LZ"); err != nil {
 		b.Errorf(err.Error())
@@ -349,3 +357,129 @@ func testTransformCorrectness(name string) error {
 	fmt.Println()
 	return error(nil)
 }
+
+// xorTransform a trivial user transform
+type xorTransform struct {
+}
+
+func (this xorTransform) Forward(src, dst []byte) (uint, uint, error) {
+	if len(dst) < len(src) {
+		return 0, 0, fmt.Errorf("Output buffer too small")
+	}
+
+	for i := range src {
+		dst[i] = src[i] ^ 0x55
+	}
+
+	return uint(len(src)), uint(len(src)), nil
+}
+
+func (this xorTransform) Inverse(src, dst []byte) (uint, uint, error) {
+	return this.Forward(src, dst)
+}
+
+func (this xorTransform) MaxEncodedLen(srcLen int) int {
+	return srcLen
+}
+
+var registerOnce sync.Once
+var registerErr error
+
+func testRegister() error {
+	fmt.Println("\nTest user transform registration")
+	factory := func(ctx *map[string]any) (kanzi.ByteTransform, error) {
+		return xorTransform{}, nil
+	}
+
+	registerOnce.Do(func() {
+		registerErr = Register(RESERVED4, "xor", factory)
+	})
+
+	if registerErr != nil {
+		return registerErr
+	}
+
+	// Invalid registrations
+	if Register(RESERVED4, "xor2", factory) == nil {
+		return fmt.Errorf("Registration of existing type should fail")
+	}
+
+	if Register(RESERVED5, "XOR", factory) == nil {
+		return fmt.Errorf("Registration of existing name should fail")
+	}
+
+	if Register(RESERVED5, "LZ", factory) == nil {
+		return fmt.Errorf("Registration of built-in name should fail")
+	}
+
+	if Register(LZ_TYPE, "LZ2", factory) == nil {
+		return fmt.Errorf("Registration of built-in type should fail")
+	}
+
+	if Register(MAX_USER_TYPE+1, "XOR2", factory) == nil {
+		return fmt.Errorf("Registration of invalid type should fail")
+	}
+
+	tType, err := GetType("RLT+xor")
+
+	if err != nil {
+		return err
+	}
+
+	if tType != (RLT_TYPE<<_BFF_MAX_SHIFT)|(RESERVED4<<(_BFF_MAX_SHIFT-_BFF_ONE_SHIFT)) {
+		return fmt.Errorf("Invalid transform type: %x", tType)
+	}
+
+	name, err := GetName(tType)
+
+	if err != nil {
+		return err
+	}
+
+	if name != "RLT+XOR" {
+		return fmt.Errorf("Invalid transform name: %s", name)
+	}
+
+	ctx := make(map[string]any)
+	ctx["bsVersion"] = uint(6)
+	seq, err := New(&ctx, tType)
+
+	if err != nil {
+		return err
+	}
+
+	input := make([]byte, 10000)
+
+	for i := range input {
+		input[i] = byte(65 + rand.Intn(4*(i>>10)+1))
+	}
+
+	// The input buffer is used as a temporary buffer by the sequence
+	tmp := make([]byte, len(input))
+	copy(tmp, input)
+	output := make([]byte, seq.MaxEncodedLen(len(input)))
+	reverse := make([]byte, len(input))
+	_, dstIdx, err := seq.Forward(tmp, output)
+
+	if err != nil {
+		return err
+	}
+
+	if _, _, err = seq.Inverse(output[0:dstIdx], reverse); err != nil {
+		return err
+	}
+
+	for i := range input {
+		if input[i] != reverse[i] {
+			return fmt.Errorf("Different (index %d: %d - %d)", i, input[i], reverse[i])
+		}
+	}
+
+	// Type not registered
+	if _, err = New(&ctx, RESERVED5<<_BFF_MAX_SHIFT); err == nil || strings.Contains(err.Error(), "not registered") == false {
+		return fmt.Errorf("Expected error for unregistered transform, got %v", err)
+	}
+
+	fmt.Println("Identical")
+	return nil
+}
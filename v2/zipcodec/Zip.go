@@ -0,0 +1,238 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package zipcodec provides the kanzi compression method of archive/zip
+// (private method ID) and the conversion of zip files from/to this method.
+package zipcodec
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	kio "github.com/flanglet/kanzi-go/v2/io"
+)
+
+const (
+	// METHOD is the (private) zip compression method of kanzi entries
+	METHOD uint16 = 0x4B5A
+
+	DEFAULT_LEVEL       = 3
+	_DEFAULT_BLOCK_SIZE = 4 * 1024 * 1024
+	_ZIP64_EXTRA_ID     = 0x0001
+	_EXT_TIME_EXTRA_ID  = 0x5455
+)
+
+var registerOnce sync.Once
+
+// Register registers the kanzi compression method with archive/zip for all
+// the readers and writers: decompression with 1 job and compression with
+// the default level. Use NewWriter and NewReader to select other parameters.
+func Register() {
+	registerOnce.Do(func() {
+		comp, _ := Compressor(DEFAULT_LEVEL, 0, 1)
+		zip.RegisterCompressor(METHOD, comp)
+		zip.RegisterDecompressor(METHOD, Decompressor(1))
+	})
+}
+
+// Compressor returns a zip.Compressor encoding with the transform and
+// entropy codec of the level in [0..9] (see io.GetLevelCodecs). The block
+// size is 4 MB if 0 is provided.
+func Compressor(level int, blockSize, jobs uint) (zip.Compressor, error) {
+	t, e, err := kio.GetLevelCodecs(level)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if blockSize == 0 {
+		blockSize = _DEFAULT_BLOCK_SIZE
+	}
+
+	// The zip entries have a CRC32: no block checksum
+	ctx := map[string]any{"transform": t, "entropy": e, "blockSize": blockSize, "jobs": jobs, "checksum": uint(0)}
+
+	// Validate the parameters once
+	null, _ := kio.NewNullOutputStream()
+
+	if _, err = kio.NewWriterWithCtx(null, ctx); err != nil {
+		return nil, err
+	}
+
+	return func(w io.Writer) (io.WriteCloser, error) {
+		// The writer updates its context
+		taskCtx := make(map[string]any, len(ctx))
+
+		for k, v := range ctx {
+			taskCtx[k] = v
+		}
+
+		return kio.NewWriterWithCtx(&nopCloser{w}, taskCtx)
+	}, nil
+}
+
+// Decompressor returns a zip.Decompressor using the provided number of jobs
+func Decompressor(jobs uint) zip.Decompressor {
+	return func(r io.Reader) io.ReadCloser {
+		return &decompressReader{is: r, jobs: jobs}
+	}
+}
+
+// NewWriter creates a zip.Writer with the kanzi compression method
+func NewWriter(w io.Writer, level int, blockSize, jobs uint) (*zip.Writer, error) {
+	comp, err := Compressor(level, blockSize, jobs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(METHOD, comp)
+	return zw, nil
+}
+
+// NewReader creates a zip.Reader able to decompress kanzi entries
+func NewReader(r io.ReaderAt, size int64, jobs uint) (*zip.Reader, error) {
+	zr, err := zip.NewReader(r, size)
+
+	if err != nil {
+		return nil, err
+	}
+
+	zr.RegisterDecompressor(METHOD, Decompressor(jobs))
+	return zr, nil
+}
+
+// Convert copies the entries of src to dst and compresses the files with the
+// provided method (EG. METHOD or zip.Deflate). The compressors of the
+// entries of src and of the method must be registered with src and dst (or
+// globally). Directories are stored. The names, times, comments, modes and
+// extra fields are kept.
+func Convert(dst *zip.Writer, src *zip.Reader, method uint16) error {
+	if err := dst.SetComment(src.Comment); err != nil {
+		return err
+	}
+
+	for _, f := range src.File {
+		fh := f.FileHeader
+		fh.Extra = removeExtra(fh.Extra, _ZIP64_EXTRA_ID, _EXT_TIME_EXTRA_ID)
+		fh.CRC32 = 0
+		fh.CompressedSize64 = 0
+		fh.UncompressedSize64 = 0
+		fh.CompressedSize = 0
+		fh.UncompressedSize = 0
+		fh.Method = method
+		isDir := strings.HasSuffix(fh.Name, "/")
+
+		if isDir == true {
+			fh.Method = zip.Store
+		}
+
+		w, err := dst.CreateHeader(&fh)
+
+		if err != nil {
+			return fmt.Errorf("cannot create entry '%s': %w", f.Name, err)
+		}
+
+		if isDir == true {
+			continue
+		}
+
+		r, err := f.Open()
+
+		if err != nil {
+			return fmt.Errorf("cannot open entry '%s': %w", f.Name, err)
+		}
+
+		_, err = io.Copy(w, r)
+
+		// Close also checks the CRC32 of the entry
+		if err2 := r.Close(); err == nil {
+			err = err2
+		}
+
+		if err != nil {
+			return fmt.Errorf("cannot convert entry '%s': %w", f.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// removeExtra removes the fields with the provided ids from the extra fields.
+// Used for the fields rewritten by the zip writer: the zip64 extended
+// information (if required) and the extended timestamp (from Modified).
+func removeExtra(extra []byte, ids ...uint16) []byte {
+	res := make([]byte, 0, len(extra))
+
+	for len(extra) >= 4 {
+		tag := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+
+		if 4+size > len(extra) {
+			break
+		}
+
+		if slices.Contains(ids, tag) == false {
+			res = append(res, extra[0:4+size]...)
+		}
+
+		extra = extra[4+size:]
+	}
+
+	return res
+}
+
+// decompressReader creates the reader on the first read (a zip.Decompressor
+// cannot return an error)
+type decompressReader struct {
+	is     io.Reader
+	reader *kio.Reader
+	jobs   uint
+	err    error
+}
+
+func (this *decompressReader) Read(buf []byte) (int, error) {
+	if this.reader == nil && this.err == nil {
+		this.reader, this.err = kio.NewReaderWithCtx(io.NopCloser(this.is), map[string]any{"jobs": this.jobs})
+	}
+
+	if this.err != nil {
+		return 0, this.err
+	}
+
+	return this.reader.Read(buf)
+}
+
+func (this *decompressReader) Close() error {
+	if this.reader == nil {
+		return nil
+	}
+
+	return this.reader.Close()
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+/*
+Copyright 2011-2024 Frederic Langlet
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+you may obtain a copy of the License at
+
+                http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package zipcodec
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvert(b *testing.T) {
+	fmt.Println("Test - convert zip files from/to the kanzi method")
+	random := make([]byte, 100000)
+
+	for i := range random {
+		random[i] = byte(rand.Intn(256))
+	}
+
+	entries := map[string][]byte{
+		"dir/":          nil,
+		"dir/text.txt":  []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 10000)),
+		"dir/empty.txt": {},
+		"random.bin":    random,
+	}
+
+	names := []string{"dir/", "dir/text.txt", "dir/empty.txt", "random.bin"}
+	modified := time.Date(2024, 5, 17, 10, 30, 0, 0, time.UTC)
+	custom := []byte{0xFE, 0xCA, 2, 0, 'k', 'z'}
+	var original bytes.Buffer
+	zw := zip.NewWriter(&original)
+	zw.SetComment("kanzi test")
+
+	for i, name := range names {
+		method := zip.Deflate
+
+		if i%2 == 0 {
+			method = zip.Store
+		}
+
+		fh := &zip.FileHeader{Name: name, Method: method, Comment: name, Modified: modified, Extra: custom}
+		w, err := zw.CreateHeader(fh)
+
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+
+		w.Write(entries[name])
+	}
+
+	zw.Close()
+
+	// Standard zip => kanzi zip
+	src, err := NewReader(bytes.NewReader(original.Bytes()), int64(original.Len()), 1)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	var converted bytes.Buffer
+
+	if _, err = NewWriter(&converted, 10, 0, 1); err == nil {
+		b.Error("Expected error with invalid level")
+	}
+
+	dst, _ := NewWriter(&converted, 4, 65536, 2)
+
+	if err = Convert(dst, src, METHOD); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	if err = dst.Close(); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	fmt.Printf("%d => %d bytes\n", original.Len(), converted.Len())
+	kzr, err := NewReader(bytes.NewReader(converted.Bytes()), int64(converted.Len()), 2)
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	check(b, kzr, entries, names, METHOD)
+
+	// Kanzi zip => standard zip
+	var restored bytes.Buffer
+	zw = zip.NewWriter(&restored)
+
+	if err = Convert(zw, kzr, zip.Deflate); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	zw.Close()
+	zr, err := zip.NewReader(bytes.NewReader(restored.Bytes()), int64(restored.Len()))
+
+	if err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	check(b, zr, entries, names, zip.Deflate)
+
+	// Without registered decompressor
+	if zr, err = zip.NewReader(bytes.NewReader(converted.Bytes()), int64(converted.Len())); err != nil {
+		b.Fatalf("%v", err)
+	}
+
+	if _, err = zr.File[1].Open(); err == nil {
+		b.Error("Expected error with unregistered method")
+	}
+
+	// The extra fields are stable over repeated conversions
+	current := converted.Bytes()
+
+	for i := 0; i < 3; i++ {
+		src, _ = NewReader(bytes.NewReader(current), int64(len(current)), 1)
+		var next bytes.Buffer
+		dst, _ = NewWriter(&next, 2, 65536, 1)
+
+		if err = Convert(dst, src, METHOD); err != nil {
+			b.Fatalf("%v", err)
+		}
+
+		dst.Close()
+		current = next.Bytes()
+		zr, _ = NewReader(bytes.NewReader(current), int64(len(current)), 1)
+		check(b, zr, entries, names, METHOD)
+
+		for j, f := range zr.File {
+			if bytes.Equal(f.Extra, kzr.File[j].Extra) == false || bytes.Contains(f.Extra, custom) == false || f.Modified.Equal(modified) == false {
+				b.Errorf("Conversion %d: invalid extra fields for %s: %x", i, f.Name, f.Extra)
+			}
+		}
+	}
+}
+
+func check(b *testing.T, zr *zip.Reader, entries map[string][]byte, names []string, method uint16) {
+	if zr.Comment != "kanzi test" || len(zr.File) != len(names) {
+		b.Fatalf("Invalid zip: comment '%s', %d entries", zr.Comment, len(zr.File))
+	}
+
+	for i, f := range zr.File {
+		if f.Name != names[i] || f.Comment != names[i] {
+			b.Errorf("Invalid entry %d: %s", i, f.Name)
+		}
+
+		expected := method
+
+		if strings.HasSuffix(f.Name, "/") {
+			expected = zip.Store
+		}
+
+		if f.Method != expected {
+			b.Errorf("Invalid method for %s: %#x", f.Name, f.Method)
+		}
+
+		r, err := f.Open()
+
+		if err != nil {
+			b.Fatalf("%v", err)
+		}
+
+		data, err := io.ReadAll(r)
+		r.Close()
+
+		if err != nil || bytes.Equal(data, entries[f.Name]) == false {
+			b.Errorf("Invalid content for %s: %v", f.Name, err)
+		}
+	}
+}